@@ -0,0 +1,8 @@
+module github.com/Foreground-Eclipse/testprotos
+
+go 1.22
+
+require (
+	google.golang.org/grpc v1.64.0
+	google.golang.org/protobuf v1.34.2
+)
@@ -2,108 +2,359 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
-	"log"
 	"log/slog"
+	gatewayapp "sso/sso/cmd/inter/app/gateway"
 	grpcapp "sso/sso/cmd/inter/app/grpc"
+	metricsapp "sso/sso/cmd/inter/app/metrics"
+	telegramapp "sso/sso/cmd/inter/app/telegram"
+	"sso/sso/cmd/inter/config"
+	"sso/sso/cmd/inter/lib/fieldcrypt"
+	"sso/sso/cmd/inter/lib/httpserver"
+	"sso/sso/cmd/inter/lib/notify"
+	"sso/sso/cmd/inter/lib/passhash"
+	"sso/sso/cmd/inter/lib/ratelimit"
+	"sso/sso/cmd/inter/lib/tlsreload"
+	"sso/sso/cmd/inter/lib/tracing"
+	"sso/sso/cmd/inter/lib/validation"
+	"sso/sso/cmd/inter/services/audit"
 	"sso/sso/cmd/inter/services/auth"
+	"sso/sso/cmd/inter/services/breach"
+	"sso/sso/cmd/inter/services/email"
+	"sso/sso/cmd/inter/services/erasure"
+	"sso/sso/cmd/inter/services/health"
+	"sso/sso/cmd/inter/services/sms"
+	"sso/sso/cmd/inter/services/telegram"
+	"sso/sso/cmd/inter/services/webhook"
 	"sso/sso/cmd/inter/storage/sqlite"
+	"sync"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/keepalive"
 )
 
 type App struct {
 	GRPCSrv *grpcapp.App
+	// Metrics is nil when no metrics port is configured.
+	Metrics *metricsapp.App
+	// Gateway is nil when no gateway port is configured.
+	Gateway *gatewayapp.App
+	// Tracing is nil when tracing is disabled, it is shut down last to flush the spans.
+	Tracing *sdktrace.TracerProvider
+	// TelegramBot is nil when no telegram token is configured.
+	TelegramBot *telegramapp.App
+	Health      *health.Monitor
+	// TLS is nil when the gRPC listener is not encrypted.
+	TLS          *tlsreload.Reloader
+	Webhooks     *webhook.Dispatcher
+	AccountPurge *erasure.Job
+
+	// the settings changed by Reload
+	mu      sync.Mutex
+	level   *slog.LevelVar
+	auth    *auth.Auth
+	started *config.Config
+	current *config.Config
 }
 
+// New builds the application from cfg, level is the level of log and is
+// changed by Reload.
 func New(
 	log *slog.Logger,
-	grpcPort int,
-	storagePath string,
-	tokenTTL time.Duration,
-) *App {
+	level *slog.LevelVar,
+	cfg *config.Config,
+) (_ *App, err error) {
+	const op = "app.New"
 
-	storage, err := sqlite.New(storagePath)
+	tracer, err := tracing.Setup(context.Background(), tracing.Params{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	defer func() {
+		if err != nil && tracer != nil {
+			_ = tracer.Shutdown(context.Background())
+		}
+	}()
 
-	authService := auth.New(log, storage, storage, storage, storage, storage, tokenTTL)
-	grpcApp := grpcapp.New(log, grpcPort, authService)
+	keys, err := fieldcrypt.Load(cfg.Encryption.MasterKeys, cfg.Encryption.KeyFile, cfg.Encryption.IndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if keys == nil {
+		log.Warn("no encryption keys are set, personal data of users is stored in plaintext")
+	}
 
-	return &App{GRPCSrv: grpcApp}
-}
+	storage, err := sqlite.New(cfg.StoragePath, keys)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	client, sender, err := newTelegramClient(log, cfg.Telegram)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// keep the notifier a nil interface when telegram is disabled
+	var loginNotifier auth.LoginNotifier
+	if sender != nil {
+		loginNotifier = sender
+	}
+
+	mailer := email.New(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.From)
+	smsSender := newSMSSender(log, cfg.SMS)
+	breachChecker, err := newBreachChecker(log, cfg.Breach)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	hasher, err := passhash.New(cfg.PasswordHash.Params())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	auditSinks := []audit.Sink{storage}
+	if cfg.Audit.FilePath != "" {
+		auditSinks = append(auditSinks, audit.NewFileSink(cfg.Audit.FilePath))
+	}
+	auditor := audit.New(log, auditSinks...)
+
+	// wakes up the event stream and the webhooks when a user event is saved
+	eventsHub := notify.NewBroadcaster()
+
+	// validated with the rest of the config
+	secrets, err := config.ParseAppSecrets(cfg.Signing.AppSecrets)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	codeKey, err := cfg.Codes.Key()
+	if err != nil {
+		return nil, fmt.Errorf("%s: codes.hash_key %w", op, err)
+	}
+
+	authService := auth.New(log, auth.Deps{
+		UserSaver:     storage,
+		UserProvider:  storage,
+		AppProvider:   auth.WithAppSecrets(storage, secrets),
+		EmailSaver:    storage,
+		EmailUpdater:  storage,
+		UserUpdater:   storage,
+		Verifier:      storage,
+		Sessions:      storage,
+		Approvals:     storage,
+		Notifier:      loginNotifier,
+		Codes:         storage,
+		Mailer:        mailer,
+		SMSSender:     smsSender,
+		BreachChecker: breachChecker,
+		Hasher:        hasher,
+		Auditor:       auditor,
+		AuditLog:      storage,
+		UserEvents:    storage,
+		Webhooks:      storage,
+		AccountData:   storage,
+		EventsHub:     eventsHub,
+	}, auth.Params{
+		TokenTTL:            cfg.TokenTTL,
+		CodeTTL:             cfg.Passwordless.CodeTTL,
+		LoginLinkURL:        cfg.Passwordless.LinkURL,
+		EnumerationSafe:     cfg.Registration.EnumerationSafe,
+		DeletionGracePeriod: cfg.AccountDeletion.GracePeriod,
+		Pseudonymize:        cfg.AccountDeletion.Pseudonymize,
+		CodeKey:             codeKey,
+	})
+	validator := validation.New(validation.Policy{
+		MinPasswordLength: cfg.Validation.MinPasswordLength,
+		MaxPasswordLength: cfg.Validation.MaxPasswordLength,
+		MinPasswordScore:  cfg.Validation.MinPasswordScore,
+		MinAge:            cfg.Validation.MinAge,
+		MaxEmailLength:    cfg.Validation.MaxEmailLength,
+		MaxNameLength:     cfg.Validation.MaxNameLength,
+	})
+	var telegramBot *telegramapp.App
+	if client != nil {
+		telegramBot = telegramapp.New(log, client, sender, authService, authService, cfg.Telegram.Timeout)
+	}
+
+	// only the storage is needed to serve, the others disable a few features
+	monitor := health.New(log, cfg.Health.Interval, cfg.Health.Timeout)
+	monitor.Add(health.ServiceStorage, true, storage.Ready)
+	monitor.Add(health.ServiceNotifier, false, mailer.Check)
+	if telegramBot != nil {
+		monitor.Add(health.ServiceTelegram, false, telegramBot.Check)
+	}
+
+	var (
+		tlsReloader *tlsreload.Reloader
+		tlsConfig   *tls.Config
+	)
+	if cfg.GRPC.TLS.CertFile != "" {
+		tlsReloader, err = tlsreload.New(log, cfg.GRPC.TLS.CertFile, cfg.GRPC.TLS.KeyFile,
+			cfg.GRPC.TLS.ClientCAFile, cfg.GRPC.TLS.ClientCertOptional)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		tlsConfig = tlsReloader.Config()
+	}
+
+	grpcApp := grpcapp.New(log, grpcapp.Deps{
+		Auth:      authService,
+		Validator: validator,
+		Health:    monitor.Server(),
+	}, grpcapp.Params{
+		Port:              cfg.GRPC.Port,
+		TLS:               tlsConfig,
+		PrivilegedClients: cfg.GRPC.TLS.PrivilegedClients,
+		Reflection:        cfg.GRPC.Reflection,
+		Timeout:           cfg.GRPC.Timeout,
+		MethodTimeouts:    cfg.GRPC.MethodTimeouts,
+		Keepalive: keepalive.ServerParameters{
+			Time:                  cfg.GRPC.Keepalive.Time,
+			Timeout:               cfg.GRPC.Keepalive.Timeout,
+			MaxConnectionIdle:     cfg.GRPC.Keepalive.MaxConnectionIdle,
+			MaxConnectionAge:      cfg.GRPC.Keepalive.MaxConnectionAge,
+			MaxConnectionAgeGrace: cfg.GRPC.Keepalive.MaxConnectionAgeGrace,
+		},
+		KeepalivePolicy: keepalive.EnforcementPolicy{
+			MinTime:             cfg.GRPC.Keepalive.MinTime,
+			PermitWithoutStream: cfg.GRPC.Keepalive.PermitWithoutStream,
+		},
+		RateLimit:        ratelimit.Rule{Rate: cfg.RateLimit.Rate, Burst: cfg.RateLimit.Burst},
+		MethodRateLimits: methodRateLimits(cfg.RateLimit.Methods),
+	})
+
+	webhooks := webhook.New(log, storage, storage, eventsHub,
+		cfg.Webhook.Timeout, cfg.Webhook.MaxAttempts, cfg.Webhook.RetryDelay, cfg.Webhook.PollInterval,
+		cfg.Webhook.AllowPrivateTargets,
+	)
+
+	httpParams := httpserver.Params{
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+		ShutdownTimeout:   cfg.HTTP.ShutdownTimeout,
+	}
 
-type TelegramAuth struct {
-	log              *slog.Logger
-	telegramProvider TelegramProvider
+	var metricsApp *metricsapp.App
+	if cfg.Metrics.Port != 0 {
+		metricsApp = metricsapp.New(log, cfg.Metrics.Port, monitor, httpParams)
+	}
+
+	var gatewayApp *gatewayapp.App
+	if cfg.Gateway.Port != 0 {
+		// the gateway serves the certificate of the gRPC listener
+		var gatewayTLS *tls.Config
+		if tlsReloader != nil {
+			gatewayTLS = tlsReloader.HTTPConfig()
+		}
+		gatewayApp = gatewayapp.New(log, cfg.Gateway.Port, grpcApp.AuthServer(), grpcApp.Invoke,
+			cfg.Gateway.AllowedOrigins, httpParams, gatewayTLS,
+		)
+	}
+
+	return &App{
+		GRPCSrv:      grpcApp,
+		Metrics:      metricsApp,
+		Gateway:      gatewayApp,
+		Tracing:      tracer,
+		TelegramBot:  telegramBot,
+		Health:       monitor,
+		TLS:          tlsReloader,
+		Webhooks:     webhooks,
+		AccountPurge: erasure.New(log, authService, cfg.AccountDeletion.PurgeInterval),
+		level:        level,
+		auth:         authService,
+		started:      cfg,
+		current:      cfg,
+	}, nil
 }
 
-type TelegramProvider interface {
-	ConfirmAccountTG(ctx context.Context, telegramName string) int
+func methodRateLimits(methods map[string]config.RateLimitRule) map[string]ratelimit.Rule {
+	rules := make(map[string]ratelimit.Rule, len(methods))
+	for method, rule := range methods {
+		rules[method] = ratelimit.Rule{Rate: rule.Rate, Burst: rule.Burst}
+	}
+	return rules
 }
 
-func NewTelegramBot(tga *TelegramAuth) {
-	const op = "app.app.NewTelegramBot"
+// newTelegramClient returns nil client and sender if no token is set. With a
+// token the bot has to start, telegram is asked again telegram.retries times
+// before the startup fails.
+func newTelegramClient(
+	log *slog.Logger,
+	cfg config.TelegramConfig,
+) (telegram.Client, *telegram.Sender, error) {
+	const op = "app.newTelegramClient"
+
+	log = log.With(slog.String("op", op))
 
-	storage, err := sqlite.New("F:/mainwork/sso/inter/config/storage/sso.db")
-	tga.telegramProvider = storage
-	bot, err := tgbotapi.NewBotAPI("")
-	if err != nil {
-		log.Fatalf("%s: %v", op, err)
+	if cfg.Token == "" {
+		log.Warn("telegram token is not set, telegram bot is disabled")
+		return nil, nil, nil
 	}
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	retries := max(cfg.Retries, 1)
+
+	var (
+		client *tgbotapi.BotAPI
+		err    error
+	)
+	for attempt := 1; attempt <= retries; attempt++ {
+		if client, err = tgbotapi.NewBotAPI(cfg.Token); err == nil {
+			break
+		}
+
+		log.Warn("failed to create telegram client",
+			slog.Int("attempt", attempt),
+			slog.String("error", err.Error()),
+		)
 
-	updates, err := bot.GetUpdatesChan(u)
+		if attempt < retries {
+			time.Sleep(cfg.RetryDelay * time.Duration(attempt))
+		}
+	}
 	if err != nil {
-		log.Fatalf("%s: %v", op, err)
-	}
-
-	for update := range updates {
-		if update.CallbackQuery != nil {
-			// Handle callback query from inline button
-			callbackData := update.CallbackQuery.Data
-			telegramName := update.CallbackQuery.From.UserName
-			fmt.Println(telegramName)
-			ctx := context.Background()
-
-			var responseText string
-			switch tga.telegramProvider.ConfirmAccountTG(ctx, telegramName) {
-			case -1:
-				responseText = "You already verified"
-
-			case 0:
-				responseText = "You aren't registered yet"
-			case 1:
-				responseText = "You are now verified"
-			default:
-				responseText = "An unexpected error occurred"
-			}
-
-			callbackConfig := tgbotapi.NewCallback(update.CallbackQuery.ID, callbackData)
-			if _, err := bot.AnswerCallbackQuery(callbackConfig); err != nil {
-				log.Fatalf("%s: %v", op, err)
-			}
-
-			// Respond to the button press
-			msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, responseText)
-			if _, err := bot.Send(msg); err != nil {
-				log.Fatalf("%s: %v", op, err)
-			}
-		} else if update.Message != nil {
-			// Handle regular message
-			msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Press the button to get your verification code")
-			msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
-				tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData("Verify me 🔥", "verify_me"),
-				),
-			)
-			if _, err := bot.Send(msg); err != nil {
-				log.Fatalf("%s: %v", op, err)
-			}
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return client, telegram.New(log, client, cfg.Retries, cfg.RetryDelay), nil
+}
+
+func newSMSSender(log *slog.Logger, cfg config.SMSConfig) sms.Sender {
+	switch cfg.Driver {
+	case "file":
+		return sms.NewFileSender(cfg.FilePath)
+	case "http":
+		return sms.NewHTTPSender(cfg.URL, cfg.APIKey, cfg.Timeout)
+	default:
+		return sms.NewLogSender(log)
+	}
+}
+
+// newBreachChecker returns nil if the check is disabled. A corpus that can't be
+// opened fails the startup instead of silently accepting breached passwords.
+func newBreachChecker(log *slog.Logger, cfg config.BreachConfig) (auth.BreachChecker, error) {
+	const op = "app.newBreachChecker"
+
+	switch cfg.Driver {
+	case "file":
+		checker, err := breach.NewFileChecker(cfg.FilePath, cfg.IndexPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
 		}
+		return checker, nil
+	case "http":
+		return breach.NewHTTPChecker(cfg.URL, cfg.Timeout), nil
+	default:
+		log.With(slog.String("op", op)).Warn("breached password check is disabled")
+		return nil, nil
 	}
 }
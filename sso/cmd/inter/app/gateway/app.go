@@ -0,0 +1,135 @@
+package gatewayapp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sso/sso/cmd/inter/lib/httpserver"
+	"time"
+
+	v1 "github.com/Foreground-Eclipse/testprotos/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const maxBodySize = 1 << 20
+
+// Invoker runs a handler of the Auth service behind the interceptors of the gRPC server.
+type Invoker func(ctx context.Context, method string, req any, handler grpc.UnaryHandler) (any, error)
+
+// App serves the unary methods of the Auth service as JSON over HTTP for the
+// clients that can't speak gRPC, WatchUserEvents is only served over gRPC.
+type App struct {
+	log             *slog.Logger
+	server          *http.Server
+	port            int
+	tlsConfig       *tls.Config
+	shutdownTimeout time.Duration
+}
+
+// New returns the gateway, it serves HTTPS when tlsConfig is set and plain HTTP otherwise
+func New(
+	log *slog.Logger,
+	port int,
+	auth v1.AuthServer,
+	invoke Invoker,
+	allowedOrigins []string,
+	params httpserver.Params,
+	tlsConfig *tls.Config,
+) *App {
+	mux := http.NewServeMux()
+	for _, r := range routes(auth) {
+		mux.Handle(r.path, r.handler(invoke))
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
+		writeError(w, http.StatusNotFound, codes.NotFound, "unknown path")
+	})
+
+	return &App{
+		log:             log,
+		server:          httpserver.New(withCORS(mux, allowedOrigins), params),
+		port:            port,
+		tlsConfig:       tlsConfig,
+		shutdownTimeout: params.ShutdownTimeout,
+	}
+}
+
+// MustRun runs the gateway and panics if any error occurs
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) Run() error {
+	const op = "gatewayapp.Run"
+
+	log := a.log.With(slog.String("op", op))
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if a.tlsConfig != nil {
+		l = tls.NewListener(l, a.tlsConfig)
+	}
+
+	log.Info("json gateway is running", slog.String("addr", l.Addr().String()), slog.Bool("tls", a.tlsConfig != nil))
+
+	if err := a.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *App) Stop() {
+	const op = "gatewayapp.Stop"
+
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("stopping json gateway", slog.Int("port", a.port))
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
+	defer cancel()
+
+	if err := a.server.Shutdown(ctx); err != nil {
+		log.Error("failed to stop json gateway", slog.String("error", err.Error()))
+	}
+}
+
+// withCORS lets the browsers on the allowed origins call the gateway, "*" allows any origin
+func withCORS(next http.Handler, allowedOrigins []string) http.Handler {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		allowed[origin] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || (!allowed[origin] && !allowed["*"]) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Add("Vary", "Origin")
+		h.Set("Access-Control-Expose-Headers", "X-Request-Id")
+
+		if r.Method == http.MethodOptions {
+			h.Set("Access-Control-Allow-Methods", http.MethodPost)
+			h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Request-Id")
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
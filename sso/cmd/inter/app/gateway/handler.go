@@ -0,0 +1,268 @@
+package gatewayapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sso/sso/cmd/inter/lib/tracing"
+	"strings"
+
+	v1 "github.com/Foreground-Eclipse/testprotos/gen/go/sso"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// unknown fields are ignored so clients can send fields of newer versions
+	unmarshalOptions = protojson.UnmarshalOptions{DiscardUnknown: true}
+	marshalOptions   = protojson.MarshalOptions{UseProtoNames: true}
+)
+
+// forwardedHeaders are passed on to the handlers as the gRPC metadata of the same name
+var forwardedHeaders = []string{"authorization", "user-agent", "x-request-id"}
+
+type route struct {
+	path    string
+	handler func(invoke Invoker) http.Handler
+}
+
+func routes(auth v1.AuthServer) []route {
+	return []route{
+		unary("/v1/login", "Login", auth.Login),
+		unary("/v1/login/await-approval", "AwaitLoginApproval", auth.AwaitLoginApproval),
+		unary("/v1/passwordless/start", "StartPasswordlessLogin", auth.StartPasswordlessLogin),
+		unary("/v1/passwordless/complete", "CompletePasswordlessLogin", auth.CompletePasswordlessLogin),
+		unary("/v1/register", "Register", auth.Register),
+		unary("/v1/is-admin", "IsAdmin", auth.IsAdmin),
+		unary("/v1/verify-email", "EmailVerification", auth.EmailVerification),
+		unary("/v1/reset-password", "ResetPassword", auth.ResetPassword),
+		unary("/v1/change-password", "ChangePassword", auth.ChangePassword),
+		unary("/v1/change-email", "ChangeEmail", auth.ChangeEmail),
+		unary("/v1/confirm-email-change", "ConfirmEmailChange", auth.ConfirmEmailChange),
+		unary("/v1/profile", "GetProfile", auth.GetProfile),
+		unary("/v1/update-profile", "UpdateProfile", auth.UpdateProfile),
+		unary("/v1/send-phone-verification", "SendPhoneVerification", auth.SendPhoneVerification),
+		unary("/v1/verify-phone", "VerifyPhone", auth.VerifyPhone),
+		unary("/v1/export-my-data", "ExportMyData", auth.ExportMyData),
+		unary("/v1/delete-account", "DeleteAccount", auth.DeleteAccount),
+		unary("/v1/admin/audit-log", "QueryAuditLog", auth.QueryAuditLog),
+		unary("/v1/admin/set-admin", "SetAdmin", auth.SetAdmin),
+		unary("/v1/admin/webhooks/create", "CreateWebhookEndpoint", auth.CreateWebhookEndpoint),
+		unary("/v1/admin/webhooks/list", "ListWebhookEndpoints", auth.ListWebhookEndpoints),
+		unary("/v1/admin/webhooks/deliveries", "ListWebhookDeliveries", auth.ListWebhookDeliveries),
+		unary("/v1/admin/webhooks/replay", "ReplayWebhookDeliveries", auth.ReplayWebhookDeliveries),
+		unary("/v1/admin/webhooks/set-disabled", "SetWebhookEndpointDisabled", auth.SetWebhookEndpointDisabled),
+	}
+}
+
+// unary serves a method on POST path, the body is the request message in
+// the proto3 JSON mapping and the response message is sent back the same
+// way. The fields are named like in the proto file, lowerCamelCase names are
+// accepted in requests as well.
+func unary[Req, Resp any, PReq interface {
+	*Req
+	proto.Message
+}, PResp interface {
+	*Resp
+	proto.Message
+}](path string, name string, call func(context.Context, PReq) (PResp, error)) route {
+	method := "/" + v1.Auth_ServiceDesc.ServiceName + "/" + name
+
+	return route{
+		path: path,
+		handler: func(invoke Invoker) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					w.Header().Set("Allow", http.MethodPost)
+					writeError(w, http.StatusMethodNotAllowed, codes.Unimplemented, "method not allowed, use POST")
+					return
+				}
+
+				body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+				if err != nil {
+					writeError(w, http.StatusBadRequest, codes.InvalidArgument, "invalid request body")
+					return
+				}
+
+				req := PReq(new(Req))
+				// methods without fields can be called with an empty body
+				if len(bytes.TrimSpace(body)) > 0 {
+					if err := unmarshalOptions.Unmarshal(body, req); err != nil {
+						writeError(w, http.StatusBadRequest, codes.InvalidArgument, "invalid request body: "+err.Error())
+						return
+					}
+				}
+
+				ctx, stream := incomingContext(r, method)
+				ctx, span := tracing.Start(ctx, strings.TrimPrefix(method, "/"))
+				defer span.End()
+
+				resp, err := invoke(ctx, method, req, func(ctx context.Context, req any) (any, error) {
+					return call(ctx, req.(PReq))
+				})
+
+				for key, values := range stream.header {
+					for _, value := range values {
+						w.Header().Add(key, value)
+					}
+				}
+
+				if err != nil {
+					tracing.RecordError(span, err)
+					writeStatus(w, status.Convert(err))
+					return
+				}
+
+				writeMessage(w, http.StatusOK, resp.(PResp))
+			})
+		},
+	}
+}
+
+// incomingContext makes the request look like a gRPC call to the handler
+// and the interceptors: the headers become metadata, the remote address and
+// the client certificate the peer, and the headers set by the handler are
+// collected in the stream.
+func incomingContext(r *http.Request, method string) (context.Context, *transportStream) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+	md := metadata.MD{}
+	for _, key := range forwardedHeaders {
+		if value := r.Header.Get(key); value != "" {
+			md.Set(key, value)
+		}
+	}
+	ctx = metadata.NewIncomingContext(ctx, md)
+
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		p := &peer.Peer{Addr: addr}
+		// the interceptors trust the client certificate verified by the listener
+		if r.TLS != nil {
+			p.AuthInfo = credentials.TLSInfo{
+				State:          *r.TLS,
+				CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+			}
+		}
+		ctx = peer.NewContext(ctx, p)
+	}
+
+	stream := &transportStream{method: method, header: metadata.MD{}}
+
+	return grpc.NewContextWithServerTransportStream(ctx, stream), stream
+}
+
+// transportStream collects the headers the handler sets with grpc.SetHeader
+type transportStream struct {
+	method string
+	header metadata.MD
+}
+
+func (s *transportStream) Method() string {
+	return s.method
+}
+
+func (s *transportStream) SetHeader(md metadata.MD) error {
+	for key, values := range md {
+		s.header.Append(key, values...)
+	}
+	return nil
+}
+
+func (s *transportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *transportStream) SetTrailer(metadata.MD) error {
+	return nil
+}
+
+// errorBody is sent for every failed call, code and status are the gRPC
+// status code as a number and as a name.
+type errorBody struct {
+	Code    codes.Code `json:"code"`
+	Status  string     `json:"status"`
+	Message string     `json:"message"`
+	// Details are the error details of the status in the proto3 JSON mapping,
+	// e.g. a google.rpc.BadRequest with the invalid fields, named by "@type"
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, httpCode int, code codes.Code, message string) {
+	writeJSON(w, httpCode, errorBody{Code: code, Status: code.String(), Message: message})
+}
+
+// writeStatus sends the status of a failed call with its details
+func writeStatus(w http.ResponseWriter, st *status.Status) {
+	body := errorBody{Code: st.Code(), Status: st.Code().String(), Message: st.Message()}
+	for _, detail := range st.Proto().GetDetails() {
+		encoded, err := marshalOptions.Marshal(detail)
+		if err != nil {
+			// the type of the detail is not linked into the binary
+			continue
+		}
+		body.Details = append(body.Details, encoded)
+	}
+
+	writeJSON(w, httpStatus(st.Code()), body)
+}
+
+// writeMessage sends the message in the proto3 JSON mapping
+func writeMessage(w http.ResponseWriter, httpCode int, message proto.Message) {
+	body, err := marshalOptions.Marshal(message)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codes.Internal, "failed to encode the response")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpCode)
+	_, _ = w.Write(body)
+}
+
+func writeJSON(w http.ResponseWriter, httpCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// httpStatus maps the gRPC status codes to the HTTP ones the way the
+// grpc-gateway does
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
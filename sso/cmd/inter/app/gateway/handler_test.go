@@ -0,0 +1,214 @@
+package gatewayapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	authgrpc "sso/sso/cmd/inter/grpc/auth"
+	"sso/sso/cmd/inter/lib/httpserver"
+	"sso/sso/cmd/inter/lib/validation"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// fakeAuth serves Login and RegisterNewUser, the token names the email and the app
+type fakeAuth struct {
+	authgrpc.Auth
+}
+
+func (fakeAuth) Login(_ context.Context, email string, _ string, appID int) (string, error) {
+	return fmt.Sprintf("%s/%d", email, appID), nil
+}
+
+func (fakeAuth) RegisterNewUser(context.Context, string, string, string, string, string, string) (int64, error) {
+	return 7, nil
+}
+
+// call is what the invoker got from the gateway
+type call struct {
+	method string
+	md     metadata.MD
+}
+
+func newTestHandler(t *testing.T) (http.Handler, *[]call) {
+	t.Helper()
+
+	validator := validation.New(validation.Policy{
+		MinPasswordLength: 8,
+		MaxPasswordLength: 72,
+		MinPasswordScore:  2,
+		MinAge:            14,
+		MaxEmailLength:    254,
+		MaxNameLength:     100,
+	})
+
+	var calls []call
+	invoke := func(ctx context.Context, method string, req any, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		calls = append(calls, call{method: method, md: md})
+		return handler(ctx, req)
+	}
+
+	a := New(slog.New(slog.NewTextHandler(io.Discard, nil)), 0, authgrpc.NewServer(fakeAuth{}, validator), invoke,
+		nil, httpserver.Params{}, nil,
+	)
+	return a.server.Handler, &calls
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		header     http.Header
+		wantStatus int
+		wantBody   map[string]any
+		// wantMethod is the gRPC method invoked, nothing is invoked when it is empty
+		wantMethod string
+	}{
+		{
+			name:       "login",
+			method:     http.MethodPost,
+			path:       "/v1/login",
+			body:       `{"email":"alice@example.com","password":"secret","app_id":1}`,
+			wantStatus: http.StatusOK,
+			wantBody:   map[string]any{"token": "alice@example.com/1"},
+			wantMethod: "/auth.Auth/Login",
+		},
+		{
+			name:       "login with lowerCamelCase",
+			method:     http.MethodPost,
+			path:       "/v1/login",
+			body:       `{"email":"alice@example.com","password":"secret","appId":2}`,
+			wantStatus: http.StatusOK,
+			wantBody:   map[string]any{"token": "alice@example.com/2"},
+			wantMethod: "/auth.Auth/Login",
+		},
+		{
+			name:   "register",
+			method: http.MethodPost,
+			path:   "/v1/register",
+			body: `{"email":"carol@example.com","password":"Quintus.Aurelius.77","date_of_birth":"1992-03-04",
+				"full_name":"Carol","phone_number":"+14155552671","telegram_name":"carol_tg"}`,
+			wantStatus: http.StatusOK,
+			// int64 fields are strings in the proto3 JSON mapping
+			wantBody:   map[string]any{"user_id": "7"},
+			wantMethod: "/auth.Auth/Register",
+		},
+		{
+			name:   "invalid argument with details",
+			method: http.MethodPost,
+			path:   "/v1/register",
+			body: `{"email":"carol","password":"Quintus.Aurelius.77","date_of_birth":"1992-03-04",
+				"full_name":"Carol","phone_number":"+14155552671","telegram_name":"carol_tg"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody: map[string]any{
+				"code":    3.0,
+				"status":  "InvalidArgument",
+				"message": "invalid request",
+				"details": []any{map[string]any{
+					"@type": "type.googleapis.com/google.rpc.BadRequest",
+					"field_violations": []any{map[string]any{
+						"field":       "email",
+						"description": "must be a valid email address",
+					}},
+				}},
+			},
+			wantMethod: "/auth.Auth/Register",
+		},
+		{
+			name:       "invalid json",
+			method:     http.MethodPost,
+			path:       "/v1/login",
+			body:       `{"email":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown route",
+			method:     http.MethodPost,
+			path:       "/v1/unknown",
+			wantStatus: http.StatusNotFound,
+			wantBody:   map[string]any{"code": 5.0, "status": "NotFound", "message": "unknown path"},
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			path:       "/v1/login",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantBody:   map[string]any{"code": 12.0, "status": "Unimplemented", "message": "method not allowed, use POST"},
+		},
+		{
+			name:       "forwarded headers",
+			method:     http.MethodPost,
+			path:       "/v1/login",
+			body:       `{"email":"alice@example.com","password":"secret","app_id":1}`,
+			header:     http.Header{"Authorization": {"Bearer token"}, "X-Request-Id": {"req-42"}, "Cookie": {"a=b"}},
+			wantStatus: http.StatusOK,
+			wantBody:   map[string]any{"token": "alice@example.com/1"},
+			wantMethod: "/auth.Auth/Login",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, calls := newTestHandler(t)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			if tt.method != http.MethodPost {
+				if allow := rec.Header().Get("Allow"); allow != http.MethodPost {
+					t.Errorf("Allow = %q, want POST", allow)
+				}
+			}
+
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %s: %v", rec.Body, err)
+			}
+			if tt.wantBody != nil && !reflect.DeepEqual(body, tt.wantBody) {
+				t.Errorf("body = %v, want %v", body, tt.wantBody)
+			}
+
+			if tt.wantMethod == "" {
+				if len(*calls) != 0 {
+					t.Errorf("invoked %v, want nothing", *calls)
+				}
+				return
+			}
+			if len(*calls) != 1 || (*calls)[0].method != tt.wantMethod {
+				t.Fatalf("invoked %v, want %s", *calls, tt.wantMethod)
+			}
+			md := (*calls)[0].md
+			for key, values := range tt.header {
+				key = strings.ToLower(key)
+				want := values
+				if key == "cookie" {
+					// only the forwarded headers become metadata
+					want = nil
+				}
+				if got := md.Get(key); !reflect.DeepEqual(got, want) {
+					t.Errorf("metadata %s = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
@@ -1,33 +1,145 @@
 package grpcapp
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"log/slog"
 	"net"
 	authgrpc "sso/sso/cmd/inter/grpc/auth"
+	"sso/sso/cmd/inter/lib/ratelimit"
+	"sso/sso/cmd/inter/lib/validation"
+	"sync/atomic"
+	"time"
 
+	v1 "github.com/Foreground-Eclipse/testprotos/gen/go/sso"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 )
 
 type App struct {
 	log        *slog.Logger
 	gRPCServer *grpc.Server
+	health     *health.Server
+	auth       v1.AuthServer
+	unary      []grpc.UnaryServerInterceptor
 	port       int
+	// limits and deadlines are swapped by SetRateLimits and SetTimeouts while serving
+	limits    atomic.Pointer[rateLimits]
+	deadlines atomic.Pointer[deadlines]
 }
 
-func New(
-	log *slog.Logger,
-	port int,
-	authService authgrpc.Auth,
-) *App {
-	gRPCServer := grpc.NewServer()
+// Deps are the services the grpc server serves.
+type Deps struct {
+	Auth      authgrpc.Auth
+	Validator *validation.Validator
+	Health    *health.Server
+}
+
+// Params configure the grpc server.
+type Params struct {
+	Port int
+	// TLS is nil to serve in plaintext
+	TLS *tls.Config
+	// PrivilegedClients are the certificate names allowed to call the admin methods
+	PrivilegedClients []string
+	Reflection        bool
+	// Timeout is the deadline of the calls, MethodTimeouts override it by full method name
+	Timeout          time.Duration
+	MethodTimeouts   map[string]time.Duration
+	Keepalive        keepalive.ServerParameters
+	KeepalivePolicy  keepalive.EnforcementPolicy
+	RateLimit        ratelimit.Rule
+	MethodRateLimits map[string]ratelimit.Rule
+}
+
+func New(log *slog.Logger, deps Deps, params Params) *App {
+	a := &App{
+		log:    log,
+		health: deps.Health,
+		port:   params.Port,
+	}
+
+	privileged := make(map[string]bool, len(params.PrivilegedClients))
+	for _, name := range params.PrivilegedClients {
+		privileged[name] = true
+	}
+
+	// the request id comes first so every later line carries it, and the
+	// recovery comes last so the panics are logged and counted as Internal
+	unary := []grpc.UnaryServerInterceptor{
+		requestIDInterceptor(log),
+		accessLogInterceptor(log),
+		metricsInterceptor,
+		recoveryInterceptor(log),
+		rateLimitInterceptor(&a.limits),
+		deadlineInterceptor(&a.deadlines),
+		clientCertInterceptor(privileged),
+		auditClientInterceptor,
+	}
+
+	opts := []grpc.ServerOption{
+		// starts the span of every request, continuing the trace of the caller
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.KeepaliveParams(params.Keepalive),
+		grpc.KeepaliveEnforcementPolicy(params.KeepalivePolicy),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(
+			requestIDStreamInterceptor(log),
+			accessLogStreamInterceptor(log),
+			metricsStreamInterceptor,
+			recoveryStreamInterceptor(log),
+			rateLimitStreamInterceptor(&a.limits),
+			clientCertStreamInterceptor(privileged),
+		),
+	}
+	if params.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(params.TLS)))
+	} else {
+		log.Warn("grpc tls is not configured, requests are sent in plaintext")
+	}
 
-	authgrpc.Register(gRPCServer, authService)
+	a.gRPCServer = grpc.NewServer(opts...)
+	a.auth = authgrpc.NewServer(deps.Auth, deps.Validator)
+	a.unary = unary
 
-	return &App{
-		log:        log,
-		gRPCServer: gRPCServer,
-		port:       port,
+	authgrpc.Register(a.gRPCServer, a.auth)
+	healthpb.RegisterHealthServer(a.gRPCServer, deps.Health)
+	if params.Reflection {
+		// lets grpcurl and the like list the services without the proto files
+		reflection.Register(a.gRPCServer)
+	}
+
+	a.SetTimeouts(params.Timeout, params.MethodTimeouts)
+	a.SetRateLimits(params.RateLimit, params.MethodRateLimits)
+
+	return a
+}
+
+// SetTimeouts replaces the timeouts of the calls started from now on.
+func (a *App) SetTimeouts(timeout time.Duration, methodTimeouts map[string]time.Duration) {
+	warnUnknownMethods(a, "timeout", methodTimeouts)
+	a.deadlines.Store(&deadlines{timeout: timeout, methods: methodTimeouts})
+}
+
+// SetRateLimits replaces the rate limits, the clients start over with full buckets.
+func (a *App) SetRateLimits(rateLimit ratelimit.Rule, methodRateLimits map[string]ratelimit.Rule) {
+	warnUnknownMethods(a, "rate limit", methodRateLimits)
+	a.limits.Store(newRateLimits(rateLimit, methodRateLimits))
+}
+
+// warnUnknownMethods warns about the settings of misspelled methods, they
+// would silently fall back to the defaults
+func warnUnknownMethods[V any](a *App, setting string, methods map[string]V) {
+	for name := range methods {
+		if !hasMethod(a.gRPCServer, name) {
+			a.log.Warn(setting+" is set for an unknown grpc method", slog.String("method", name))
+		}
 	}
 }
 
@@ -59,10 +171,43 @@ func (a *App) Run() error {
 	return nil
 }
 
+func hasMethod(gRPCServer *grpc.Server, name string) bool {
+	for _, service := range gRPCServer.GetServiceInfo() {
+		for _, method := range service.Methods {
+			if method.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AuthServer returns the handlers of the Auth service for the JSON gateway.
+func (a *App) AuthServer() v1.AuthServer {
+	return a.auth
+}
+
+// Invoke runs the handler behind the same interceptors as the gRPC requests,
+// so the calls of the gateway are logged, measured and audited the same way.
+func (a *App) Invoke(ctx context.Context, method string, req any, handler grpc.UnaryHandler) (any, error) {
+	info := &grpc.UnaryServerInfo{Server: a.auth, FullMethod: method}
+
+	for i := len(a.unary) - 1; i >= 0; i-- {
+		interceptor, next := a.unary[i], handler
+		handler = func(ctx context.Context, req any) (any, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+
+	return handler(ctx, req)
+}
+
 func (a *App) Stop() {
 	const op = "grpcapp.Stop"
 
 	a.log.With(slog.String("op", op)).Info("stopping grpc server", slog.Int("port", a.port))
 
+	// callers watching the health move away while the requests in flight drain
+	a.health.Shutdown()
 	a.gRPCServer.GracefulStop()
 }
@@ -0,0 +1,365 @@
+package grpcapp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
+	"path"
+	"runtime/debug"
+	"sso/sso/cmd/inter/lib/identity"
+	"sso/sso/cmd/inter/lib/logctx"
+	"sso/sso/cmd/inter/lib/metrics"
+	"sso/sso/cmd/inter/lib/ratelimit"
+	"sso/sso/cmd/inter/services/audit"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// rateLimits holds a limiter per method, the calls to the other methods share fallback
+type rateLimits struct {
+	fallback *ratelimit.Limiter
+	methods  map[string]*ratelimit.Limiter
+}
+
+func newRateLimits(rule ratelimit.Rule, methodRules map[string]ratelimit.Rule) *rateLimits {
+	limits := &rateLimits{
+		fallback: ratelimit.New(rule),
+		methods:  make(map[string]*ratelimit.Limiter, len(methodRules)),
+	}
+	for method, r := range methodRules {
+		limits.methods[method] = ratelimit.New(r)
+	}
+	return limits
+}
+
+// allow takes a token from the bucket of the address of the caller
+func (l *rateLimits) allow(ctx context.Context, fullMethod string) bool {
+	limiter, ok := l.methods[path.Base(fullMethod)]
+	if !ok {
+		limiter = l.fallback
+	}
+	return limiter.Allow(clientFromContext(ctx).IP)
+}
+
+// rateLimitInterceptor rejects the calls of the clients over their limit with ResourceExhausted.
+func rateLimitInterceptor(limits *atomic.Pointer[rateLimits]) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !limits.Load().allow(ctx, info.FullMethod) {
+			return nil, status.Error(codes.ResourceExhausted, "too many requests")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// rateLimitStreamInterceptor is rateLimitInterceptor for streams.
+func rateLimitStreamInterceptor(limits *atomic.Pointer[rateLimits]) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !limits.Load().allow(ss.Context(), info.FullMethod) {
+			return status.Error(codes.ResourceExhausted, "too many requests")
+		}
+		return handler(srv, ss)
+	}
+}
+
+// deadlines are the timeout of every method, methods override timeout
+type deadlines struct {
+	timeout time.Duration
+	methods map[string]time.Duration
+}
+
+func (d *deadlines) budget(fullMethod string) time.Duration {
+	if t, ok := d.methods[path.Base(fullMethod)]; ok {
+		return t
+	}
+	return d.timeout
+}
+
+// deadlineInterceptor bounds every call with the timeout of its method, the
+// deadline of the caller is kept when it is earlier. The calls cut short are
+// answered with DeadlineExceeded whatever error the handler made of it.
+// Streams are not bounded since WatchUserEvents lasts as long as the client stays.
+func deadlineInterceptor(current *atomic.Pointer[deadlines]) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		budget := current.Load().budget(info.FullMethod)
+		if budget <= 0 {
+			return handler(ctx, req)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, budget)
+		defer cancel()
+
+		resp, err := handler(ctx, req)
+		if err != nil && status.Code(err) != codes.DeadlineExceeded && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, status.Error(codes.DeadlineExceeded, "deadline exceeded")
+		}
+
+		return resp, err
+	}
+}
+
+// metricsInterceptor records the latency and the status code of every request.
+func metricsInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	start := time.Now()
+
+	resp, err := handler(ctx, req)
+	metrics.ObserveRPC(info.FullMethod, status.Code(err).String(), time.Since(start))
+
+	return resp, err
+}
+
+// metricsStreamInterceptor records streams like metricsInterceptor, their
+// latency is how long the stream was open.
+func metricsStreamInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	start := time.Now()
+
+	err := handler(srv, ss)
+	metrics.ObserveRPC(info.FullMethod, status.Code(err).String(), time.Since(start))
+
+	return err
+}
+
+// auditClientInterceptor stores the address and the user agent of the caller
+// for the audit log.
+func auditClientInterceptor(
+	ctx context.Context,
+	req any,
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	return handler(audit.WithClient(ctx, clientFromContext(ctx)), req)
+}
+
+func clientFromContext(ctx context.Context) audit.Client {
+	var client audit.Client
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		client.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(client.IP); err == nil {
+			client.IP = host
+		}
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ua := md.Get("user-agent"); len(ua) > 0 {
+			client.UserAgent = ua[0]
+		}
+	}
+
+	return client
+}
+
+const (
+	requestIDKey       = "x-request-id"
+	maxRequestIDLength = 128
+)
+
+// requestIDInterceptor takes the request id from the metadata of the caller
+// or generates one, sends it back in the response headers and adds it to the
+// logger of the request.
+func requestIDInterceptor(log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, id := withRequestID(ctx, log)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+
+		return handler(ctx, req)
+	}
+}
+
+// requestIDStreamInterceptor is requestIDInterceptor for streams.
+func requestIDStreamInterceptor(log *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, id := withRequestID(ss.Context(), log)
+		_ = ss.SetHeader(metadata.Pairs(requestIDKey, id))
+
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func withRequestID(ctx context.Context, log *slog.Logger) (context.Context, string) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDKey); len(ids) > 0 && validRequestID(ids[0]) {
+			id = ids[0]
+		}
+	}
+	if id == "" {
+		id = newRequestID()
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("request_id", id))
+
+	return logctx.With(ctx, log.With(slog.String("request_id", id))), id
+}
+
+// validRequestID keeps ids of the callers short and printable since they end up in the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// the id only correlates log lines, a time based one will do
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// accessLogInterceptor writes one line per request after it is handled.
+func accessLogInterceptor(log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+		logAccess(ctx, log, info.FullMethod, start, err)
+
+		return resp, err
+	}
+}
+
+// accessLogStreamInterceptor is accessLogInterceptor for streams, the line is
+// written when the stream is closed.
+func accessLogStreamInterceptor(log *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+
+		err := handler(srv, ss)
+		logAccess(ss.Context(), log, info.FullMethod, start, err)
+
+		return err
+	}
+}
+
+func logAccess(ctx context.Context, log *slog.Logger, method string, start time.Time, err error) {
+	code := status.Code(err)
+
+	level := slog.LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		level = slog.LevelError
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("peer", clientFromContext(ctx).IP),
+		slog.Duration("duration", time.Since(start)),
+		slog.String("code", code.String()),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+	}
+
+	logctx.From(ctx, log).LogAttrs(ctx, level, "grpc call", attrs...)
+}
+
+// recoveryInterceptor turns a panic of the handler into an Internal error,
+// so it fails only the request instead of the whole server.
+func recoveryInterceptor(log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ctx, log, info.FullMethod, r)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// recoveryStreamInterceptor is recoveryInterceptor for streams.
+func recoveryStreamInterceptor(log *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ss.Context(), log, info.FullMethod, r)
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+func recovered(ctx context.Context, log *slog.Logger, method string, r any) error {
+	logctx.From(ctx, log).Error("panic in grpc handler",
+		slog.String("method", method),
+		slog.Any("panic", r),
+		slog.String("stack", string(debug.Stack())),
+	)
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+// contextStream replaces the context of the stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// clientCertInterceptor stores the identity of a caller that presented a
+// verified client certificate, privileged are the names trusted as admins.
+func clientCertInterceptor(privileged map[string]bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(withClientCert(ctx, privileged), req)
+	}
+}
+
+// clientCertStreamInterceptor is clientCertInterceptor for streams.
+func clientCertStreamInterceptor(privileged map[string]bool) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &contextStream{ServerStream: ss, ctx: withClientCert(ss.Context(), privileged)})
+	}
+}
+
+func withClientCert(ctx context.Context, privileged map[string]bool) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	// only chains verified against the client CAs are trusted
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return ctx
+	}
+
+	name := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+	if name == "" {
+		return ctx
+	}
+
+	return identity.WithService(ctx, identity.Service{Name: name, Privileged: privileged[name]})
+}
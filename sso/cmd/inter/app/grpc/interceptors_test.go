@@ -0,0 +1,214 @@
+package grpcapp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	authgrpc "sso/sso/cmd/inter/grpc/auth"
+	"sync"
+	"testing"
+
+	v1 "github.com/Foreground-Eclipse/testprotos/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const panicEmail = "panic@example.com"
+
+// fakeAuth serves Login, it panics for panicEmail
+type fakeAuth struct {
+	authgrpc.Auth
+}
+
+func (fakeAuth) Login(_ context.Context, email string, _ string, _ int) (string, error) {
+	if email == panicEmail {
+		panic("login exploded")
+	}
+	return "token", nil
+}
+
+// logBuffer is written by the server goroutines and read by the test
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// lines returns the JSON log lines with the message msg
+func (b *logBuffer) lines(t *testing.T, msg string) []map[string]any {
+	t.Helper()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(b.buf.Bytes()))
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("log line %q: %v", scanner.Text(), err)
+		}
+		if line["msg"] == msg {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func (b *logBuffer) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+// newTestClient serves the app over an in-memory listener
+func newTestClient(t *testing.T) (v1.AuthClient, *logBuffer) {
+	t.Helper()
+
+	logs := &logBuffer{}
+	a := New(slog.New(slog.NewJSONHandler(logs, nil)), Deps{
+		Auth:   fakeAuth{},
+		Health: health.NewServer(),
+	}, Params{})
+
+	lis := bufconn.Listen(1 << 20)
+	go func() {
+		_ = a.gRPCServer.Serve(lis)
+	}()
+	t.Cleanup(a.gRPCServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return v1.NewAuthClient(conn), logs
+}
+
+func login(ctx context.Context, client v1.AuthClient, email string) (metadata.MD, error) {
+	var header metadata.MD
+	_, err := client.Login(ctx, &v1.LoginRequest{Email: email, Password: "password", AppId: 1}, grpc.Header(&header))
+	return header, err
+}
+
+func TestRequestID(t *testing.T) {
+	client, logs := newTestClient(t)
+
+	tests := []struct {
+		name string
+		// sent is the id of the caller, none is sent when it is empty
+		sent string
+		// kept tells whether the sent id comes back
+		kept bool
+	}{
+		{name: "sent", sent: "req-42", kept: true},
+		{name: "absent"},
+		{name: "not printable", sent: "req 42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.reset()
+
+			ctx := context.Background()
+			if tt.sent != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, requestIDKey, tt.sent)
+			}
+
+			header, err := login(ctx, client, "alice@example.com")
+			if err != nil {
+				t.Fatalf("Login() error = %v", err)
+			}
+
+			ids := header.Get(requestIDKey)
+			if len(ids) != 1 || ids[0] == "" {
+				t.Fatalf("%s header = %v, want one id", requestIDKey, ids)
+			}
+			if got := ids[0] == tt.sent; got != tt.kept {
+				t.Errorf("%s = %q, sent %q", requestIDKey, ids[0], tt.sent)
+			}
+
+			lines := logs.lines(t, "grpc call")
+			if len(lines) != 1 || lines[0]["request_id"] != ids[0] {
+				t.Errorf("access log = %v, want it to carry %q", lines, ids[0])
+			}
+		})
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	client, logs := newTestClient(t)
+
+	_, err := login(context.Background(), client, panicEmail)
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("Login() error = %v, want %v", err, codes.Internal)
+	}
+	if len(logs.lines(t, "panic in grpc handler")) != 1 {
+		t.Error("the panic is not logged")
+	}
+
+	// the server survives the panic
+	if _, err := login(context.Background(), client, "alice@example.com"); err != nil {
+		t.Fatalf("Login() after the panic error = %v", err)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	client, logs := newTestClient(t)
+
+	tests := []struct {
+		name     string
+		email    string
+		wantCode codes.Code
+	}{
+		{name: "ok", email: "alice@example.com", wantCode: codes.OK},
+		{name: "invalid argument", email: "", wantCode: codes.InvalidArgument},
+		{name: "panic", email: panicEmail, wantCode: codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.reset()
+
+			_, err := login(context.Background(), client, tt.email)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("Login() error = %v, want %v", err, tt.wantCode)
+			}
+
+			lines := logs.lines(t, "grpc call")
+			if len(lines) != 1 {
+				t.Fatalf("%d access log lines, want 1", len(lines))
+			}
+			line := lines[0]
+			if line["method"] != "/auth.Auth/Login" {
+				t.Errorf("method = %v, want /auth.Auth/Login", line["method"])
+			}
+			if peer, _ := line["peer"].(string); peer == "" {
+				t.Error("peer is empty")
+			}
+			if _, ok := line["duration"].(float64); !ok {
+				t.Errorf("duration = %v, want a number", line["duration"])
+			}
+			if line["code"] != tt.wantCode.String() {
+				t.Errorf("code = %v, want %v", line["code"], tt.wantCode)
+			}
+		})
+	}
+}
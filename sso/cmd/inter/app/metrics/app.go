@@ -0,0 +1,78 @@
+package metricsapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sso/sso/cmd/inter/lib/httpserver"
+	"sso/sso/cmd/inter/lib/metrics"
+	"sso/sso/cmd/inter/services/health"
+	"time"
+)
+
+// App serves the prometheus metrics and the HTTP health checks on their own
+// port, so they are not exposed next to the gRPC API
+type App struct {
+	log             *slog.Logger
+	server          *http.Server
+	port            int
+	shutdownTimeout time.Duration
+}
+
+func New(log *slog.Logger, port int, monitor *health.Monitor, params httpserver.Params) *App {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", monitor.Liveness())
+	mux.Handle("/readyz", monitor.Readiness())
+
+	return &App{
+		log:             log,
+		server:          httpserver.New(mux, params),
+		port:            port,
+		shutdownTimeout: params.ShutdownTimeout,
+	}
+}
+
+// MustRun runs the metrics server and panics if any error occurs
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) Run() error {
+	const op = "metricsapp.Run"
+
+	log := a.log.With(slog.String("op", op))
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("metrics server is running", slog.String("addr", l.Addr().String()))
+
+	if err := a.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *App) Stop() {
+	const op = "metricsapp.Stop"
+
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("stopping metrics server", slog.Int("port", a.port))
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
+	defer cancel()
+
+	if err := a.server.Shutdown(ctx); err != nil {
+		log.Error("failed to stop metrics server", slog.String("error", err.Error()))
+	}
+}
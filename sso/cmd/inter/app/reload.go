@@ -0,0 +1,74 @@
+package app
+
+import (
+	"sso/sso/cmd/inter/config"
+	"sso/sso/cmd/inter/lib/ratelimit"
+	"strings"
+)
+
+// hotSettings can be changed by Reload while serving, a change of any other
+// setting takes effect after a restart
+var hotSettings = []string{
+	"log_level",
+	"token_ttl",
+	"grpc.timeout",
+	"grpc.method_timeouts",
+	"rate_limit",
+}
+
+func isHot(setting string) bool {
+	for _, hot := range hotSettings {
+		if setting == hot || strings.HasPrefix(setting, hot+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload swaps the settings of cfg that can change while serving, the calls
+// in flight keep the settings they started with. It returns the settings it
+// applied and the changed ones that need a restart, those are compared with
+// the config the application was started with so they are reported until then.
+func (a *App) Reload(cfg *config.Config) (applied []string, restart []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, setting := range config.Diff(a.current, cfg) {
+		if isHot(setting) {
+			applied = append(applied, setting)
+		}
+	}
+	for _, setting := range config.Diff(a.started, cfg) {
+		if !isHot(setting) {
+			restart = append(restart, setting)
+		}
+	}
+
+	changed := func(prefix string) bool {
+		for _, setting := range applied {
+			if setting == prefix || strings.HasPrefix(setting, prefix+".") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if changed("log_level") {
+		a.level.Set(cfg.Level())
+	}
+	if changed("token_ttl") {
+		a.auth.SetTokenTTL(cfg.TokenTTL)
+	}
+	if changed("grpc.timeout") || changed("grpc.method_timeouts") {
+		a.GRPCSrv.SetTimeouts(cfg.GRPC.Timeout, cfg.GRPC.MethodTimeouts)
+	}
+	if changed("rate_limit") {
+		a.GRPCSrv.SetRateLimits(ratelimit.Rule{Rate: cfg.RateLimit.Rate, Burst: cfg.RateLimit.Burst},
+			methodRateLimits(cfg.RateLimit.Methods),
+		)
+	}
+
+	a.current = cfg
+
+	return applied, restart
+}
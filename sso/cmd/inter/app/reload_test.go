@@ -0,0 +1,194 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sso/sso/cmd/inter/config"
+	"sso/sso/cmd/inter/lib/passhash"
+	"sso/sso/cmd/inter/storage/sqlite"
+	"testing"
+	"time"
+
+	v1 "github.com/Foreground-Eclipse/testprotos/gen/go/sso"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	testEmail    = "alice@example.com"
+	testPassword = "Tarquinius.Blumenfeld"
+)
+
+// newTestApp builds the application over a migrated database with app 1 and
+// the user testEmail, the config is returned to make the reloaded ones
+func newTestApp(t *testing.T) (*App, *config.Config, *slog.LevelVar) {
+	t.Helper()
+
+	dir := t.TempDir()
+	storagePath := filepath.Join(dir, "sso.db")
+	migrate(t, storagePath)
+
+	configPath := filepath.Join(dir, "config.yaml")
+	yaml := fmt.Sprintf(`
+log_level: info
+storage_path: %q
+token_ttl: 1h
+grpc:
+  port: 44044
+smtp:
+  from: "sso@example.com"
+password_hash:
+  bcrypt_cost: 4
+`, storagePath)
+	if err := os.WriteFile(configPath, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.LoadPath(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	level := &slog.LevelVar{}
+	level.Set(cfg.Level())
+
+	a, err := New(slog.New(slog.NewTextHandler(io.Discard, nil)), level, cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	return a, cfg, level
+}
+
+func migrate(t *testing.T, path string) {
+	t.Helper()
+
+	base, err := os.ReadFile(filepath.Join("..", "storage", "sqlite", "testdata", "base.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(string(base)); err != nil {
+		t.Fatalf("create base schema: %v", err)
+	}
+
+	ctx := context.Background()
+	st, err := sqlite.New(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := st.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	hasher, err := passhash.New(passhash.Params{Algorithm: passhash.AlgorithmBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := hasher.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.SaveUser(ctx, hash, testEmail, "1990-01-02", "Alice", "+15550100", "alice_tg"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tokenTTL logs in and returns how long the issued token is valid
+func tokenTTL(t *testing.T, a *App) time.Duration {
+	t.Helper()
+
+	resp, err := a.GRPCSrv.AuthServer().Login(context.Background(), &v1.LoginRequest{
+		Email:    testEmail,
+		Password: testPassword,
+		AppId:    1,
+	})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	token, _, err := jwt.NewParser().ParseUnverified(resp.GetToken(), jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := token.Claims.GetExpirationTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return time.Until(exp.Time).Round(time.Minute)
+}
+
+// limited calls a method until the rate limit rejects it, it reports
+// whether that happens within calls
+func limited(t *testing.T, a *App, calls int) bool {
+	t.Helper()
+
+	method := "/" + v1.Auth_ServiceDesc.ServiceName + "/Login"
+	for i := 0; i < calls; i++ {
+		_, err := a.GRPCSrv.Invoke(context.Background(), method, nil, func(context.Context, any) (any, error) {
+			return nil, nil
+		})
+		if status.Code(err) == codes.ResourceExhausted {
+			return true
+		}
+		if err != nil {
+			t.Fatalf("Invoke() error = %v", err)
+		}
+	}
+	return false
+}
+
+func TestReload(t *testing.T) {
+	a, started, level := newTestApp(t)
+
+	if got := tokenTTL(t, a); got != time.Hour {
+		t.Fatalf("token ttl = %v, want 1h before the reload", got)
+	}
+	if limited(t, a, 50) {
+		t.Fatal("calls are limited before the reload")
+	}
+
+	cfg := *started
+	cfg.LogLevel = "warn"
+	cfg.TokenTTL = 2 * time.Hour
+	cfg.RateLimit = config.RateLimitConfig{Rate: 0.001, Burst: 2}
+	cfg.GRPC.Port = 44045
+
+	applied, restart := a.Reload(&cfg)
+
+	wantApplied := []string{"log_level", "token_ttl", "rate_limit.rate", "rate_limit.burst"}
+	if !reflect.DeepEqual(applied, wantApplied) {
+		t.Errorf("applied = %v, want %v", applied, wantApplied)
+	}
+	if !reflect.DeepEqual(restart, []string{"grpc.port"}) {
+		t.Errorf("restart = %v, want [grpc.port]", restart)
+	}
+
+	if level.Level() != slog.LevelWarn {
+		t.Errorf("level = %v, want %v", level.Level(), slog.LevelWarn)
+	}
+	if got := tokenTTL(t, a); got != 2*time.Hour {
+		t.Errorf("token ttl = %v, want 2h", got)
+	}
+	if !limited(t, a, 3) {
+		t.Error("calls are not limited after the reload")
+	}
+
+	// the port is not applied, so it is reported until the restart
+	again := cfg
+	applied, restart = a.Reload(&again)
+	if len(applied) != 0 || !reflect.DeepEqual(restart, []string{"grpc.port"}) {
+		t.Errorf("Reload() of the same config = %v, %v, want nothing applied and [grpc.port]", applied, restart)
+	}
+}
@@ -0,0 +1,256 @@
+package telegramapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/services/auth"
+	"sso/sso/cmd/inter/services/telegram"
+	"sso/sso/cmd/inter/storage"
+	"strings"
+	"sync/atomic"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const verifyCallback = "verify_me"
+
+type TelegramProvider interface {
+	ConfirmAccountTG(ctx context.Context, telegramName string, chatID int64) (bool, error)
+	RebindTelegram(ctx context.Context, telegramName string, chatID int64, code string) error
+}
+
+type AccountProvider interface {
+	UserByTelegramChat(ctx context.Context, chatID int64) (models.User, error)
+	ContactVerifications(ctx context.Context, userID int64) ([]models.ContactVerification, error)
+	Sessions(ctx context.Context, userID int64) ([]models.Session, error)
+	RevokeSessions(ctx context.Context, userID int64) (int64, error)
+	StartPasswordReset(ctx context.Context, userID int64) (string, error)
+	ResendLoginApprovals(ctx context.Context, chatID int64) (int, error)
+	DecideLogin(ctx context.Context, chatID int64, approvalID string, approve bool) error
+}
+
+type App struct {
+	log              *slog.Logger
+	client           telegram.Client
+	sender           *telegram.Sender
+	telegramProvider TelegramProvider
+	accountProvider  AccountProvider
+	timeout          int
+	running          atomic.Bool
+}
+
+// New returns a new instance of the telegram bot
+func New(
+	log *slog.Logger,
+	client telegram.Client,
+	sender *telegram.Sender,
+	telegramProvider TelegramProvider,
+	accountProvider AccountProvider,
+	timeout int,
+) *App {
+	return &App{
+		log:              log,
+		client:           client,
+		sender:           sender,
+		telegramProvider: telegramProvider,
+		accountProvider:  accountProvider,
+		timeout:          timeout,
+	}
+}
+
+// Run receives updates until ctx is cancelled.
+func (a *App) Run(ctx context.Context) error {
+	const op = "telegramapp.Run"
+
+	log := a.log.With(slog.String("op", op))
+
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = a.timeout
+
+	updates, err := a.client.GetUpdatesChan(u)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.running.Store(true)
+	defer a.running.Store(false)
+
+	log.Info("telegram bot is running")
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.client.StopReceivingUpdates()
+			log.Info("telegram bot stopped")
+
+			return nil
+		case update, ok := <-updates:
+			if !ok {
+				return nil
+			}
+
+			a.handleUpdate(ctx, update)
+		}
+	}
+}
+
+// Check returns an error if the bot is not receiving updates.
+func (a *App) Check(_ context.Context) error {
+	if !a.running.Load() {
+		return errors.New("telegram bot is not receiving updates")
+	}
+	return nil
+}
+
+func (a *App) handleUpdate(ctx context.Context, update tgbotapi.Update) {
+	switch {
+	case update.CallbackQuery != nil:
+		a.handleCallback(ctx, update.CallbackQuery)
+	case update.Message != nil:
+		a.handleMessage(ctx, update.Message)
+	}
+}
+
+func (a *App) handleCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	switch {
+	case query.Data == verifyCallback:
+		a.handleVerify(ctx, query)
+	case strings.HasPrefix(query.Data, telegram.LoginApproveCallback):
+		a.handleLoginDecision(ctx, query, strings.TrimPrefix(query.Data, telegram.LoginApproveCallback), true)
+	case strings.HasPrefix(query.Data, telegram.LoginDenyCallback):
+		a.handleLoginDecision(ctx, query, strings.TrimPrefix(query.Data, telegram.LoginDenyCallback), false)
+	default:
+		a.log.Debug("ignoring unknown callback", slog.String("data", query.Data))
+	}
+}
+
+func (a *App) handleLoginDecision(ctx context.Context, query *tgbotapi.CallbackQuery, approvalID string, approve bool) {
+	const op = "telegramapp.handleLoginDecision"
+
+	log := a.log.With(slog.String("op", op))
+
+	if err := a.sender.AnswerCallback(ctx, tgbotapi.NewCallback(query.ID, "")); err != nil {
+		log.Error("failed to answer callback", slog.String("error", err.Error()))
+	}
+
+	chatID, ok := privateChat(query)
+	if !ok {
+		if query.Message != nil {
+			a.reply(ctx, query.Message.Chat.ID, textPrivateOnly)
+		}
+		return
+	}
+
+	responseText := "Login denied"
+	if approve {
+		responseText = "Login approved"
+	}
+
+	err := a.accountProvider.DecideLogin(ctx, chatID, approvalID, approve)
+	switch {
+	case errors.Is(err, auth.ErrLoginApprovalNotFound):
+		responseText = "This login request has expired or was already answered"
+	case errors.Is(err, storage.ErrUserNotFound):
+		responseText = textNotLinked
+	case err != nil:
+		log.Error("failed to decide login", slog.String("error", err.Error()))
+		responseText = textInternalError
+	}
+
+	a.reply(ctx, chatID, responseText)
+}
+
+func (a *App) handleVerify(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	const op = "telegramapp.handleVerify"
+
+	log := a.log.With(slog.String("op", op))
+
+	if err := a.sender.AnswerCallback(ctx, tgbotapi.NewCallback(query.ID, query.Data)); err != nil {
+		log.Error("failed to answer callback", slog.String("error", err.Error()))
+	}
+
+	// only the private chat with the user can be bound, a group chat would
+	// send the login approvals to everyone in it
+	chatID, ok := privateChat(query)
+	if !ok {
+		if query.Message != nil {
+			a.reply(ctx, query.Message.Chat.ID, textPrivateOnly)
+		}
+		return
+	}
+
+	var responseText string
+	confirmed, err := a.telegramProvider.ConfirmAccountTG(ctx, query.From.UserName, chatID)
+	switch {
+	case errors.Is(err, storage.ErrUserNotFound):
+		responseText = "You aren't registered yet"
+	case errors.Is(err, auth.ErrTelegramRebindRequired):
+		responseText = textRebindRequired
+	case errors.Is(err, auth.ErrTelegramChatTaken):
+		responseText = textChatTaken
+	case err != nil:
+		log.Error("failed to confirm account", slog.String("error", err.Error()))
+		responseText = textInternalError
+	case confirmed:
+		responseText = "You are now verified"
+	default:
+		responseText = "You already verified"
+	}
+
+	a.reply(ctx, chatID, responseText)
+}
+
+// privateChat returns the chat of the callback if it is the private chat with
+// the user who pressed the button
+func privateChat(query *tgbotapi.CallbackQuery) (int64, bool) {
+	if query.From == nil || query.Message == nil || query.Message.Chat == nil {
+		return 0, false
+	}
+
+	chat := query.Message.Chat
+	if !chat.IsPrivate() || chat.ID == 0 || chat.ID != int64(query.From.ID) {
+		return 0, false
+	}
+
+	return chat.ID, true
+}
+
+func (a *App) handleMessage(ctx context.Context, message *tgbotapi.Message) {
+	// the chat isn't bound yet when the account is moved to it
+	if message.IsCommand() && message.Command() == commandRebind {
+		a.reply(ctx, message.Chat.ID, a.rebind(ctx, message))
+		return
+	}
+
+	if message.IsCommand() && message.Command() != "start" {
+		a.reply(ctx, message.Chat.ID, a.handleCommand(ctx, message))
+		return
+	}
+
+	a.sendVerifyButton(ctx, message.Chat.ID)
+}
+
+func (a *App) sendVerifyButton(ctx context.Context, chatID int64) {
+	const op = "telegramapp.sendVerifyButton"
+
+	msg := tgbotapi.NewMessage(chatID, "Press the button to get your verification code")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Verify me 🔥", verifyCallback),
+		),
+	)
+	if err := a.sender.Send(ctx, msg); err != nil {
+		a.log.With(slog.String("op", op)).Error("failed to send message", slog.String("error", err.Error()))
+	}
+}
+
+func (a *App) reply(ctx context.Context, chatID int64, text string) {
+	const op = "telegramapp.reply"
+
+	if err := a.sender.Send(ctx, tgbotapi.NewMessage(chatID, text)); err != nil {
+		a.log.With(slog.String("op", op)).Error("failed to send message", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,175 @@
+package telegramapp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/services/auth"
+	"sso/sso/cmd/inter/services/telegram"
+	"sso/sso/cmd/inter/storage"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// fakeClient fails the first failures messages and records the rest
+type fakeClient struct {
+	failures int
+	calls    int
+	sent     []tgbotapi.MessageConfig
+}
+
+func (c *fakeClient) GetUpdatesChan(tgbotapi.UpdateConfig) (tgbotapi.UpdatesChannel, error) {
+	return make(chan tgbotapi.Update), nil
+}
+
+func (c *fakeClient) StopReceivingUpdates() {}
+
+func (c *fakeClient) Send(msg tgbotapi.Chattable) (tgbotapi.Message, error) {
+	c.calls++
+	if c.calls <= c.failures {
+		return tgbotapi.Message{}, errors.New("telegram is down")
+	}
+
+	c.sent = append(c.sent, msg.(tgbotapi.MessageConfig))
+	return tgbotapi.Message{}, nil
+}
+
+func (c *fakeClient) AnswerCallbackQuery(tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error) {
+	return tgbotapi.APIResponse{Ok: true}, nil
+}
+
+// fakeTelegramProvider binds the telegram names it knows
+type fakeTelegramProvider struct {
+	confirmed bool
+	err       error
+	// bound is the name and chat of the last bind
+	boundName string
+	boundChat int64
+}
+
+func (p *fakeTelegramProvider) ConfirmAccountTG(_ context.Context, telegramName string, chatID int64) (bool, error) {
+	p.boundName, p.boundChat = telegramName, chatID
+	return p.confirmed, p.err
+}
+
+func (p *fakeTelegramProvider) RebindTelegram(context.Context, string, int64, string) error {
+	return p.err
+}
+
+// fakeAccountProvider knows the users bound to the chats, the other methods
+// aren't used by the tests
+type fakeAccountProvider struct {
+	AccountProvider
+	users map[int64]models.User
+}
+
+func (p *fakeAccountProvider) UserByTelegramChat(_ context.Context, chatID int64) (models.User, error) {
+	user, ok := p.users[chatID]
+	if !ok {
+		return models.User{}, storage.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (p *fakeAccountProvider) Sessions(context.Context, int64) ([]models.Session, error) {
+	return nil, nil
+}
+
+func newTestApp(client *fakeClient, telegramProvider TelegramProvider, accountProvider AccountProvider) *App {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sender := telegram.New(log, client, 2, 0)
+
+	return New(log, client, sender, telegramProvider, accountProvider, 1)
+}
+
+func verifyUpdate(userName string, chat *tgbotapi.Chat) tgbotapi.Update {
+	return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "query",
+		From:    &tgbotapi.User{ID: 7, UserName: userName},
+		Message: &tgbotapi.Message{Chat: chat},
+		Data:    verifyCallback,
+	}}
+}
+
+func TestHandleVerify(t *testing.T) {
+	private := &tgbotapi.Chat{ID: 7, Type: "private"}
+
+	tests := []struct {
+		name      string
+		chat      *tgbotapi.Chat
+		confirmed bool
+		err       error
+		// failures of telegram before the reply goes through
+		failures  int
+		wantBound bool
+		wantText  string
+	}{
+		{name: "bound", chat: private, confirmed: true, wantBound: true, wantText: "You are now verified"},
+		{name: "already verified", chat: private, wantBound: true, wantText: "You already verified"},
+		{name: "unknown user", chat: private, err: storage.ErrUserNotFound, wantBound: true, wantText: "You aren't registered yet"},
+		{name: "bound to another chat", chat: private, err: auth.ErrTelegramRebindRequired, wantBound: true, wantText: textRebindRequired},
+		{name: "chat of another user", chat: private, err: auth.ErrTelegramChatTaken, wantBound: true, wantText: textChatTaken},
+		{name: "storage failure", chat: private, err: errors.New("disk is full"), wantBound: true, wantText: textInternalError},
+		{name: "group chat", chat: &tgbotapi.Chat{ID: -100, Type: "group"}, wantText: textPrivateOnly},
+		{name: "reply retried", chat: private, confirmed: true, failures: 1, wantBound: true, wantText: "You are now verified"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{failures: tt.failures}
+			provider := &fakeTelegramProvider{confirmed: tt.confirmed, err: tt.err}
+			a := newTestApp(client, provider, &fakeAccountProvider{})
+
+			a.handleUpdate(context.Background(), verifyUpdate("alice_tg", tt.chat))
+
+			if tt.wantBound != (provider.boundName != "") {
+				t.Fatalf("bind called = %v, want %v", provider.boundName != "", tt.wantBound)
+			}
+			if tt.wantBound && (provider.boundName != "alice_tg" || provider.boundChat != tt.chat.ID) {
+				t.Errorf("bound %q to chat %d, want alice_tg to %d", provider.boundName, provider.boundChat, tt.chat.ID)
+			}
+
+			if len(client.sent) != 1 {
+				t.Fatalf("sent %d messages, want 1", len(client.sent))
+			}
+			if got := client.sent[0]; got.ChatID != tt.chat.ID || got.Text != tt.wantText {
+				t.Errorf("replied %q to chat %d, want %q to %d", got.Text, got.ChatID, tt.wantText, tt.chat.ID)
+			}
+		})
+	}
+}
+
+func TestHandleCommandNeedsBoundChat(t *testing.T) {
+	command := func(chatID int64) tgbotapi.Update {
+		return tgbotapi.Update{Message: &tgbotapi.Message{
+			From:     &tgbotapi.User{ID: int(chatID)},
+			Chat:     &tgbotapi.Chat{ID: chatID, Type: "private"},
+			Text:     "/sessions",
+			Entities: &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 9}},
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		chatID   int64
+		wantText string
+	}{
+		{name: "bound chat", chatID: 7, wantText: "You have no active sessions"},
+		{name: "unknown chat", chatID: 8, wantText: textNotLinked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{}
+			accounts := &fakeAccountProvider{users: map[int64]models.User{7: {ID: 1}}}
+			a := newTestApp(client, &fakeTelegramProvider{}, accounts)
+
+			a.handleUpdate(context.Background(), command(tt.chatID))
+
+			if len(client.sent) != 1 || client.sent[0].Text != tt.wantText {
+				t.Fatalf("replied %+v, want %q", client.sent, tt.wantText)
+			}
+		})
+	}
+}
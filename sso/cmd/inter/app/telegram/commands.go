@@ -0,0 +1,183 @@
+package telegramapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/sso/cmd/inter/services/auth"
+	"sso/sso/cmd/inter/storage"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	commandStatus        = "status"
+	commandSessions      = "sessions"
+	commandLogoutAll     = "logout_all"
+	commandResetPassword = "reset_password"
+	command2FA           = "2fa"
+	commandRebind        = "rebind"
+)
+
+const (
+	textNotLinked     = "This chat isn't linked to any account yet, press the button first"
+	textInternalError = "Something went wrong, please try again later"
+	textPrivateOnly   = "Please press the button in the private chat with the bot"
+
+	textRebindRequired = "Your account is linked to another chat. We've sent a code to that chat and to your email, " +
+		"send /rebind <code> here to move the account to this chat"
+	textChatTaken = "This chat is already linked to another account"
+)
+
+// handleCommand runs the account command for the user bound to the chat and
+// returns the text to reply with.
+func (a *App) handleCommand(ctx context.Context, message *tgbotapi.Message) string {
+	const op = "telegramapp.handleCommand"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("command", message.Command()),
+		slog.Int64("chat_id", message.Chat.ID),
+	)
+
+	if !message.Chat.IsPrivate() {
+		return textNotLinked
+	}
+
+	user, err := a.accountProvider.UserByTelegramChat(ctx, message.Chat.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return textNotLinked
+		}
+
+		log.Error("failed to get the user", slog.String("error", err.Error()))
+		return textInternalError
+	}
+
+	log = log.With(slog.Int64("user_id", user.ID))
+
+	var text string
+	switch message.Command() {
+	case commandStatus:
+		text, err = a.status(ctx, user.ID)
+	case commandSessions:
+		text, err = a.sessions(ctx, user.ID)
+	case commandLogoutAll:
+		text, err = a.logoutAll(ctx, user.ID)
+	case commandResetPassword:
+		text, err = a.resetPassword(ctx, user.ID)
+	case command2FA:
+		text, err = a.pendingLogins(ctx, message.Chat.ID)
+	default:
+		text = "Unknown command. Available commands: /status, /sessions, /logout_all, /reset_password, /2fa"
+	}
+	if err != nil {
+		log.Error("command failed", slog.String("error", err.Error()))
+		return textInternalError
+	}
+
+	return text
+}
+
+// rebind moves the account of the sender to this chat with the code sent to
+// the previously bound chat and the email
+func (a *App) rebind(ctx context.Context, message *tgbotapi.Message) string {
+	const op = "telegramapp.rebind"
+
+	if !message.Chat.IsPrivate() || message.From == nil || message.Chat.ID != int64(message.From.ID) {
+		return textPrivateOnly
+	}
+
+	code := strings.TrimSpace(message.CommandArguments())
+	if code == "" {
+		return "Send the code with the command: /rebind <code>"
+	}
+
+	err := a.telegramProvider.RebindTelegram(ctx, message.From.UserName, message.Chat.ID, code)
+	switch {
+	case errors.Is(err, auth.ErrInvalidCode):
+		return "The code is invalid or expired"
+	case errors.Is(err, auth.ErrTelegramChatTaken):
+		return textChatTaken
+	case err != nil:
+		a.log.With(slog.String("op", op), slog.Int64("chat_id", message.Chat.ID)).
+			Error("failed to rebind the chat", slog.String("error", err.Error()))
+		return textInternalError
+	}
+
+	return "Your account is now linked to this chat"
+}
+
+func (a *App) status(ctx context.Context, userID int64) (string, error) {
+	verifications, err := a.accountProvider.ContactVerifications(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("Verification status:\n")
+	for _, v := range verifications {
+		if v.IsVerified {
+			fmt.Fprintf(&b, "%s: verified ✅\n", v.Channel)
+		} else {
+			fmt.Fprintf(&b, "%s: not verified\n", v.Channel)
+		}
+	}
+
+	return b.String(), nil
+}
+
+func (a *App) sessions(ctx context.Context, userID int64) (string, error) {
+	sessions, err := a.accountProvider.Sessions(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sessions) == 0 {
+		return "You have no active sessions", nil
+	}
+
+	var b strings.Builder
+	b.WriteString("Active sessions:\n")
+	for _, session := range sessions {
+		fmt.Fprintf(&b, "#%d app %d, started %s\n",
+			session.ID, session.AppID, session.CreatedAt.Format("2006-01-02 15:04 MST"))
+	}
+
+	return b.String(), nil
+}
+
+func (a *App) logoutAll(ctx context.Context, userID int64) (string, error) {
+	revoked, err := a.accountProvider.RevokeSessions(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Logged out of %d session(s)", revoked), nil
+}
+
+func (a *App) resetPassword(ctx context.Context, userID int64) (string, error) {
+	code, err := a.accountProvider.StartPasswordReset(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Your password reset code is %s, it expires soon. "+
+		"If you didn't ask for it, just ignore this message", code), nil
+}
+
+// pendingLogins sends every pending login request with its own approve and deny
+// buttons, so the user answers the login they actually started
+func (a *App) pendingLogins(ctx context.Context, chatID int64) (string, error) {
+	sent, err := a.accountProvider.ResendLoginApprovals(ctx, chatID)
+	if err != nil {
+		return "", err
+	}
+
+	if sent == 0 {
+		return "You have no pending login requests", nil
+	}
+	return fmt.Sprintf("You have %d pending login request(s), answer each of them above", sent), nil
+}
@@ -1,46 +1,404 @@
 package config
 
 import (
+	"encoding/base64"
+	"errors"
 	"flag"
+	"fmt"
+	"log/slog"
 	"os"
+	"sso/sso/cmd/inter/lib/passhash"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+// Config is read from the yaml file, the values with an env tag can be
+// overridden by the environment.
 type Config struct {
-	Env         string        `yaml:"env" env-default:"local"`
-	StoragePath string        `yaml:"storage_path" env-required:"true"`
-	TokenTTL    time.Duration `yaml:"token_ttl" env-required:"true"`
-	GRPC        GRPCConfig    `yaml:"grpc"`
+	Env             string                `yaml:"env" env:"ENV" env-default:"local"`
+	LogLevel        string                `yaml:"log_level" env:"LOG_LEVEL"`
+	StoragePath     string                `yaml:"storage_path" env:"STORAGE_PATH" env-required:"true"`
+	TokenTTL        time.Duration         `yaml:"token_ttl" env:"TOKEN_TTL" env-required:"true"`
+	GRPC            GRPCConfig            `yaml:"grpc"`
+	HTTP            HTTPConfig            `yaml:"http"`
+	Metrics         MetricsConfig         `yaml:"metrics"`
+	Gateway         GatewayConfig         `yaml:"gateway"`
+	SMTP            SMTPConfig            `yaml:"smtp"`
+	Signing         SigningConfig         `yaml:"signing"`
+	RateLimit       RateLimitConfig       `yaml:"rate_limit"`
+	Tracing         TracingConfig         `yaml:"tracing"`
+	Health          HealthConfig          `yaml:"health"`
+	Telegram        TelegramConfig        `yaml:"telegram"`
+	Passwordless    PasswordlessConfig    `yaml:"passwordless"`
+	SMS             SMSConfig             `yaml:"sms"`
+	Validation      ValidationConfig      `yaml:"validation"`
+	Breach          BreachConfig          `yaml:"breach"`
+	PasswordHash    PasswordHashConfig    `yaml:"password_hash"`
+	Registration    RegistrationConfig    `yaml:"registration"`
+	Audit           AuditConfig           `yaml:"audit"`
+	Webhook         WebhookConfig         `yaml:"webhook"`
+	AccountDeletion AccountDeletionConfig `yaml:"account_deletion"`
+	Encryption      EncryptionConfig      `yaml:"encryption"`
+	Codes           CodesConfig           `yaml:"codes"`
 }
 
 type GRPCConfig struct {
-	Port    int           `yaml:"port"`
-	Timeout time.Duration `yaml:"timeout"`
+	Port int `yaml:"port" env:"GRPC_PORT"`
+	// Timeout bounds every unary call, a shorter deadline of the caller is kept, 0 disables it
+	Timeout time.Duration `yaml:"timeout" env:"GRPC_TIMEOUT"`
+	// MethodTimeouts override Timeout per method, keyed by the method name like Login
+	MethodTimeouts map[string]time.Duration `yaml:"method_timeouts"`
+	Keepalive      KeepaliveConfig          `yaml:"keepalive"`
+	TLS            TLSConfig                `yaml:"tls"`
+	// Reflection lets grpcurl and the like discover the services, keep it off in prod
+	Reflection bool `yaml:"reflection" env-default:"false"`
 }
 
-// MustLoad panics and doesnt return any error if theres any it will just panic.
-func MustLoad() *Config {
-	path := fetchConfigPath()
+// KeepaliveConfig detects dead connections and recycles the old ones, so clients rebalance across instances.
+type KeepaliveConfig struct {
+	// Time is how long a connection may be quiet before the server pings the client
+	Time time.Duration `yaml:"time" env-default:"2h"`
+	// Timeout is how long the server waits for the answer to a ping before closing the connection
+	Timeout time.Duration `yaml:"timeout" env-default:"20s"`
+	// MinTime is how often clients may ping, the ones pinging more often are disconnected
+	MinTime time.Duration `yaml:"min_time" env-default:"5m"`
+	// PermitWithoutStream lets clients ping while they have no calls in flight
+	PermitWithoutStream bool `yaml:"permit_without_stream" env-default:"false"`
+	// MaxConnectionIdle closes connections without calls for that long, 0 keeps them open
+	MaxConnectionIdle time.Duration `yaml:"max_connection_idle"`
+	// MaxConnectionAge closes connections that are open for that long, 0 keeps them open
+	MaxConnectionAge time.Duration `yaml:"max_connection_age"`
+	// MaxConnectionAgeGrace is how long the calls in flight have to finish after MaxConnectionAge
+	MaxConnectionAgeGrace time.Duration `yaml:"max_connection_age_grace"`
+}
+
+// TLSConfig encrypts the gRPC listener, it serves plaintext when CertFile is empty.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file" env:"GRPC_TLS_CERT_FILE"`
+	KeyFile  string `yaml:"key_file" env:"GRPC_TLS_KEY_FILE"`
+	// ClientCAFile enables mutual TLS, clients must present a certificate signed by one of its CAs
+	ClientCAFile string `yaml:"client_ca_file" env:"GRPC_TLS_CLIENT_CA_FILE"`
+	// ClientCertOptional lets clients without a certificate in, the ones sent are still verified
+	ClientCertOptional bool `yaml:"client_cert_optional" env-default:"false"`
+	// PrivilegedClients are the common names of the client certificates that
+	// may call the admin methods without a user token
+	PrivilegedClients []string `yaml:"privileged_clients"`
+	// ReloadInterval is how often the files are checked for changes
+	ReloadInterval time.Duration `yaml:"reload_interval" env-default:"30s"`
+}
+
+// GatewayConfig serves the Auth service as JSON over HTTP, with the certificate
+// of grpc.tls when it is set. Plain HTTP is only allowed in the local env.
+type GatewayConfig struct {
+	// Port is where the gateway listens, it is not served when it is 0
+	Port int `yaml:"port" env:"GATEWAY_PORT"`
+	// AllowedOrigins are the origins browsers may call the gateway from, "*" allows any
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+type MetricsConfig struct {
+	// Port serves /metrics, /healthz and /readyz, they are not served when it is 0
+	Port int `yaml:"port" env:"METRICS_PORT"`
+}
+
+// HTTPConfig bounds the connections of the gateway and the metrics servers.
+type HTTPConfig struct {
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env-default:"5s"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env-default:"30s"`
+	// WriteTimeout must leave room for the long polls of AwaitLoginApproval
+	WriteTimeout time.Duration `yaml:"write_timeout" env-default:"2m"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" env-default:"2m"`
+	// ShutdownTimeout is how long the requests in flight have to finish on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"5s"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host" env:"SMTP_HOST" env-default:"smtp.gmail.com"`
+	Port     int    `yaml:"port" env:"SMTP_PORT" env-default:"587"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+	// From is the sender address of every mail
+	From string `yaml:"from" env:"SMTP_FROM"`
+}
+
+// SigningConfig keeps the token signing keys out of the database.
+type SigningConfig struct {
+	// AppSecrets are "app id:secret" pairs separated by commas, they replace
+	// the secrets stored for those apps when tokens are signed and verified
+	AppSecrets string `yaml:"app_secrets" env:"APP_SECRETS"`
+}
+
+// RateLimitConfig limits how many calls every client address makes, the
+// limit is a token bucket refilled at Rate calls a second up to Burst.
+type RateLimitConfig struct {
+	// Rate is the calls a second a client can keep up, 0 disables the limit
+	Rate  float64 `yaml:"rate" env:"RATE_LIMIT_RATE" env-default:"0"`
+	Burst int     `yaml:"burst" env:"RATE_LIMIT_BURST" env-default:"20"`
+	// Methods override the limit per method, keyed by the method name like Login
+	Methods map[string]RateLimitRule `yaml:"methods"`
+}
+
+// RateLimitRule is the limit of a method, a Rate of 0 lifts the limit for it.
+type RateLimitRule struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// HealthConfig sets how often the dependencies are checked for grpc.health.v1 and /readyz.
+type HealthConfig struct {
+	Interval time.Duration `yaml:"interval" env-default:"10s"`
+	Timeout  time.Duration `yaml:"timeout" env-default:"2s"`
+}
+
+type TracingConfig struct {
+	// Exporter is one of "none", "stdout" or "otlp"
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"`
+	// Endpoint is the host:port of the OTLP gRPC collector
+	Endpoint    string  `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	Insecure    bool    `yaml:"insecure" env-default:"false"`
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
+}
+
+type PasswordlessConfig struct {
+	CodeTTL time.Duration `yaml:"code_ttl" env-default:"10m"`
+	// LinkURL is the client page magic links point to, links are not sent when empty
+	LinkURL string `yaml:"link_url"`
+}
+
+type SMSConfig struct {
+	// Driver is one of "log", "file" or "http"
+	Driver   string        `yaml:"driver" env-default:"log"`
+	FilePath string        `yaml:"file_path"`
+	URL      string        `yaml:"url"`
+	APIKey   string        `yaml:"api_key" env:"SMS_API_KEY"`
+	Timeout  time.Duration `yaml:"timeout" env-default:"5s"`
+}
+
+type ValidationConfig struct {
+	MinPasswordLength int `yaml:"min_password_length" env-default:"8"`
+	// MaxPasswordLength is in bytes, bcrypt ignores everything past 72
+	MaxPasswordLength int `yaml:"max_password_length" env-default:"72"`
+	// MinPasswordScore is the lowest accepted zxcvbn score, from 0 to 4
+	MinPasswordScore int `yaml:"min_password_score" env-default:"2"`
+	MinAge           int `yaml:"min_age" env-default:"14"`
+	MaxEmailLength   int `yaml:"max_email_length" env-default:"254"`
+	MaxNameLength    int `yaml:"max_name_length" env-default:"100"`
+}
+
+type BreachConfig struct {
+	// Driver is one of "none", "file" or "http"
+	Driver string `yaml:"driver" env-default:"none"`
+	// FilePath is a file of "HASH:COUNT" lines or a directory of range files
+	FilePath string `yaml:"file_path"`
+	// IndexPath defaults to FilePath with the ".idx" extension
+	IndexPath string        `yaml:"index_path"`
+	URL       string        `yaml:"url" env-default:"https://api.pwnedpasswords.com"`
+	Timeout   time.Duration `yaml:"timeout" env-default:"3s"`
+}
+
+// PasswordHashConfig sets how new hashes are made, hashes made with other
+// settings are upgraded on the next successful login.
+type PasswordHashConfig struct {
+	// Algorithm is "bcrypt" or "argon2id"
+	Algorithm  string `yaml:"algorithm" env-default:"bcrypt"`
+	BcryptCost int    `yaml:"bcrypt_cost" env-default:"10"`
+	// Argon2Memory is in KiB
+	Argon2Memory  uint32 `yaml:"argon2_memory" env-default:"65536"`
+	Argon2Time    uint32 `yaml:"argon2_time" env-default:"3"`
+	Argon2Threads uint8  `yaml:"argon2_threads" env-default:"2"`
+	Argon2SaltLen uint32 `yaml:"argon2_salt_len" env-default:"16"`
+	Argon2KeyLen  uint32 `yaml:"argon2_key_len" env-default:"32"`
+}
+
+// Params are the hasher params of the config.
+func (c PasswordHashConfig) Params() passhash.Params {
+	return passhash.Params{
+		Algorithm:     c.Algorithm,
+		BcryptCost:    c.BcryptCost,
+		Argon2Memory:  c.Argon2Memory,
+		Argon2Time:    c.Argon2Time,
+		Argon2Threads: c.Argon2Threads,
+		Argon2SaltLen: c.Argon2SaltLen,
+		Argon2KeyLen:  c.Argon2KeyLen,
+	}
+}
+
+type RegistrationConfig struct {
+	// EnumerationSafe makes Register, ChangeEmail and UpdateProfile succeed for
+	// taken contacts and tell their owners instead, the user id is not returned
+	// by Register in this mode
+	EnumerationSafe bool `yaml:"enumeration_safe" env-default:"false"`
+}
+
+type AuditConfig struct {
+	// FilePath is a JSON lines copy of the audit log, events are only stored in the database when empty
+	FilePath string `yaml:"file_path"`
+}
+
+// WebhookConfig tunes the delivery of user events to the webhook endpoints of the apps
+type WebhookConfig struct {
+	Timeout      time.Duration `yaml:"timeout" env-default:"5s"`
+	MaxAttempts  int           `yaml:"max_attempts" env-default:"8"`
+	RetryDelay   time.Duration `yaml:"retry_delay" env-default:"30s"`
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"5s"`
+	// AllowPrivateTargets lets endpoints resolve to loopback and private addresses, for local receivers
+	AllowPrivateTargets bool `yaml:"allow_private_targets" env-default:"false"`
+}
+
+type AccountDeletionConfig struct {
+	// GracePeriod is how long a deleted account can still be restored by logging in
+	GracePeriod time.Duration `yaml:"grace_period" env-default:"720h"`
+	// Pseudonymize keeps purged users under placeholder values instead of deleting their rows
+	Pseudonymize  bool          `yaml:"pseudonymize" env-default:"false"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+}
+
+// EncryptionConfig holds the keys of the users personal data, it is stored in
+// plaintext when no master keys are set. Rows are moved to a new primary key
+// or out of plaintext with the rotatekeys command.
+type EncryptionConfig struct {
+	// MasterKeys are "id:base64 key" pairs, the first one wraps new data keys
+	MasterKeys string `yaml:"master_keys" env:"PII_MASTER_KEYS"`
+	// KeyFile holds the master keys in the same format and replaces MasterKeys when set
+	KeyFile string `yaml:"key_file" env:"PII_KEY_FILE"`
+	// IndexKey is the base64 HMAC key of the email and phone number lookups,
+	// after changing it the indexes are rebuilt with rotatekeys -all
+	IndexKey string `yaml:"index_key" env:"PII_INDEX_KEY"`
+}
+
+// CodesConfig keys the hashes the one time codes are stored as.
+type CodesConfig struct {
+	// HashKey is the base64 HMAC key of the codes, at least 32 bytes. Without
+	// it a random key is used, so the codes sent before a restart stop working
+	// and several instances don't accept the codes of each other.
+	HashKey string `yaml:"hash_key" env:"CODE_HASH_KEY"`
+}
+
+// Key decodes HashKey, it is nil when HashKey is empty.
+func (c CodesConfig) Key() ([]byte, error) {
+	if c.HashKey == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(c.HashKey))
+	if err != nil {
+		return nil, errors.New("is not base64")
+	}
+	if len(key) < 32 {
+		return nil, errors.New("must be at least 32 bytes")
+	}
+
+	return key, nil
+}
+
+type TelegramConfig struct {
+	Token      string        `yaml:"token" env:"TELEGRAM_TOKEN"`
+	Timeout    int           `yaml:"timeout" env-default:"60"`
+	Retries    int           `yaml:"retries" env-default:"3"`
+	RetryDelay time.Duration `yaml:"retry_delay" env-default:"1s"`
+}
+
+// Level is the level of LogLevel, one of "debug", "info", "warn" or "error".
+// It defaults to debug in local and dev and to info in prod.
+func (c *Config) Level() slog.Level {
+	switch c.LogLevel {
+	case "debug":
+		return slog.LevelDebug
+	case "info":
+		return slog.LevelInfo
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+
+	if c.Env == "prod" {
+		return slog.LevelInfo
+	}
+	return slog.LevelDebug
+}
+
+// Load reads the config from the file given by the -config flag or the
+// CONFIG_PATH env, see LoadPath.
+func Load() (*Config, error) {
+	return LoadPath(Path())
+}
+
+// LoadPath reads the config from path, applies the env overrides and the
+// secret files and validates it. Every problem found is reported in the
+// returned error.
+func LoadPath(path string) (*Config, error) {
 	if path == "" {
-		panic("Config path is empty")
+		return nil, errors.New("config path is empty, set -config or CONFIG_PATH")
 	}
 
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		panic("Config file does not exist")
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
 	}
 
 	var cfg Config
 
 	if err := cleanenv.ReadConfig(path, &cfg); err != nil {
-		panic("failed to read config " + err.Error())
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := cfg.readSecretFiles(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// secrets are the values that can be read from the file named by the env
+// of the same name with the _FILE suffix, the way docker and kubernetes
+// mount secrets.
+func (c *Config) secrets() map[string]*string {
+	return map[string]*string{
+		"SMTP_PASSWORD":   &c.SMTP.Password,
+		"TELEGRAM_TOKEN":  &c.Telegram.Token,
+		"SMS_API_KEY":     &c.SMS.APIKey,
+		"APP_SECRETS":     &c.Signing.AppSecrets,
+		"PII_MASTER_KEYS": &c.Encryption.MasterKeys,
+		"PII_INDEX_KEY":   &c.Encryption.IndexKey,
+		"CODE_HASH_KEY":   &c.Codes.HashKey,
+	}
+}
+
+func (c *Config) readSecretFiles() error {
+	secrets := c.secrets()
+
+	var errs []error
+
+	for _, env := range sortedKeys(secrets) {
+		path := os.Getenv(env + "_FILE")
+		if path == "" {
+			continue
+		}
+		if os.Getenv(env) != "" {
+			errs = append(errs, fmt.Errorf("only one of %s and %s_FILE can be set", env, env))
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s_FILE: %w", env, err))
+			continue
+		}
+		*secrets[env] = strings.TrimRight(string(content), "\r\n")
 	}
 
-	return &cfg
+	return errors.Join(errs...)
 }
 
-func fetchConfigPath() string {
+// Path returns the config path of the -config flag or the CONFIG_PATH env,
+// it parses the command line so it is called once after the flags are defined.
+func Path() string {
 	var res string
 
 	flag.StringVar(&res, "config", "", "path to the config file")
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// minimalYAML is the smallest config that loads, everything else has a default
+const minimalYAML = `
+storage_path: "./sso.db"
+token_ttl: 1h
+grpc:
+  port: 44044
+smtp:
+  from: "sso@example.com"
+`
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func loadMinimal(t *testing.T) *Config {
+	t.Helper()
+
+	cfg, err := LoadPath(writeFile(t, "config.yaml", minimalYAML))
+	if err != nil {
+		t.Fatalf("LoadPath() error = %v", err)
+	}
+	return cfg
+}
+
+// prod turns the minimal config into one that passes the prod checks
+func prod(c *Config) {
+	c.Env = "prod"
+	c.SMS.Driver = "http"
+	c.SMS.URL = "https://sms.example.com"
+	c.Codes.HashKey = base64.StdEncoding.EncodeToString(make([]byte, 32))
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		// wantErr is the field reported, the config is valid when it is empty
+		wantErr string
+	}{
+		{name: "minimal", modify: func(c *Config) {}},
+		{name: "prod", modify: prod},
+		{
+			name:    "log sms driver in prod",
+			modify:  func(c *Config) { prod(c); c.SMS.Driver = "log" },
+			wantErr: `sms.driver: "log" is for local development`,
+		},
+		{
+			name:    "file sms driver in prod",
+			modify:  func(c *Config) { prod(c); c.SMS.Driver = "file"; c.SMS.FilePath = "sms.log" },
+			wantErr: `sms.driver: "file" is for local development`,
+		},
+		{
+			name:    "private webhook targets in prod",
+			modify:  func(c *Config) { prod(c); c.Webhook.AllowPrivateTargets = true },
+			wantErr: "webhook.allow_private_targets: must be false in prod",
+		},
+		{name: "private webhook targets in local", modify: func(c *Config) { c.Webhook.AllowPrivateTargets = true }},
+		{
+			name:    "code hash key missing in prod",
+			modify:  func(c *Config) { prod(c); c.Codes.HashKey = "" },
+			wantErr: "codes.hash_key: is required in prod",
+		},
+		{
+			name:    "short code hash key",
+			modify:  func(c *Config) { c.Codes.HashKey = base64.StdEncoding.EncodeToString(make([]byte, 16)) },
+			wantErr: "codes.hash_key: must be at least 32 bytes",
+		},
+		{
+			name:    "gateway on the grpc port",
+			modify:  func(c *Config) { c.Gateway.Port = c.GRPC.Port },
+			wantErr: "gateway.port: 44044 is already used by grpc.port",
+		},
+		{
+			name:    "metrics on the gateway port",
+			modify:  func(c *Config) { c.Gateway.Port = 8080; c.Metrics.Port = 8080 },
+			wantErr: "metrics.port: 8080 is already used by gateway.port",
+		},
+		{name: "disabled servers share port 0", modify: func(c *Config) { c.Gateway.Port = 0; c.Metrics.Port = 0 }},
+		{name: "plaintext gateway in local", modify: func(c *Config) { c.Gateway.Port = 8080 }},
+		{
+			name:    "plaintext gateway in dev",
+			modify:  func(c *Config) { c.Env = "dev"; c.Gateway.Port = 8080 },
+			wantErr: "gateway.port: the gateway needs grpc.tls.cert_file",
+		},
+		{
+			name:    "plaintext gateway in prod",
+			modify:  func(c *Config) { prod(c); c.Gateway.Port = 8080 },
+			wantErr: "gateway.port: the gateway needs grpc.tls.cert_file",
+		},
+		{name: "no gateway in prod", modify: func(c *Config) { prod(c); c.Gateway.Port = 0 }},
+		{
+			name:    "bad app secrets",
+			modify:  func(c *Config) { c.Signing.AppSecrets = "1:a,1:b" },
+			wantErr: "signing.app_secrets: app 1 is listed twice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadMinimal(t)
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateJoinsProblems(t *testing.T) {
+	cfg := loadMinimal(t)
+	cfg.Env = "staging"
+	cfg.TokenTTL = 0
+	cfg.Metrics.Port = cfg.GRPC.Port
+	cfg.Webhook.MaxAttempts = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() error = nil, want the problems")
+	}
+
+	for _, want := range []string{
+		`env: "staging" is not one of local, dev, prod`,
+		"token_ttl: must be positive",
+		"metrics.port: 44044 is already used by grpc.port",
+		"webhook.max_attempts: must be at least 1",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want it to report %q", err, want)
+		}
+	}
+}
+
+func TestParseAppSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[int]string
+		wantErr string
+	}{
+		{name: "empty", value: " ", want: map[int]string{}},
+		{name: "pairs", value: "1:first, 2:second", want: map[int]string{1: "first", 2: "second"}},
+		{name: "secret with colon", value: "1:a:b", want: map[int]string{1: "a:b"}},
+		{name: "no colon", value: "1", wantErr: `pairs must look like "app id:secret"`},
+		{name: "no secret", value: "1:", wantErr: `pairs must look like "app id:secret"`},
+		{name: "bad app id", value: "one:secret", wantErr: `"one" is not an app id`},
+		{name: "listed twice", value: "1:a,2:b,1:c", wantErr: "app 1 is listed twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAppSecrets(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("ParseAppSecrets() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAppSecrets() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseAppSecrets() = %v, want %v", got, tt.want)
+			}
+			for id, secret := range tt.want {
+				if got[id] != secret {
+					t.Errorf("secret of app %d = %q, want %q", id, got[id], secret)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadPathSecretFiles(t *testing.T) {
+	path := writeFile(t, "config.yaml", minimalYAML)
+
+	t.Run("read", func(t *testing.T) {
+		t.Setenv("SMTP_PASSWORD_FILE", writeFile(t, "smtp_password", "hunter2\r\n"))
+		t.Setenv("APP_SECRETS_FILE", writeFile(t, "app_secrets", "1:secret\n"))
+
+		cfg, err := LoadPath(path)
+		if err != nil {
+			t.Fatalf("LoadPath() error = %v", err)
+		}
+		// the trailing newline editors add is not part of the secret
+		if cfg.SMTP.Password != "hunter2" {
+			t.Errorf("smtp.password = %q, want %q", cfg.SMTP.Password, "hunter2")
+		}
+		if cfg.Signing.AppSecrets != "1:secret" {
+			t.Errorf("signing.app_secrets = %q, want %q", cfg.Signing.AppSecrets, "1:secret")
+		}
+	})
+
+	t.Run("env and file", func(t *testing.T) {
+		t.Setenv("SMTP_PASSWORD", "hunter2")
+		t.Setenv("SMTP_PASSWORD_FILE", writeFile(t, "smtp_password", "hunter2"))
+
+		_, err := LoadPath(path)
+		if err == nil || !strings.Contains(err.Error(), "only one of SMTP_PASSWORD and SMTP_PASSWORD_FILE can be set") {
+			t.Fatalf("LoadPath() error = %v, want both set reported", err)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Setenv("TELEGRAM_TOKEN_FILE", filepath.Join(t.TempDir(), "missing"))
+
+		_, err := LoadPath(path)
+		if !errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), "TELEGRAM_TOKEN_FILE") {
+			t.Fatalf("LoadPath() error = %v, want the missing file reported", err)
+		}
+	})
+
+	t.Run("validated", func(t *testing.T) {
+		t.Setenv("APP_SECRETS_FILE", writeFile(t, "app_secrets", "secret"))
+
+		_, err := LoadPath(path)
+		if err == nil || !strings.Contains(err.Error(), "signing.app_secrets") {
+			t.Fatalf("LoadPath() error = %v, want the secret validated", err)
+		}
+	})
+}
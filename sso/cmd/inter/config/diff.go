@@ -0,0 +1,40 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Diff returns the yaml paths of the settings that differ between a and b,
+// like "grpc.port". Sections are compared setting by setting, the values of
+// maps and lists as a whole.
+func Diff(a *Config, b *Config) []string {
+	var paths []string
+	diff(reflect.ValueOf(*a), reflect.ValueOf(*b), "", &paths)
+	return paths
+}
+
+func diff(a reflect.Value, b reflect.Value, prefix string, paths *[]string) {
+	t := a.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			diff(a.Field(i), b.Field(i), name, paths)
+			continue
+		}
+
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			*paths = append(*paths, name)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string
+	}{
+		{name: "unchanged", modify: func(c *Config) {}},
+		{name: "top level", modify: func(c *Config) { c.LogLevel = "warn" }, want: []string{"log_level"}},
+		{name: "section", modify: func(c *Config) { c.GRPC.Port = 44045 }, want: []string{"grpc.port"}},
+		{
+			name:   "nested section",
+			modify: func(c *Config) { c.GRPC.TLS.ClientCertOptional = true },
+			want:   []string{"grpc.tls.client_cert_optional"},
+		},
+		{
+			name:   "map as a whole",
+			modify: func(c *Config) { c.GRPC.MethodTimeouts = map[string]time.Duration{"Login": time.Second} },
+			want:   []string{"grpc.method_timeouts"},
+		},
+		{
+			name:   "list as a whole",
+			modify: func(c *Config) { c.Gateway.AllowedOrigins = []string{"https://example.com"} },
+			want:   []string{"gateway.allowed_origins"},
+		},
+		{
+			name: "several",
+			modify: func(c *Config) {
+				c.TokenTTL = 2 * time.Hour
+				c.RateLimit.Rate = 5
+				c.RateLimit.Methods = map[string]RateLimitRule{"Login": {Rate: 1, Burst: 1}}
+			},
+			want: []string{"token_ttl", "rate_limit.rate", "rate_limit.methods"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := loadMinimal(t)
+			b := *a
+			tt.modify(&b)
+
+			if got := Diff(a, &b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"regexp"
+	"sort"
+	"sso/sso/cmd/inter/lib/fieldcrypt"
+	"sso/sso/cmd/inter/lib/passhash"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// telegramTokenRe matches the tokens BotFather gives out, "<bot id>:<secret>"
+var telegramTokenRe = regexp.MustCompile(`^[0-9]+:[A-Za-z0-9_-]{30,}$`)
+
+// problems collects everything wrong with the config, so it is fixed in one go
+type problems []error
+
+func (p *problems) add(field string, format string, args ...any) {
+	*p = append(*p, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+}
+
+func (p *problems) oneOf(field string, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	p.add(field, "%q is not one of %s", value, strings.Join(allowed, ", "))
+}
+
+func (p *problems) positive(field string, d time.Duration) {
+	if d <= 0 {
+		p.add(field, "must be positive")
+	}
+}
+
+func (p *problems) notNegative(field string, d time.Duration) {
+	if d < 0 {
+		p.add(field, "can't be negative")
+	}
+}
+
+// port checks a listening port, 0 is allowed for the optional servers
+func (p *problems) port(field string, port int, optional bool) {
+	if (port == 0 && !optional) || port < 0 || port > 65535 {
+		p.add(field, "%d is not a valid port", port)
+	}
+}
+
+// Validate returns every problem of the config joined in one error.
+func (c *Config) Validate() error {
+	var p problems
+
+	p.oneOf("env", c.Env, "local", "dev", "prod")
+	if c.LogLevel != "" {
+		p.oneOf("log_level", c.LogLevel, "debug", "info", "warn", "error")
+	}
+	if c.StoragePath == "" {
+		p.add("storage_path", "can't be empty")
+	}
+	p.positive("token_ttl", c.TokenTTL)
+
+	c.validateServers(&p)
+
+	if c.SMTP.Host == "" {
+		p.add("smtp.host", "can't be empty")
+	}
+	p.port("smtp.port", c.SMTP.Port, false)
+	if _, err := mail.ParseAddress(c.SMTP.From); err != nil {
+		p.add("smtp.from", "%q is not an email address", c.SMTP.From)
+	}
+
+	if _, err := ParseAppSecrets(c.Signing.AppSecrets); err != nil {
+		p.add("signing.app_secrets", "%s", err)
+	}
+
+	c.validateRateLimit(&p)
+
+	p.oneOf("tracing.exporter", c.Tracing.Exporter, "none", "stdout", "otlp")
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		p.add("tracing.sample_ratio", "must be between 0 and 1")
+	}
+
+	p.positive("health.interval", c.Health.Interval)
+	p.positive("health.timeout", c.Health.Timeout)
+
+	if c.Telegram.Token != "" && !telegramTokenRe.MatchString(c.Telegram.Token) {
+		// the token itself is not printed
+		p.add("telegram.token", "is not a bot token like 123456789:AAH...")
+	}
+	if c.Telegram.Timeout <= 0 {
+		p.add("telegram.timeout", "must be positive")
+	}
+	if c.Telegram.Retries < 0 {
+		p.add("telegram.retries", "can't be negative")
+	}
+
+	p.positive("passwordless.code_ttl", c.Passwordless.CodeTTL)
+
+	p.oneOf("sms.driver", c.SMS.Driver, "log", "file", "http")
+	if c.SMS.Driver == "file" && c.SMS.FilePath == "" {
+		p.add("sms.file_path", "is required by the file driver")
+	}
+	if c.SMS.Driver == "http" && c.SMS.URL == "" {
+		p.add("sms.url", "is required by the http driver")
+	}
+	// the log and file drivers write the verification codes in the clear
+	if c.Env == "prod" && c.SMS.Driver != "http" {
+		p.add("sms.driver", "%q is for local development, use http in prod", c.SMS.Driver)
+	}
+
+	p.oneOf("breach.driver", c.Breach.Driver, "none", "file", "http")
+	if c.Breach.Driver == "file" {
+		if c.Breach.FilePath == "" {
+			p.add("breach.file_path", "is required by the file driver")
+		} else if err := readable(c.Breach.FilePath); err != nil {
+			p.add("breach.file_path", "%s", err)
+		}
+	}
+
+	if c.Validation.MinPasswordLength > c.Validation.MaxPasswordLength {
+		p.add("validation.min_password_length", "is greater than max_password_length")
+	}
+	if c.Validation.MinPasswordScore < 0 || c.Validation.MinPasswordScore > 4 {
+		p.add("validation.min_password_score", "must be between 0 and 4")
+	}
+
+	p.oneOf("password_hash.algorithm", c.PasswordHash.Algorithm, "bcrypt", "argon2id")
+	if _, err := passhash.New(c.PasswordHash.Params()); err != nil && !errors.Is(err, passhash.ErrUnknownAlgorithm) {
+		p.add("password_hash", "%s", err)
+	}
+
+	if c.Webhook.MaxAttempts < 1 {
+		p.add("webhook.max_attempts", "must be at least 1")
+	}
+	p.positive("webhook.timeout", c.Webhook.Timeout)
+	p.positive("webhook.poll_interval", c.Webhook.PollInterval)
+	if c.Env == "prod" && c.Webhook.AllowPrivateTargets {
+		p.add("webhook.allow_private_targets", "must be false in prod")
+	}
+
+	// the key file is read like on startup, the keys themselves are not printed
+	if _, err := fieldcrypt.Load(c.Encryption.MasterKeys, c.Encryption.KeyFile, c.Encryption.IndexKey); err != nil {
+		p.add("encryption", "%s", err)
+	}
+
+	if _, err := c.Codes.Key(); err != nil {
+		p.add("codes.hash_key", "%s", err)
+	}
+	// a key per instance would reject the codes sent by the others
+	if c.Env == "prod" && c.Codes.HashKey == "" {
+		p.add("codes.hash_key", "is required in prod")
+	}
+
+	p.notNegative("account_deletion.grace_period", c.AccountDeletion.GracePeriod)
+	p.positive("account_deletion.purge_interval", c.AccountDeletion.PurgeInterval)
+
+	if len(p) > 0 {
+		return fmt.Errorf("invalid config:\n%w", errors.Join(p...))
+	}
+	return nil
+}
+
+func (c *Config) validateServers(p *problems) {
+	p.port("grpc.port", c.GRPC.Port, false)
+	p.port("gateway.port", c.Gateway.Port, true)
+	if c.Gateway.Port != 0 && c.GRPC.TLS.CertFile == "" && c.Env != "local" {
+		// tokens and passwords would be sent in the clear
+		p.add("gateway.port", "the gateway needs grpc.tls.cert_file outside the local env")
+	}
+	p.port("metrics.port", c.Metrics.Port, true)
+
+	used := map[int]string{c.GRPC.Port: "grpc.port"}
+	for _, s := range []struct {
+		field string
+		port  int
+	}{{"gateway.port", c.Gateway.Port}, {"metrics.port", c.Metrics.Port}} {
+		if s.port == 0 {
+			continue
+		}
+		if other, ok := used[s.port]; ok {
+			p.add(s.field, "%d is already used by %s", s.port, other)
+		}
+		used[s.port] = s.field
+	}
+
+	p.notNegative("grpc.timeout", c.GRPC.Timeout)
+	for _, method := range sortedKeys(c.GRPC.MethodTimeouts) {
+		p.positive("grpc.method_timeouts."+method, c.GRPC.MethodTimeouts[method])
+	}
+
+	p.notNegative("grpc.keepalive.time", c.GRPC.Keepalive.Time)
+	p.notNegative("grpc.keepalive.timeout", c.GRPC.Keepalive.Timeout)
+	p.notNegative("grpc.keepalive.min_time", c.GRPC.Keepalive.MinTime)
+	p.notNegative("grpc.keepalive.max_connection_idle", c.GRPC.Keepalive.MaxConnectionIdle)
+	p.notNegative("grpc.keepalive.max_connection_age", c.GRPC.Keepalive.MaxConnectionAge)
+	p.notNegative("grpc.keepalive.max_connection_age_grace", c.GRPC.Keepalive.MaxConnectionAgeGrace)
+
+	tls := c.GRPC.TLS
+	if tls.CertFile != "" && tls.KeyFile == "" {
+		p.add("grpc.tls.key_file", "is required with cert_file")
+	}
+	if tls.CertFile == "" && (tls.KeyFile != "" || tls.ClientCAFile != "") {
+		p.add("grpc.tls.cert_file", "is required with key_file and client_ca_file")
+	}
+	if len(tls.PrivilegedClients) > 0 && tls.ClientCAFile == "" {
+		p.add("grpc.tls.privileged_clients", "need client_ca_file to verify the clients")
+	}
+	if tls.CertFile != "" {
+		p.positive("grpc.tls.reload_interval", tls.ReloadInterval)
+		validateTLSFiles(p, tls)
+	}
+
+	p.notNegative("http.read_header_timeout", c.HTTP.ReadHeaderTimeout)
+	p.notNegative("http.read_timeout", c.HTTP.ReadTimeout)
+	p.notNegative("http.write_timeout", c.HTTP.WriteTimeout)
+	p.notNegative("http.idle_timeout", c.HTTP.IdleTimeout)
+	p.positive("http.shutdown_timeout", c.HTTP.ShutdownTimeout)
+}
+
+// validateTLSFiles loads the certificate, the key and the client CAs like the
+// listener does, so a wrong path fails the startup with the other problems
+func validateTLSFiles(p *problems, cfg TLSConfig) {
+	if cfg.KeyFile != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile); err != nil {
+			p.add("grpc.tls.cert_file", "%s", err)
+		}
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			p.add("grpc.tls.client_ca_file", "%s", err)
+			return
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			p.add("grpc.tls.client_ca_file", "has no PEM certificates")
+		}
+	}
+}
+
+// readable opens the file or lists the directory at path
+func readable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		_, err := os.ReadDir(path)
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (c *Config) validateRateLimit(p *problems) {
+	rule := func(field string, rate float64, burst int) {
+		if rate < 0 {
+			p.add(field+".rate", "can't be negative")
+		}
+		if rate > 0 && burst < 1 {
+			p.add(field+".burst", "must be at least 1")
+		}
+	}
+
+	rule("rate_limit", c.RateLimit.Rate, c.RateLimit.Burst)
+	for _, method := range sortedKeys(c.RateLimit.Methods) {
+		r := c.RateLimit.Methods[method]
+		rule("rate_limit.methods."+method, r.Rate, r.Burst)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ParseAppSecrets parses the "app id:secret" pairs of SigningConfig.AppSecrets.
+func ParseAppSecrets(value string) (map[int]string, error) {
+	secrets := make(map[int]string)
+	if strings.TrimSpace(value) == "" {
+		return secrets, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || secret == "" {
+			return nil, errors.New(`pairs must look like "app id:secret"`)
+		}
+
+		appID, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an app id", id)
+		}
+		if _, ok := secrets[appID]; ok {
+			return nil, fmt.Errorf("app %d is listed twice", appID)
+		}
+		secrets[appID] = secret
+	}
+
+	return secrets, nil
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// AccountDeletion is a deletion requested by the user, the account is purged
+// after PurgeAfter unless the user logs in before.
+type AccountDeletion struct {
+	UserID      int64
+	RequestedAt time.Time
+	PurgeAfter  time.Time
+}
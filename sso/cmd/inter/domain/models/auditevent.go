@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// Audit event types
+const (
+	AuditLogin                 = "login"
+	AuditRegister              = "register"
+	AuditEmailVerification     = "email_verification"
+	AuditIsAdmin               = "is_admin"
+	AuditPasswordReset         = "password_reset"
+	AuditPasswordChange        = "password_change"
+	AuditEmailChangeRequested  = "email_change_requested"
+	AuditEmailChange           = "email_change"
+	AuditPhoneVerificationSent = "phone_verification_requested"
+	AuditPhoneVerification     = "phone_verification"
+	AuditProfileUpdate         = "profile_update"
+	AuditQueryAuditLog         = "query_audit_log"
+	AuditRoleChange            = "role_change"
+	AuditWebhookChange         = "webhook_change"
+	AuditDataExport            = "data_export"
+	AuditAccountDeletion       = "account_deletion"
+	AuditAccountPurge          = "account_purge"
+)
+
+type AuditEvent struct {
+	ID        int64
+	CreatedAt time.Time
+	Event     string
+	// ActorID is the authenticated caller, 0 for anonymous calls
+	ActorID int64
+	// TargetID is the affected user, 0 if there is none or it is unknown
+	TargetID int64
+	// Identifier is what the caller named the target by, e.g. the email of a failed login
+	Identifier string
+	AppID      int
+	IP         string
+	UserAgent  string
+	Outcome    string
+	Reason     string
+}
+
+// AuditFilter selects audit events, zero fields don't filter.
+type AuditFilter struct {
+	Event    string
+	ActorID  int64
+	TargetID int64
+	AppID    int
+	Outcome  string
+	Since    time.Time
+	Until    time.Time
+	// BeforeID is the pagination cursor, events are returned newest first
+	BeforeID int64
+	Limit    int
+}
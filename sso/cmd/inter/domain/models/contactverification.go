@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Contact channels of the user that can be verified separately
+const (
+	ChannelEmail    = "email"
+	ChannelPhone    = "phone"
+	ChannelTelegram = "telegram"
+)
+
+var Channels = []string{ChannelEmail, ChannelPhone, ChannelTelegram}
+
+type ContactVerification struct {
+	Channel    string
+	IsVerified bool
+	VerifiedAt time.Time
+}
@@ -0,0 +1,8 @@
+package models
+
+type ExternalAuth struct {
+	ID         int64
+	UserID     int64
+	Provider   string
+	ProviderID string
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	LoginApprovalPending  = "pending"
+	LoginApprovalApproved = "approved"
+	LoginApprovalDenied   = "denied"
+	// LoginApprovalConsumed is set once the token for an approved login is issued
+	LoginApprovalConsumed = "consumed"
+)
+
+type LoginApproval struct {
+	ID        string
+	UserID    int64
+	AppID     int
+	Status    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
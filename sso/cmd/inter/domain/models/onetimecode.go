@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+const (
+	CodePurposeLogin         = "login"
+	CodePurposeEmailChange   = "email_change"
+	CodePurposePhone         = "phone_verification"
+	CodePurposePasswordReset = "password_reset"
+	// CodePurposeTelegramRebind moves a bound account to another chat, the payload is the new chat id
+	CodePurposeTelegramRebind = "telegram_rebind"
+)
+
+type OneTimeCode struct {
+	ID       int64
+	UserID   int64
+	Purpose  string
+	CodeHash string
+	// Payload keeps purpose specific data, e.g. the app id of a passwordless login
+	Payload   string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,14 @@
+package models
+
+type Profile struct {
+	User          User
+	Verifications []ContactVerification
+}
+
+// ProfileUpdate holds the profile fields to change, nil fields are left as is
+type ProfileUpdate struct {
+	FullName     *string
+	DateOfBirth  *string
+	PhoneNumber  *string
+	TelegramName *string
+}
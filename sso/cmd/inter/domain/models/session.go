@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID          int64
+	UserID      int64
+	AppID       int
+	AccessToken string
+	CreatedAt   time.Time
+}
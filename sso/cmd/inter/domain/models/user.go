@@ -5,7 +5,13 @@ type User struct {
 	Email        string
 	PassHash     []byte
 	TelegramName string
-	DateOfBirth  string
-	FullName     string
-	PhoneNumber  string
+	// TelegramChatID is the chat bound to the user by the telegram bot, 0 if none
+	TelegramChatID int64
+	DateOfBirth    string
+	FullName       string
+	PhoneNumber    string
+	// PendingPhoneNumber and PendingTelegramName belonged to another user when
+	// they were set, they replace the current ones once verified
+	PendingPhoneNumber  string
+	PendingTelegramName string
 }
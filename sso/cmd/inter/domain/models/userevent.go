@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// User event types
+const (
+	UserEventRegistered      = "user.registered"
+	UserEventVerified        = "user.verified"
+	UserEventPasswordChanged = "user.password_changed"
+	UserEventEmailChanged    = "user.email_changed"
+	UserEventRoleChanged     = "user.role_changed"
+	UserEventDeleted         = "user.deleted"
+	UserEventSessionRevoked  = "session.revoked"
+)
+
+// UserEventTypes are the event types webhook endpoints can subscribe to
+var UserEventTypes = []string{
+	UserEventRegistered,
+	UserEventVerified,
+	UserEventPasswordChanged,
+	UserEventEmailChanged,
+	UserEventRoleChanged,
+	UserEventDeleted,
+	UserEventSessionRevoked,
+}
+
+// UserEvent is a state change of a user other services may react to.
+// The id is increasing so it doubles as the cursor of the event stream.
+type UserEvent struct {
+	ID        int64
+	CreatedAt time.Time
+	UserID    int64
+	Type      string
+	Data      map[string]string
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookEndpoint is an https url of an app the subscribed user events are posted to.
+type WebhookEndpoint struct {
+	ID         int64
+	AppID      int
+	URL        string
+	Secret     string
+	EventTypes []string
+	Disabled   bool
+	// ConsecutiveFailures counts the failed attempts since the last successful delivery
+	ConsecutiveFailures int
+	CreatedAt           time.Time
+}
+
+// WebhookDelivery is a user event queued for an endpoint.
+type WebhookDelivery struct {
+	ID            int64
+	EndpointID    int64
+	EventID       int64
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type WebhookDeliveryFilter struct {
+	EndpointID int64
+	Status     string
+	BeforeID   int64
+	Limit      int
+}
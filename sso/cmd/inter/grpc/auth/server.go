@@ -3,8 +3,13 @@ package auth
 import (
 	"context"
 	"errors"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/phone"
+	"sso/sso/cmd/inter/lib/validation"
 	"sso/sso/cmd/inter/services/auth"
 	"sso/sso/cmd/inter/storage"
+	"strconv"
+	"time"
 
 	v1 "github.com/Foreground-Eclipse/testprotos/gen/go/sso"
 	"google.golang.org/grpc"
@@ -30,15 +35,95 @@ type Auth interface {
 	EmailVerification(ctx context.Context,
 		email string,
 		verificationCode string) (bool, error)
+	ResetPassword(ctx context.Context,
+		email string,
+		resetCode string,
+		newPassword string) error
+	StartLoginApproval(ctx context.Context,
+		email string,
+		password string,
+		appID int) (approvalID string, err error)
+	AwaitLoginApproval(ctx context.Context,
+		approvalID string) (token string, err error)
+	StartPasswordlessLogin(ctx context.Context,
+		email string,
+		appID int) error
+	CompletePasswordlessLogin(ctx context.Context,
+		email string,
+		code string,
+		appID int) (token string, err error)
+	ChangePassword(ctx context.Context,
+		token string,
+		currentPassword string,
+		newPassword string) error
+	ChangeEmail(ctx context.Context,
+		token string,
+		newEmail string) error
+	ConfirmEmailChange(ctx context.Context,
+		token string,
+		code string) error
+	GetProfile(ctx context.Context,
+		token string) (models.Profile, error)
+	UpdateProfile(ctx context.Context,
+		token string,
+		update models.ProfileUpdate) (models.Profile, error)
+	SendPhoneVerification(ctx context.Context,
+		token string) error
+	VerifyPhone(ctx context.Context,
+		token string,
+		code string) error
+	QueryAuditLog(ctx context.Context,
+		token string,
+		filter models.AuditFilter) (events []models.AuditEvent, nextCursor int64, err error)
+	WatchUserEvents(ctx context.Context,
+		token string,
+		afterID int64,
+		send func(models.UserEvent) error) error
+	SetAdmin(ctx context.Context,
+		token string,
+		userID int64,
+		isAdmin bool) error
+	CreateWebhookEndpoint(ctx context.Context,
+		token string,
+		appID int,
+		url string,
+		eventTypes []string) (models.WebhookEndpoint, error)
+	WebhookEndpoints(ctx context.Context,
+		token string,
+		appID int,
+		failingOnly bool) ([]models.WebhookEndpoint, error)
+	WebhookDeliveries(ctx context.Context,
+		token string,
+		filter models.WebhookDeliveryFilter) (deliveries []models.WebhookDelivery, nextCursor int64, err error)
+	ReplayWebhookDeliveries(ctx context.Context,
+		token string,
+		endpointID int64,
+		deliveryID int64) (int64, error)
+	SetWebhookEndpointDisabled(ctx context.Context,
+		token string,
+		endpointID int64,
+		disabled bool) error
+	ExportMyData(ctx context.Context,
+		token string) ([]byte, error)
+	DeleteAccount(ctx context.Context,
+		token string,
+		password string) (purgeAfter time.Time, err error)
 }
 
 type serverAPI struct {
 	v1.UnimplementedAuthServer
-	auth Auth
+	auth      Auth
+	validator *validation.Validator
+}
+
+// NewServer returns the handlers of the Auth service, the JSON gateway calls
+// them directly instead of going through the network.
+func NewServer(auth Auth, validator *validation.Validator) v1.AuthServer {
+	return &serverAPI{auth: auth, validator: validator}
 }
 
-func Register(gRPC *grpc.Server, auth Auth) {
-	v1.RegisterAuthServer(gRPC, &serverAPI{auth: auth})
+func Register(gRPC *grpc.Server, server v1.AuthServer) {
+	v1.RegisterAuthServer(gRPC, server)
 }
 
 func (s *serverAPI) Login(ctx context.Context,
@@ -47,22 +132,120 @@ func (s *serverAPI) Login(ctx context.Context,
 		return nil, status.Error(codes.InvalidArgument, "Email cant be empty")
 	}
 
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "AppId is required")
+	}
+
 	if req.GetPassword() == "" {
 		return nil, status.Error(codes.InvalidArgument, "Password cant be empty")
 	}
 
+	if req.GetTelegramApproval() {
+		return s.startLoginApproval(ctx, req)
+	}
+
+	token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()))
+
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.InvalidArgument, "invalid credentials")
+		}
+		return nil, status.Error(codes.Internal, "Internal error")
+	}
+	return &v1.LoginResponse{
+		Token: token,
+	}, nil
+}
+
+func (s *serverAPI) startLoginApproval(ctx context.Context,
+	req *v1.LoginRequest) (*v1.LoginResponse, error) {
+	approvalID, err := s.auth.StartLoginApproval(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()))
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			return nil, status.Error(codes.InvalidArgument, "invalid credentials")
+		case errors.Is(err, auth.ErrTelegramNotLinked):
+			return nil, status.Error(codes.FailedPrecondition, "telegram approval is not available for this account")
+		case errors.Is(err, auth.ErrTelegramUnavailable):
+			return nil, status.Error(codes.Unavailable, "telegram approval is not available")
+		}
+		return nil, status.Error(codes.Internal, "Internal error")
+	}
+
+	return &v1.LoginResponse{
+		ApprovalId: approvalID,
+	}, nil
+}
+
+func (s *serverAPI) AwaitLoginApproval(ctx context.Context,
+	req *v1.AwaitLoginApprovalRequest) (*v1.AwaitLoginApprovalResponse, error) {
+	if req.GetApprovalId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Approval id cant be empty")
+	}
+
+	token, err := s.auth.AwaitLoginApproval(ctx, req.GetApprovalId())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrLoginApprovalNotFound):
+			return nil, status.Error(codes.NotFound, "login approval not found")
+		case errors.Is(err, auth.ErrLoginDenied):
+			return nil, status.Error(codes.PermissionDenied, "login denied")
+		case errors.Is(err, auth.ErrLoginApprovalExpired):
+			return nil, status.Error(codes.DeadlineExceeded, "login approval expired")
+		case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+			// the client is expected to call again while the approval is pending
+			return nil, status.Error(codes.DeadlineExceeded, "login approval is still pending")
+		}
+		return nil, status.Error(codes.Internal, "Internal error")
+	}
+
+	return &v1.AwaitLoginApprovalResponse{
+		Token: token,
+	}, nil
+}
+
+func (s *serverAPI) StartPasswordlessLogin(ctx context.Context,
+	req *v1.StartPasswordlessLoginRequest) (*v1.StartPasswordlessLoginResponse, error) {
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Email cant be empty")
+	}
+
 	if req.GetAppId() == emptyValue {
 		return nil, status.Error(codes.InvalidArgument, "AppId is required")
 	}
 
-	token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()))
+	if err := s.auth.StartPasswordlessLogin(ctx, req.GetEmail(), int(req.GetAppId())); err != nil {
+		if errors.Is(err, auth.ErrInvalidAppId) {
+			return nil, status.Error(codes.InvalidArgument, "invalid app id")
+		}
+		return nil, status.Error(codes.Internal, "Internal error")
+	}
+
+	return &v1.StartPasswordlessLoginResponse{}, nil
+}
 
+func (s *serverAPI) CompletePasswordlessLogin(ctx context.Context,
+	req *v1.CompletePasswordlessLoginRequest) (*v1.LoginResponse, error) {
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Email cant be empty")
+	}
+
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Code cant be empty")
+	}
+
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "AppId is required")
+	}
+
+	token, err := s.auth.CompletePasswordlessLogin(ctx, req.GetEmail(), req.GetCode(), int(req.GetAppId()))
 	if err != nil {
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			return nil, status.Error(codes.InvalidArgument, "invalid credentials")
 		}
 		return nil, status.Error(codes.Internal, "Internal error")
 	}
+
 	return &v1.LoginResponse{
 		Token: token,
 	}, nil
@@ -70,14 +253,17 @@ func (s *serverAPI) Login(ctx context.Context,
 
 func (s *serverAPI) Register(ctx context.Context,
 	req *v1.RegisterRequest) (*v1.RegisterResponse, error) {
-	if err := validateRegister(req); err != nil {
+	if err := s.validateRegister(req); err != nil {
 		return nil, err
 	}
 
 	userID, err := s.auth.RegisterNewUser(ctx, req.GetEmail(), req.GetPassword(), req.GetDateOfBirth(), req.GetFullName(), req.GetPhoneNumber(), req.GetTelegramName())
 	if err != nil {
-		if errors.Is(err, storage.ErrUserExists) {
+		switch {
+		case errors.Is(err, storage.ErrUserExists):
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
+		case errors.Is(err, auth.ErrPasswordBreached):
+			return nil, passwordBreached("password")
 		}
 		return nil, status.Error(codes.Internal, "Internal error")
 	}
@@ -119,25 +305,421 @@ func (s *serverAPI) EmailVerification(ctx context.Context,
 	}, nil
 }
 
-func validateRegister(req *v1.RegisterRequest) error {
-	if req.GetDateOfBirth() == "" {
-		return status.Error(codes.InvalidArgument, "Date of birth cant be empty")
+func (s *serverAPI) ResetPassword(ctx context.Context,
+	req *v1.ResetPasswordRequest) (*v1.ResetPasswordResponse, error) {
+	if err := s.validateResetPassword(req); err != nil {
+		return nil, err
 	}
-	if req.GetEmail() == "" {
-		return status.Error(codes.InvalidArgument, "Email cant be empty")
+
+	err := s.auth.ResetPassword(ctx, req.GetEmail(), req.GetResetCode(), req.GetNewPassword())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidResetCode):
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired reset code")
+		case errors.Is(err, auth.ErrPasswordBreached):
+			return nil, passwordBreached("new_password")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &v1.ResetPasswordResponse{}, nil
+}
+
+func (s *serverAPI) ChangePassword(ctx context.Context,
+	req *v1.ChangePasswordRequest) (*v1.ChangePasswordResponse, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs validation.Errors
+	errs.Check("current_password", validation.Required(req.GetCurrentPassword()))
+	errs.Check("new_password", s.validator.Password(req.GetNewPassword()))
+	if err := errs.Err(); err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	err = s.auth.ChangePassword(ctx, token, req.GetCurrentPassword(), req.GetNewPassword())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrUnauthenticated):
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			return nil, status.Error(codes.InvalidArgument, "invalid credentials")
+		case errors.Is(err, auth.ErrPasswordBreached):
+			return nil, passwordBreached("new_password")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &v1.ChangePasswordResponse{}, nil
+}
+
+func (s *serverAPI) ChangeEmail(ctx context.Context,
+	req *v1.ChangeEmailRequest) (*v1.ChangeEmailResponse, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.validator.Email(req.GetNewEmail()); err != nil {
+		var errs validation.Errors
+		errs.Check("new_email", err)
+		return nil, invalidArgument(errs)
+	}
+
+	err = s.auth.ChangeEmail(ctx, token, req.GetNewEmail())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrUnauthenticated):
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		case errors.Is(err, auth.ErrUserExists):
+			return nil, status.Error(codes.AlreadyExists, "email is already taken")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &v1.ChangeEmailResponse{}, nil
+}
+
+func (s *serverAPI) ConfirmEmailChange(ctx context.Context,
+	req *v1.ConfirmEmailChangeRequest) (*v1.ConfirmEmailChangeResponse, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Code cant be empty")
+	}
+
+	err = s.auth.ConfirmEmailChange(ctx, token, req.GetCode())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrUnauthenticated):
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		case errors.Is(err, auth.ErrInvalidCode):
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired code")
+		case errors.Is(err, auth.ErrUserExists):
+			return nil, status.Error(codes.AlreadyExists, "email is already taken")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &v1.ConfirmEmailChangeResponse{}, nil
+}
+
+func (s *serverAPI) GetProfile(ctx context.Context,
+	req *v1.GetProfileRequest) (*v1.ProfileResponse, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := s.auth.GetProfile(ctx, token)
+	if err != nil {
+		if errors.Is(err, auth.ErrUnauthenticated) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return profileResponse(profile), nil
+}
+
+func (s *serverAPI) UpdateProfile(ctx context.Context,
+	req *v1.UpdateProfileRequest) (*v1.ProfileResponse, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.validateUpdateProfile(req); err != nil {
+		return nil, err
+	}
+
+	profile, err := s.auth.UpdateProfile(ctx, token, models.ProfileUpdate{
+		FullName:     req.FullName,
+		DateOfBirth:  req.DateOfBirth,
+		PhoneNumber:  req.PhoneNumber,
+		TelegramName: req.TelegramName,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrUnauthenticated):
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		case errors.Is(err, auth.ErrUserExists):
+			return nil, status.Error(codes.AlreadyExists, "phone number or telegram name is already taken")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return profileResponse(profile), nil
+}
+
+func (s *serverAPI) SendPhoneVerification(ctx context.Context,
+	req *v1.SendPhoneVerificationRequest) (*v1.SendPhoneVerificationResponse, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.SendPhoneVerification(ctx, token); err != nil {
+		if errors.Is(err, auth.ErrUnauthenticated) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
 	}
-	if req.GetFullName() == "" {
-		return status.Error(codes.InvalidArgument, "Full name cant be empty")
+
+	return &v1.SendPhoneVerificationResponse{}, nil
+}
+
+func (s *serverAPI) VerifyPhone(ctx context.Context,
+	req *v1.VerifyPhoneRequest) (*v1.VerifyPhoneResponse, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Code cant be empty")
 	}
+
+	if err := s.auth.VerifyPhone(ctx, token, req.GetCode()); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrUnauthenticated):
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		case errors.Is(err, auth.ErrInvalidCode):
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired code")
+		case errors.Is(err, auth.ErrPhoneNumberTaken):
+			return nil, status.Error(codes.FailedPrecondition, "phone number is used by another account")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &v1.VerifyPhoneResponse{}, nil
+}
+
+func (s *serverAPI) QueryAuditLog(ctx context.Context,
+	req *v1.QueryAuditLogRequest) (*v1.QueryAuditLogResponse, error) {
+	token, err := adminToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := models.AuditFilter{
+		Event:    req.GetEvent(),
+		ActorID:  req.GetActorId(),
+		TargetID: req.GetTargetId(),
+		AppID:    int(req.GetAppId()),
+		Outcome:  req.GetOutcome(),
+		Limit:    int(req.GetPageSize()),
+	}
+	if req.GetSince() != 0 {
+		filter.Since = time.Unix(req.GetSince(), 0)
+	}
+	if req.GetUntil() != 0 {
+		filter.Until = time.Unix(req.GetUntil(), 0)
+	}
+	if req.GetPageToken() != "" {
+		filter.BeforeID, err = strconv.ParseInt(req.GetPageToken(), 10, 64)
+		if err != nil || filter.BeforeID <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+	}
+	if req.GetPageSize() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Page size cant be negative")
+	}
+
+	events, next, err := s.auth.QueryAuditLog(ctx, token, filter)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrUnauthenticated):
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		case errors.Is(err, auth.ErrPermissionDenied):
+			return nil, status.Error(codes.PermissionDenied, "admin rights required")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &v1.QueryAuditLogResponse{
+		Events: make([]*v1.AuditEvent, 0, len(events)),
+	}
+	for _, e := range events {
+		resp.Events = append(resp.Events, &v1.AuditEvent{
+			Id:         e.ID,
+			CreatedAt:  e.CreatedAt.Unix(),
+			Event:      e.Event,
+			ActorId:    e.ActorID,
+			TargetId:   e.TargetID,
+			Identifier: e.Identifier,
+			AppId:      int32(e.AppID),
+			Ip:         e.IP,
+			UserAgent:  e.UserAgent,
+			Outcome:    e.Outcome,
+			Reason:     e.Reason,
+		})
+	}
+	if next != 0 {
+		resp.NextPageToken = strconv.FormatInt(next, 10)
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) WatchUserEvents(req *v1.WatchUserEventsRequest,
+	stream v1.Auth_WatchUserEventsServer) error {
+	ctx := stream.Context()
+
+	token, err := adminToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	if req.GetAfterId() < 0 {
+		return status.Error(codes.InvalidArgument, "After id cant be negative")
+	}
+
+	err = s.auth.WatchUserEvents(ctx, token, req.GetAfterId(), func(e models.UserEvent) error {
+		return stream.Send(&v1.UserEvent{
+			Id:        e.ID,
+			CreatedAt: e.CreatedAt.Unix(),
+			UserId:    e.UserID,
+			Type:      e.Type,
+			Data:      e.Data,
+		})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrUnauthenticated):
+			return status.Error(codes.Unauthenticated, "invalid token")
+		case errors.Is(err, auth.ErrPermissionDenied):
+			return status.Error(codes.PermissionDenied, "admin rights required")
+		case ctx.Err() != nil:
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	return nil
+}
+
+func (s *serverAPI) SetAdmin(ctx context.Context,
+	req *v1.SetAdminRequest) (*v1.SetAdminResponse, error) {
+	token, err := adminToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "User id cant be empty")
+	}
+
+	if err := s.auth.SetAdmin(ctx, token, req.GetUserId(), req.GetIsAdmin()); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrUnauthenticated):
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		case errors.Is(err, auth.ErrPermissionDenied):
+			return nil, status.Error(codes.PermissionDenied, "admin rights required")
+		case errors.Is(err, storage.ErrUserNotFound):
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &v1.SetAdminResponse{}, nil
+}
+
+func (s *serverAPI) ExportMyData(ctx context.Context,
+	req *v1.ExportMyDataRequest) (*v1.ExportMyDataResponse, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := s.auth.ExportMyData(ctx, token)
+	if err != nil {
+		if errors.Is(err, auth.ErrUnauthenticated) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &v1.ExportMyDataResponse{
+		Archive:     archive,
+		ContentType: "application/json",
+	}, nil
+}
+
+func (s *serverAPI) DeleteAccount(ctx context.Context,
+	req *v1.DeleteAccountRequest) (*v1.DeleteAccountResponse, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	if req.GetPassword() == "" {
-		return status.Error(codes.InvalidArgument, "Password cant be empty")
+		return nil, status.Error(codes.InvalidArgument, "Password cant be empty")
+	}
+
+	purgeAfter, err := s.auth.DeleteAccount(ctx, token, req.GetPassword())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrUnauthenticated):
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			return nil, status.Error(codes.InvalidArgument, "invalid credentials")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
 	}
-	if req.GetPhoneNumber() == "" {
-		return status.Error(codes.InvalidArgument, "Phone number cant be empty")
+
+	return &v1.DeleteAccountResponse{PurgeAfter: purgeAfter.Unix()}, nil
+}
+
+func profileResponse(profile models.Profile) *v1.ProfileResponse {
+	verifications := make([]*v1.ContactVerification, 0, len(profile.Verifications))
+	for _, v := range profile.Verifications {
+		var verifiedAt int64
+		if v.IsVerified {
+			verifiedAt = v.VerifiedAt.Unix()
+		}
+
+		verifications = append(verifications, &v1.ContactVerification{
+			Channel:    v.Channel,
+			IsVerified: v.IsVerified,
+			VerifiedAt: verifiedAt,
+		})
 	}
-	if req.GetTelegramName() == "" {
-		return status.Error(codes.InvalidArgument, "Telegram name cant be empty")
+
+	return &v1.ProfileResponse{
+		UserId:        profile.User.ID,
+		Email:         profile.User.Email,
+		DateOfBirth:   profile.User.DateOfBirth,
+		FullName:      profile.User.FullName,
+		PhoneNumber:   profile.User.PhoneNumber,
+		TelegramName:  profile.User.TelegramName,
+		Verifications: verifications,
+	}
+}
+
+func (s *serverAPI) validateRegister(req *v1.RegisterRequest) error {
+	var errs validation.Errors
+
+	errs.Check("email", s.validator.Email(req.GetEmail()))
+	errs.Check("password", s.validator.Password(req.GetPassword(), req.GetEmail(), req.GetFullName(), req.GetTelegramName()))
+	errs.Check("date_of_birth", s.validator.DateOfBirth(req.GetDateOfBirth()))
+	errs.Check("full_name", s.validator.FullName(req.GetFullName()))
+	errs.Check("telegram_name", s.validator.TelegramName(req.GetTelegramName()))
+
+	// numbers are stored in E.164 so the unique constraint catches the same number written differently
+	phoneNumber, err := phone.Normalize(req.GetPhoneNumber())
+	errs.Check("phone_number", err)
+
+	if err := errs.Err(); err != nil {
+		return invalidArgument(err)
 	}
+	req.PhoneNumber = phoneNumber
+
 	return nil
 }
 
@@ -157,3 +739,40 @@ func validateEmailVerification(req *v1.EmailVerificationRequest) error {
 	}
 	return nil
 }
+
+func (s *serverAPI) validateResetPassword(req *v1.ResetPasswordRequest) error {
+	var errs validation.Errors
+
+	errs.Check("email", validation.Required(req.GetEmail()))
+	errs.Check("reset_code", validation.Required(req.GetResetCode()))
+	errs.Check("new_password", s.validator.Password(req.GetNewPassword(), req.GetEmail()))
+
+	if err := errs.Err(); err != nil {
+		return invalidArgument(err)
+	}
+	return nil
+}
+
+func (s *serverAPI) validateUpdateProfile(req *v1.UpdateProfileRequest) error {
+	var errs validation.Errors
+
+	if req.DateOfBirth != nil {
+		errs.Check("date_of_birth", s.validator.DateOfBirth(req.GetDateOfBirth()))
+	}
+	if req.FullName != nil {
+		errs.Check("full_name", s.validator.FullName(req.GetFullName()))
+	}
+	if req.PhoneNumber != nil {
+		phoneNumber, err := phone.Normalize(req.GetPhoneNumber())
+		errs.Check("phone_number", err)
+		req.PhoneNumber = &phoneNumber
+	}
+	if req.TelegramName != nil {
+		errs.Check("telegram_name", s.validator.TelegramName(req.GetTelegramName()))
+	}
+
+	if err := errs.Err(); err != nil {
+		return invalidArgument(err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+	"sso/sso/cmd/inter/lib/identity"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const authorizationHeader = "authorization"
+
+// bearerToken returns the caller token from the "authorization: Bearer <token>" metadata
+func bearerToken(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	values := md.Get(authorizationHeader)
+	if len(values) == 0 {
+		return "", status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	scheme, token, found := strings.Cut(values[0], " ")
+	if !found || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", status.Error(codes.Unauthenticated, "Token must be a bearer token")
+	}
+
+	return token, nil
+}
+
+// adminToken is bearerToken for the admin methods, a privileged service
+// authenticated by its client certificate may call them without a token
+func adminToken(ctx context.Context) (string, error) {
+	if _, ok := identity.PrivilegedService(ctx); ok {
+		return "", nil
+	}
+
+	return bearerToken(ctx)
+}
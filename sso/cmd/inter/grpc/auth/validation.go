@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"errors"
+	"sso/sso/cmd/inter/lib/validation"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// invalidArgument turns validation errors into an InvalidArgument status
+// with a BadRequest detail so clients can point at the exact fields.
+func invalidArgument(err error) error {
+	var fieldErrs validation.Errors
+	if !errors.As(err, &fieldErrs) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	br := &errdetails.BadRequest{}
+	for _, fe := range fieldErrs {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       fe.Field,
+			Description: fe.Description,
+		})
+	}
+
+	st, detailErr := status.New(codes.InvalidArgument, "invalid request").WithDetails(br)
+	if detailErr != nil {
+		return status.Error(codes.InvalidArgument, fieldErrs.Error())
+	}
+
+	return st.Err()
+}
+
+// passwordBreachedReason lets clients tell a breached password from other invalid input
+const passwordBreachedReason = "PASSWORD_BREACHED"
+
+// passwordBreached returns InvalidArgument with the PASSWORD_BREACHED reason
+// and a violation of the password field.
+func passwordBreached(field string) error {
+	const description = "this password has appeared in a data breach, choose another one"
+
+	st, err := status.New(codes.InvalidArgument, description).WithDetails(
+		&errdetails.ErrorInfo{
+			Reason: passwordBreachedReason,
+			Domain: "sso",
+		},
+		&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{
+				{Field: field, Description: description},
+			},
+		},
+	)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, description)
+	}
+
+	return st.Err()
+}
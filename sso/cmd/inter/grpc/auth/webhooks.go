@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/validation"
+	"sso/sso/cmd/inter/services/auth"
+	"sso/sso/cmd/inter/storage"
+	"strconv"
+
+	v1 "github.com/Foreground-Eclipse/testprotos/gen/go/sso"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var webhookDeliveryStatuses = []string{
+	models.WebhookDeliveryPending,
+	models.WebhookDeliveryDelivered,
+	models.WebhookDeliveryFailed,
+}
+
+func (s *serverAPI) CreateWebhookEndpoint(ctx context.Context,
+	req *v1.CreateWebhookEndpointRequest) (*v1.CreateWebhookEndpointResponse, error) {
+	token, err := adminToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.validateCreateWebhookEndpoint(req); err != nil {
+		return nil, err
+	}
+
+	endpoint, err := s.auth.CreateWebhookEndpoint(ctx, token, int(req.GetAppId()), req.GetUrl(), req.GetEventTypes())
+	if err != nil {
+		if st := webhookError(err); st != nil {
+			return nil, st
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &v1.CreateWebhookEndpointResponse{
+		Endpoint: webhookEndpointResponse(endpoint),
+		Secret:   endpoint.Secret,
+	}, nil
+}
+
+func (s *serverAPI) ListWebhookEndpoints(ctx context.Context,
+	req *v1.ListWebhookEndpointsRequest) (*v1.ListWebhookEndpointsResponse, error) {
+	token, err := adminToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetAppId() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "App id cant be negative")
+	}
+
+	endpoints, err := s.auth.WebhookEndpoints(ctx, token, int(req.GetAppId()), req.GetFailingOnly())
+	if err != nil {
+		if st := webhookError(err); st != nil {
+			return nil, st
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &v1.ListWebhookEndpointsResponse{
+		Endpoints: make([]*v1.WebhookEndpoint, 0, len(endpoints)),
+	}
+	for _, e := range endpoints {
+		resp.Endpoints = append(resp.Endpoints, webhookEndpointResponse(e))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) ListWebhookDeliveries(ctx context.Context,
+	req *v1.ListWebhookDeliveriesRequest) (*v1.ListWebhookDeliveriesResponse, error) {
+	token, err := adminToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetEndpointId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "Endpoint id cant be empty")
+	}
+	if req.GetStatus() != "" && !slices.Contains(webhookDeliveryStatuses, req.GetStatus()) {
+		return nil, status.Error(codes.InvalidArgument, "Status must be pending, delivered or failed")
+	}
+	if req.GetPageSize() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Page size cant be negative")
+	}
+
+	filter := models.WebhookDeliveryFilter{
+		EndpointID: req.GetEndpointId(),
+		Status:     req.GetStatus(),
+		Limit:      int(req.GetPageSize()),
+	}
+	if req.GetPageToken() != "" {
+		filter.BeforeID, err = strconv.ParseInt(req.GetPageToken(), 10, 64)
+		if err != nil || filter.BeforeID <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+	}
+
+	deliveries, next, err := s.auth.WebhookDeliveries(ctx, token, filter)
+	if err != nil {
+		if st := webhookError(err); st != nil {
+			return nil, st
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &v1.ListWebhookDeliveriesResponse{
+		Deliveries: make([]*v1.WebhookDelivery, 0, len(deliveries)),
+	}
+	for _, d := range deliveries {
+		resp.Deliveries = append(resp.Deliveries, &v1.WebhookDelivery{
+			Id:            d.ID,
+			EndpointId:    d.EndpointID,
+			EventId:       d.EventID,
+			Status:        d.Status,
+			Attempts:      int32(d.Attempts),
+			NextAttemptAt: d.NextAttemptAt.Unix(),
+			LastError:     d.LastError,
+			CreatedAt:     d.CreatedAt.Unix(),
+			UpdatedAt:     d.UpdatedAt.Unix(),
+		})
+	}
+	if next != 0 {
+		resp.NextPageToken = strconv.FormatInt(next, 10)
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) ReplayWebhookDeliveries(ctx context.Context,
+	req *v1.ReplayWebhookDeliveriesRequest) (*v1.ReplayWebhookDeliveriesResponse, error) {
+	token, err := adminToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetEndpointId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "Endpoint id cant be empty")
+	}
+	if req.GetDeliveryId() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Delivery id cant be negative")
+	}
+
+	replayed, err := s.auth.ReplayWebhookDeliveries(ctx, token, req.GetEndpointId(), req.GetDeliveryId())
+	if err != nil {
+		if st := webhookError(err); st != nil {
+			return nil, st
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &v1.ReplayWebhookDeliveriesResponse{Replayed: replayed}, nil
+}
+
+func (s *serverAPI) SetWebhookEndpointDisabled(ctx context.Context,
+	req *v1.SetWebhookEndpointDisabledRequest) (*v1.SetWebhookEndpointDisabledResponse, error) {
+	token, err := adminToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetEndpointId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "Endpoint id cant be empty")
+	}
+
+	if err := s.auth.SetWebhookEndpointDisabled(ctx, token, req.GetEndpointId(), req.GetDisabled()); err != nil {
+		if st := webhookError(err); st != nil {
+			return nil, st
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &v1.SetWebhookEndpointDisabledResponse{}, nil
+}
+
+// webhookError maps the errors the webhook admin calls share, nil means internal
+func webhookError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return status.Error(codes.Unauthenticated, "invalid token")
+	case errors.Is(err, auth.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, "admin rights required")
+	case errors.Is(err, storage.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	case errors.Is(err, storage.ErrWebhookEndpointNotFound):
+		return status.Error(codes.NotFound, "webhook endpoint not found")
+	case errors.Is(err, storage.ErrWebhookDeliveryNotFound):
+		return status.Error(codes.NotFound, "webhook delivery not found")
+	}
+	return nil
+}
+
+func webhookEndpointResponse(e models.WebhookEndpoint) *v1.WebhookEndpoint {
+	return &v1.WebhookEndpoint{
+		Id:                  e.ID,
+		AppId:               int32(e.AppID),
+		Url:                 e.URL,
+		EventTypes:          e.EventTypes,
+		Disabled:            e.Disabled,
+		ConsecutiveFailures: int32(e.ConsecutiveFailures),
+		CreatedAt:           e.CreatedAt.Unix(),
+	}
+}
+
+func (s *serverAPI) validateCreateWebhookEndpoint(req *v1.CreateWebhookEndpointRequest) error {
+	var errs validation.Errors
+
+	if req.GetAppId() <= 0 {
+		errs.Check("app_id", errors.New("must be a positive app id"))
+	}
+	errs.Check("url", s.validator.WebhookURL(req.GetUrl()))
+	errs.Check("event_types", validation.Subset(req.GetEventTypes(), models.UserEventTypes))
+
+	if err := errs.Err(); err != nil {
+		return invalidArgument(err)
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"sso/sso/cmd/inter/domain/models"
 
 	"time"
@@ -8,7 +12,21 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+var ErrInvalidToken = errors.New("invalid token")
+
+type Claims struct {
+	UserID int64
+	Email  string
+	AppID  int
+}
+
 func NewToken(user models.User, app models.App, duration time.Duration) (string, error) {
+	// jti keeps tokens issued in the same second unique, sessions are looked up by token
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
 	token := jwt.New(jwt.SigningMethodHS256)
 
 	claims := token.Claims.(jwt.MapClaims)
@@ -16,6 +34,7 @@ func NewToken(user models.User, app models.App, duration time.Duration) (string,
 	claims["email"] = user.Email
 	claims["exp"] = time.Now().Add(duration).Unix()
 	claims["app_id"] = app.ID
+	claims["jti"] = hex.EncodeToString(jti)
 
 	tokenString, err := token.SignedString([]byte(app.Secret))
 	if err != nil {
@@ -24,3 +43,44 @@ func NewToken(user models.User, app models.App, duration time.Duration) (string,
 
 	return tokenString, nil
 }
+
+// ParseToken verifies the token with the secret of the app it was issued for
+// and returns its claims, appSecret is called with the app_id claim.
+func ParseToken(tokenString string, appSecret func(appID int) (string, error)) (Claims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+
+		appID, ok := claims["app_id"].(float64)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+
+		secret, err := appSecret(int(appID))
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	uid, ok := claims["uid"].(float64)
+	if !ok {
+		return Claims{}, ErrInvalidToken
+	}
+	email, _ := claims["email"].(string)
+	appID, _ := claims["app_id"].(float64)
+
+	return Claims{
+		UserID: int64(uid),
+		Email:  email,
+		AppID:  int(appID),
+	}, nil
+}
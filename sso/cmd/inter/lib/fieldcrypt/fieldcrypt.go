@@ -0,0 +1,287 @@
+package fieldcrypt
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	keySize = 32
+	// prefix marks encrypted values so rows written before the encryption are still read as they are
+	prefix = "enc:v1:"
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown master key")
+	ErrDecrypt    = errors.New("failed to decrypt")
+)
+
+// MasterKey wraps the data keys of the rows, ID is stored next to every wrapped key.
+type MasterKey struct {
+	ID  string
+	Key []byte
+}
+
+// Keyring encrypts fields with envelope encryption: every row has its own
+// AES-256-GCM data key which is stored wrapped by a master key. Old master
+// keys are kept to unwrap the rows that have not been rotated yet.
+type Keyring struct {
+	primary  MasterKey
+	masters  map[string][]byte
+	indexKey []byte
+}
+
+// NewKeyring returns a keyring that wraps new data keys with the first master key.
+// indexKey is the HMAC key of the blind indexes.
+func NewKeyring(masterKeys []MasterKey, indexKey []byte) (*Keyring, error) {
+	const op = "fieldcrypt.NewKeyring"
+
+	if len(masterKeys) == 0 {
+		return nil, fmt.Errorf("%s: no master keys", op)
+	}
+	if len(indexKey) < keySize {
+		return nil, fmt.Errorf("%s: index key must be at least %d bytes", op, keySize)
+	}
+
+	masters := make(map[string][]byte, len(masterKeys))
+	for _, mk := range masterKeys {
+		if mk.ID == "" {
+			return nil, fmt.Errorf("%s: master key id cant be empty", op)
+		}
+		if len(mk.Key) != keySize {
+			return nil, fmt.Errorf("%s: master key %q must be %d bytes", op, mk.ID, keySize)
+		}
+		if _, ok := masters[mk.ID]; ok {
+			return nil, fmt.Errorf("%s: duplicate master key %q", op, mk.ID)
+		}
+		masters[mk.ID] = mk.Key
+	}
+
+	return &Keyring{
+		primary:  masterKeys[0],
+		masters:  masters,
+		indexKey: indexKey,
+	}, nil
+}
+
+// ParseKeys parses "id:base64 key" pairs separated by commas or new lines,
+// empty lines and lines starting with # are skipped.
+func ParseKeys(s string) ([]MasterKey, error) {
+	const op = "fieldcrypt.ParseKeys"
+
+	var keys []MasterKey
+	scanner := bufio.NewScanner(strings.NewReader(strings.ReplaceAll(s, ",", "\n")))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id, encoded, found := strings.Cut(line, ":")
+		if !found {
+			// the line is not quoted, it may be a bare key
+			return nil, fmt.Errorf("%s: entry %d: expected id:key", op, n)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %q is not base64: %w", op, id, err)
+		}
+
+		keys = append(keys, MasterKey{ID: strings.TrimSpace(id), Key: key})
+	}
+
+	return keys, scanner.Err()
+}
+
+// LoadKeyFile reads the master keys from a file in the ParseKeys format.
+func LoadKeyFile(path string) ([]MasterKey, error) {
+	const op = "fieldcrypt.LoadKeyFile"
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	keys, err := ParseKeys(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+// Load builds the keyring from the master keys, or the key file when it is set,
+// and the base64 index key. It returns nil if no master keys are configured.
+func Load(masterKeys string, keyFile string, indexKey string) (*Keyring, error) {
+	const op = "fieldcrypt.Load"
+
+	var (
+		keys []MasterKey
+		err  error
+	)
+	if keyFile != "" {
+		keys, err = LoadKeyFile(keyFile)
+	} else {
+		keys, err = ParseKeys(masterKeys)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	index, err := base64.StdEncoding.DecodeString(strings.TrimSpace(indexKey))
+	if err != nil {
+		return nil, fmt.Errorf("%s: index key is not base64: %w", op, err)
+	}
+
+	keyring, err := NewKeyring(keys, index)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keyring, nil
+}
+
+// PrimaryKeyID is the id of the master key new data keys are wrapped with.
+func (k *Keyring) PrimaryKeyID() string {
+	return k.primary.ID
+}
+
+// NewDataKey returns a random data key and the key wrapped by the primary
+// master key. The wrapped key is bound to owner, like "user:42", so it can't
+// be moved to another row.
+func (k *Keyring) NewDataKey(owner string) (dataKey []byte, wrapped []byte, keyID string, err error) {
+	dataKey = make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, "", err
+	}
+
+	wrapped, err = seal(k.primary.Key, dataKey, additionalData(k.primary.ID, owner))
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	return dataKey, wrapped, k.primary.ID, nil
+}
+
+// UnwrapDataKey returns the data key of owner wrapped by the master key keyID.
+func (k *Keyring) UnwrapDataKey(keyID string, owner string, wrapped []byte) ([]byte, error) {
+	master, ok := k.masters[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+
+	return open(master, wrapped, additionalData(keyID, owner))
+}
+
+// BlindIndex returns the HMAC of the value for equality lookups, field keeps
+// equal values of different fields apart.
+func (k *Keyring) BlindIndex(field string, value string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Encrypt encrypts the value of the field of owner with the data key, empty
+// values are kept empty. The ciphertext is bound to both so it can't be
+// moved to another field or row.
+func Encrypt(dataKey []byte, owner string, field string, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	sealed, err := seal(dataKey, []byte(value), additionalData(owner, field))
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of a value made by Encrypt, values without
+// the encryption prefix are returned as they are.
+func Decrypt(dataKey []byte, owner string, field string, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+
+	plaintext, err := open(dataKey, sealed, additionalData(owner, field))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether the value was made by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// additionalData joins the parts the ciphertext is bound to, the separator
+// keeps "a", "bc" apart from "ab", "c"
+func additionalData(parts ...string) []byte {
+	return []byte(strings.Join(parts, "\x00"))
+}
+
+// seal returns nonce | ciphertext
+func seal(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key []byte, sealed []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,244 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, keySize)
+}
+
+func newTestKeyring(t *testing.T, masterKeys ...MasterKey) *Keyring {
+	t.Helper()
+
+	k, err := NewKeyring(masterKeys, testKey(0xee))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return k
+}
+
+func TestRoundTrip(t *testing.T) {
+	k := newTestKeyring(t, MasterKey{ID: "k1", Key: testKey(1)})
+
+	dataKey, wrapped, keyID, err := k.NewDataKey("user:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != "k1" {
+		t.Errorf("keyID = %q, want the primary key", keyID)
+	}
+
+	unwrapped, err := k.UnwrapDataKey(keyID, "user:1", wrapped)
+	if err != nil {
+		t.Fatalf("UnwrapDataKey() error = %v", err)
+	}
+	if !bytes.Equal(unwrapped, dataKey) {
+		t.Fatal("unwrapped data key differs")
+	}
+
+	for _, value := range []string{"bob@example.com", "Иван Петров", "+14155552671"} {
+		sealed, err := Encrypt(dataKey, "user:1", "email", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(sealed) || strings.Contains(sealed, value) {
+			t.Errorf("Encrypt(%q) = %q, want ciphertext", value, sealed)
+		}
+
+		again, _ := Encrypt(dataKey, "user:1", "email", value)
+		if again == sealed {
+			t.Errorf("Encrypt(%q) is deterministic, want a random nonce", value)
+		}
+
+		got, err := Decrypt(dataKey, "user:1", "email", sealed)
+		if err != nil || got != value {
+			t.Errorf("Decrypt() = %q, %v, want %q", got, err, value)
+		}
+	}
+}
+
+func TestEmptyAndPlaintextValues(t *testing.T) {
+	dataKey := testKey(7)
+
+	sealed, err := Encrypt(dataKey, "user:1", "full_name", "")
+	if err != nil || sealed != "" {
+		t.Errorf("Encrypt(\"\") = %q, %v, want it empty", sealed, err)
+	}
+
+	// rows written before the encryption are read as they are
+	got, err := Decrypt(dataKey, "user:1", "email", "bob@example.com")
+	if err != nil || got != "bob@example.com" {
+		t.Errorf("Decrypt(plaintext) = %q, %v", got, err)
+	}
+
+	if _, err := Decrypt(dataKey, "user:1", "email", prefix+"not base64!"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Decrypt(garbage) error = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestCiphertextIsBound(t *testing.T) {
+	k := newTestKeyring(t, MasterKey{ID: "k1", Key: testKey(1)})
+
+	dataKey, wrapped, keyID, err := k.NewDataKey("user:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := Encrypt(dataKey, "user:1", "email", "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		owner string
+		field string
+		key   []byte
+	}{
+		{name: "other field", owner: "user:1", field: "phone_number", key: dataKey},
+		{name: "other row", owner: "user:2", field: "email", key: dataKey},
+		{name: "other data key", owner: "user:1", field: "email", key: testKey(9)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decrypt(tt.key, tt.owner, tt.field, sealed); !errors.Is(err, ErrDecrypt) {
+				t.Errorf("Decrypt() error = %v, want ErrDecrypt", err)
+			}
+		})
+	}
+
+	// a wrapped key copied to another row doesn't unwrap there
+	if _, err := k.UnwrapDataKey(keyID, "user:2", wrapped); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("UnwrapDataKey(other owner) error = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old := MasterKey{ID: "k1", Key: testKey(1)}
+	current := MasterKey{ID: "k2", Key: testKey(2)}
+
+	before := newTestKeyring(t, old)
+	_, wrappedOld, oldID, err := before.NewDataKey("user:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the new primary key goes first, the old one still unwraps the rows that aren't rotated yet
+	after := newTestKeyring(t, current, old)
+	if after.PrimaryKeyID() != "k2" {
+		t.Errorf("PrimaryKeyID() = %q, want k2", after.PrimaryKeyID())
+	}
+	if _, err := after.UnwrapDataKey(oldID, "user:1", wrappedOld); err != nil {
+		t.Errorf("UnwrapDataKey(old key) error = %v", err)
+	}
+
+	_, wrappedNew, newID, err := after.NewDataKey("user:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newID != "k2" {
+		t.Errorf("new data key wrapped by %q, want k2", newID)
+	}
+
+	// once the old key is dropped its rows can't be read, the new ones can
+	retired := newTestKeyring(t, current)
+	if _, err := retired.UnwrapDataKey(oldID, "user:1", wrappedOld); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("UnwrapDataKey(removed key) error = %v, want ErrUnknownKey", err)
+	}
+	if _, err := retired.UnwrapDataKey(newID, "user:1", wrappedNew); err != nil {
+		t.Errorf("UnwrapDataKey(new key) error = %v", err)
+	}
+
+	// a key id pointing at another master key doesn't unwrap
+	if _, err := after.UnwrapDataKey("k2", "user:1", wrappedOld); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("UnwrapDataKey(wrong key id) error = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	k := newTestKeyring(t, MasterKey{ID: "k1", Key: testKey(1)})
+
+	if k.BlindIndex("email", "bob@example.com") != k.BlindIndex("email", "bob@example.com") {
+		t.Error("BlindIndex is not deterministic")
+	}
+	if k.BlindIndex("email", "x") == k.BlindIndex("phone_number", "x") {
+		t.Error("BlindIndex of different fields collide")
+	}
+
+	other, err := NewKeyring([]MasterKey{{ID: "k1", Key: testKey(1)}}, testKey(0xdd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.BlindIndex("email", "x") == other.BlindIndex("email", "x") {
+		t.Error("BlindIndex doesn't depend on the index key")
+	}
+}
+
+func TestNewKeyringErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []MasterKey
+		indexKey []byte
+		wantErr  string
+	}{
+		{name: "no keys", indexKey: testKey(0xee), wantErr: "no master keys"},
+		{name: "short index key", keys: []MasterKey{{ID: "k1", Key: testKey(1)}}, indexKey: []byte("short"), wantErr: "index key"},
+		{name: "empty id", keys: []MasterKey{{Key: testKey(1)}}, indexKey: testKey(0xee), wantErr: "id cant be empty"},
+		{name: "short key", keys: []MasterKey{{ID: "k1", Key: []byte("short")}}, indexKey: testKey(0xee), wantErr: "32 bytes"},
+		{name: "duplicate", keys: []MasterKey{{ID: "k1", Key: testKey(1)}, {ID: "k1", Key: testKey(2)}}, indexKey: testKey(0xee), wantErr: "duplicate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeyring(tt.keys, tt.indexKey); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("NewKeyring() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	k1 := base64.StdEncoding.EncodeToString(testKey(1))
+	k2 := base64.StdEncoding.EncodeToString(testKey(2))
+	index := base64.StdEncoding.EncodeToString(testKey(0xee))
+
+	keys, err := Load("k2:"+k2+", k1:"+k1, "", index)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if keys.PrimaryKeyID() != "k2" {
+		t.Errorf("PrimaryKeyID() = %q, want the first key", keys.PrimaryKeyID())
+	}
+
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte("# rotated in june\nk2:"+k2+"\n\nk1:"+k1+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fromFile, err := Load("ignored", path, index)
+	if err != nil {
+		t.Fatalf("Load(key file) error = %v", err)
+	}
+	if fromFile.PrimaryKeyID() != "k2" || len(fromFile.masters) != 2 {
+		t.Errorf("Load(key file) = %q with %d keys, want k2 with 2", fromFile.PrimaryKeyID(), len(fromFile.masters))
+	}
+
+	if keys, err := Load("", "", ""); keys != nil || err != nil {
+		t.Errorf("Load(nothing) = %v, %v, want no keyring", keys, err)
+	}
+	if _, err := Load(k1, "", index); err == nil {
+		t.Error("Load(bare key) error = nil, want id:key")
+	}
+	if _, err := Load("k1:not base64!", "", index); err == nil {
+		t.Error("Load(bad key) error = nil")
+	}
+	if _, err := Load("k1:"+k1, "", "not base64!"); err == nil {
+		t.Error("Load(bad index key) error = nil")
+	}
+}
@@ -0,0 +1,27 @@
+package httpserver
+
+import (
+	"net/http"
+	"time"
+)
+
+// Params bound the connections of a server, a timeout of 0 is no timeout.
+type Params struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout is how long the requests in flight have to finish on shutdown
+	ShutdownTimeout time.Duration
+}
+
+// New returns a server of handler with the timeouts of params.
+func New(handler http.Handler, params Params) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: params.ReadHeaderTimeout,
+		ReadTimeout:       params.ReadTimeout,
+		WriteTimeout:      params.WriteTimeout,
+		IdleTimeout:       params.IdleTimeout,
+	}
+}
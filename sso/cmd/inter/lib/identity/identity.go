@@ -0,0 +1,31 @@
+package identity
+
+import "context"
+
+// Service is a caller authenticated by a verified client certificate.
+type Service struct {
+	// Name is the common name of the certificate
+	Name string
+	// Privileged services can call the admin methods without a user token
+	Privileged bool
+}
+
+type serviceKey struct{}
+
+// WithService returns a copy of ctx carrying the service.
+func WithService(ctx context.Context, service Service) context.Context {
+	return context.WithValue(ctx, serviceKey{}, service)
+}
+
+// ServiceFromContext returns the service stored by WithService, ok is false
+// if the caller has no verified client certificate.
+func ServiceFromContext(ctx context.Context) (service Service, ok bool) {
+	service, ok = ctx.Value(serviceKey{}).(Service)
+	return service, ok
+}
+
+// PrivilegedService returns the caller if it is a privileged service.
+func PrivilegedService(ctx context.Context) (Service, bool) {
+	service, ok := ServiceFromContext(ctx)
+	return service, ok && service.Privileged
+}
@@ -0,0 +1,21 @@
+package logctx
+
+import (
+	"context"
+	"log/slog"
+)
+
+type loggerKey struct{}
+
+// With returns a copy of ctx carrying log, e.g. a logger with the request id.
+func With(ctx context.Context, log *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, log)
+}
+
+// From returns the logger stored by With, or fallback if there is none.
+func From(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if log, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return log
+	}
+	return fallback
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "sso"
+
+// Registry holds the metrics of the service, it is served by Handler
+var Registry = prometheus.NewRegistry()
+
+var (
+	rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "Duration of the handled gRPC requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	rpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_requests_total",
+		Help:      "Handled gRPC requests by status code.",
+	}, []string{"method", "code"})
+
+	loginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_attempts_total",
+		Help:      "Login attempts by outcome and reason.",
+	}, []string{"outcome", "reason"})
+
+	passwordHashDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "password_hash_duration_seconds",
+		Help:      "Duration of hashing and verifying passwords.",
+		// hashing is meant to be slow, the default buckets are too fine for it
+		Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"algorithm", "operation"})
+
+	codesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "verification_codes_sent_total",
+		Help:      "Verification codes sent by purpose, channel and outcome.",
+	}, []string{"purpose", "channel", "outcome"})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_query_duration_seconds",
+		Help:      "Duration of the storage operations.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"op"})
+
+	configReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_reloads_total",
+		Help:      "Config reloads by outcome.",
+	}, []string{"outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		rpcDuration,
+		rpcRequests,
+		loginAttempts,
+		passwordHashDuration,
+		codesSent,
+		queryDuration,
+		configReloads,
+	)
+}
+
+// Handler serves the metrics in the prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRPC records a handled gRPC request, code is its status code
+func ObserveRPC(method string, code string, duration time.Duration) {
+	rpcDuration.WithLabelValues(method).Observe(duration.Seconds())
+	rpcRequests.WithLabelValues(method, code).Inc()
+}
+
+// LoginAttempt counts a login attempt, reason must be one of a few fixed values
+func LoginAttempt(outcome string, reason string) {
+	loginAttempts.WithLabelValues(outcome, reason).Inc()
+}
+
+// ObservePasswordHash records how long hashing or verifying a password took
+func ObservePasswordHash(algorithm string, operation string, start time.Time) {
+	passwordHashDuration.WithLabelValues(algorithm, operation).Observe(time.Since(start).Seconds())
+}
+
+// CodeSent counts a sent verification code, err is the error of sending it
+func CodeSent(purpose string, channel string, err error) {
+	outcome := "sent"
+	if err != nil {
+		outcome = "failed"
+	}
+
+	codesSent.WithLabelValues(purpose, channel, outcome).Inc()
+}
+
+// ObserveQuery records how long the storage operation op took, it is meant to be deferred
+func ObserveQuery(op string, start time.Time) {
+	queryDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+// ConfigReload counts a reload of the config, outcome is "success", "restart_required" or "failure"
+func ConfigReload(outcome string) {
+	configReloads.WithLabelValues(outcome).Inc()
+}
@@ -0,0 +1,31 @@
+package notify
+
+import "sync"
+
+// Broadcaster wakes up every waiter at once, e.g. when new rows are written
+// that several readers poll for.
+type Broadcaster struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{ch: make(chan struct{})}
+}
+
+// Wait returns a channel that is closed by the next Notify.
+func (b *Broadcaster) Wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.ch
+}
+
+// Notify wakes up everyone waiting.
+func (b *Broadcaster) Notify() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	close(b.ch)
+	b.ch = make(chan struct{})
+}
@@ -0,0 +1,212 @@
+package passhash
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sso/sso/cmd/inter/lib/metrics"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+var (
+	ErrMismatch          = errors.New("password does not match the hash")
+	ErrUnknownAlgorithm  = errors.New("unknown hash algorithm")
+	ErrMalformedHash     = errors.New("malformed hash")
+	ErrUnsupportedParams = errors.New("unsupported hash parameters")
+)
+
+// Params are the algorithm and cost new hashes are made with.
+type Params struct {
+	Algorithm  string
+	BcryptCost int
+	// Argon2Memory is in KiB
+	Argon2Memory  uint32
+	Argon2Time    uint32
+	Argon2Threads uint8
+	Argon2SaltLen uint32
+	Argon2KeyLen  uint32
+}
+
+// Hasher makes and verifies self-describing password hashes.
+//
+// argon2id hashes are PHC strings, e.g. "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>".
+// bcrypt hashes keep the modular crypt format "$2a$10$<salt><hash>" which
+// already carries its cost, so the hashes stored before the upgrade are
+// verified as they are.
+type Hasher struct {
+	params Params
+}
+
+// New returns a new instance of the hasher
+func New(params Params) (*Hasher, error) {
+	const op = "passhash.New"
+
+	switch params.Algorithm {
+	case AlgorithmBcrypt:
+		if params.BcryptCost < bcrypt.MinCost || params.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("%s: bcrypt cost must be between %d and %d", op, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case AlgorithmArgon2id:
+		if params.Argon2Memory == 0 || params.Argon2Time == 0 || params.Argon2Threads == 0 {
+			return nil, fmt.Errorf("%s: argon2id memory, time and threads must be positive", op)
+		}
+		if params.Argon2SaltLen < 8 || params.Argon2KeyLen < 16 {
+			return nil, fmt.Errorf("%s: argon2id salt must be at least 8 bytes and key at least 16 bytes", op)
+		}
+	default:
+		return nil, fmt.Errorf("%s: %w: %q", op, ErrUnknownAlgorithm, params.Algorithm)
+	}
+
+	return &Hasher{params: params}, nil
+}
+
+// Hash hashes the password with the configured algorithm.
+func (h *Hasher) Hash(password string) ([]byte, error) {
+	const op = "passhash.Hash"
+
+	defer metrics.ObservePasswordHash(h.params.Algorithm, "hash", time.Now())
+
+	if h.params.Algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.params.BcryptCost)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return hash, nil
+	}
+
+	salt := make([]byte, h.params.Argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	p := argon2Params{
+		memory:  h.params.Argon2Memory,
+		time:    h.params.Argon2Time,
+		threads: h.params.Argon2Threads,
+	}
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, h.params.Argon2KeyLen)
+
+	return []byte(p.encode(salt, key)), nil
+}
+
+// Verify checks the password against a hash made by any supported algorithm.
+// needsRehash reports that the hash was made with other params than the
+// configured ones and should be replaced while the password is at hand.
+func (h *Hasher) Verify(hash []byte, password string) (needsRehash bool, err error) {
+	const op = "passhash.Verify"
+
+	switch {
+	case isBcrypt(hash):
+		defer metrics.ObservePasswordHash(AlgorithmBcrypt, "verify", time.Now())
+
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, fmt.Errorf("%s: %w", op, ErrMismatch)
+			}
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if h.params.Algorithm != AlgorithmBcrypt {
+			return true, nil
+		}
+		cost, err := bcrypt.Cost(hash)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+		return cost != h.params.BcryptCost, nil
+
+	case bytes.HasPrefix(hash, []byte("$"+AlgorithmArgon2id+"$")):
+		defer metrics.ObservePasswordHash(AlgorithmArgon2id, "verify", time.Now())
+
+		p, salt, key, err := decodeArgon2(string(hash))
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		other := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, fmt.Errorf("%s: %w", op, ErrMismatch)
+		}
+
+		return h.params.Algorithm != AlgorithmArgon2id ||
+			p.memory != h.params.Argon2Memory ||
+			p.time != h.params.Argon2Time ||
+			p.threads != h.params.Argon2Threads ||
+			uint32(len(salt)) != h.params.Argon2SaltLen ||
+			uint32(len(key)) != h.params.Argon2KeyLen, nil
+
+	default:
+		return false, fmt.Errorf("%s: %w", op, ErrUnknownAlgorithm)
+	}
+}
+
+func isBcrypt(hash []byte) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if bytes.HasPrefix(hash, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+func (p argon2Params) encode(salt []byte, key []byte) string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		AlgorithmArgon2id, argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2(hash string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, ErrMalformedHash
+	}
+	if version != argon2.Version {
+		return p, nil, nil, ErrUnsupportedParams
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, ErrMalformedHash
+	}
+	if p.memory == 0 || p.time == 0 || p.threads == 0 {
+		return p, nil, nil, ErrUnsupportedParams
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrMalformedHash
+	}
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,216 @@
+package passhash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testPassword = "Tarquinius.Blumenfeld"
+
+// small params keep the tests fast, the format is the same
+var (
+	testArgon2 = Params{
+		Algorithm:     AlgorithmArgon2id,
+		Argon2Memory:  64,
+		Argon2Time:    1,
+		Argon2Threads: 1,
+		Argon2SaltLen: 16,
+		Argon2KeyLen:  32,
+	}
+	testBcrypt = Params{Algorithm: AlgorithmBcrypt, BcryptCost: 4}
+)
+
+func newHasher(t *testing.T, params Params) *Hasher {
+	t.Helper()
+
+	h, err := New(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func hash(t *testing.T, params Params) string {
+	t.Helper()
+
+	hash, err := newHasher(t, params).Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	h := newHasher(t, testArgon2)
+
+	first, err := h.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(first), "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Hash() = %q, want a PHC string with the params", first)
+	}
+
+	second, err := h.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first) == string(second) {
+		t.Error("two hashes of the password are equal, the salt isn't random")
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  error
+	}{
+		{name: "right password", password: testPassword},
+		{name: "wrong password", password: "Wrong.Blumenfeld", wantErr: ErrMismatch},
+		{name: "empty password", password: "", wantErr: ErrMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			needsRehash, err := h.Verify(first, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if needsRehash {
+				t.Error("Verify() needsRehash = true for the configured params")
+			}
+		})
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	valid := hash(t, testArgon2)
+	parts := strings.Split(valid, "$")
+
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr error
+	}{
+		{name: "empty", hash: "", wantErr: ErrUnknownAlgorithm},
+		{name: "unknown algorithm", hash: "$scrypt$ln=16,r=8,p=1$c2FsdA$a2V5", wantErr: ErrUnknownAlgorithm},
+		{name: "argon2i", hash: strings.Replace(valid, "$argon2id$", "$argon2i$", 1), wantErr: ErrUnknownAlgorithm},
+		{name: "truncated key", hash: strings.Join(parts[:5], "$") + "$", wantErr: ErrMalformedHash},
+		{name: "missing key", hash: strings.Join(parts[:5], "$"), wantErr: ErrMalformedHash},
+		{name: "prefix only", hash: "$argon2id$", wantErr: ErrMalformedHash},
+		{name: "extra part", hash: valid + "$AAAA", wantErr: ErrMalformedHash},
+		{name: "no version", hash: strings.Replace(valid, "v=19", "19", 1), wantErr: ErrMalformedHash},
+		{name: "other version", hash: strings.Replace(valid, "v=19", "v=16", 1), wantErr: ErrUnsupportedParams},
+		{name: "params not numbers", hash: strings.Replace(valid, "m=64", "m=lots", 1), wantErr: ErrMalformedHash},
+		{name: "zero memory", hash: strings.Replace(valid, "m=64", "m=0", 1), wantErr: ErrUnsupportedParams},
+		{name: "salt not base64", hash: strings.Replace(valid, parts[4], "!!!!", 1), wantErr: ErrMalformedHash},
+		{name: "key not base64", hash: strings.Replace(valid, parts[5], "????", 1), wantErr: ErrMalformedHash},
+	}
+	h := newHasher(t, testArgon2)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.Verify([]byte(tt.hash), testPassword)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify(%q) error = %v, want %v", tt.hash, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyLegacyBcrypt(t *testing.T) {
+	// the hashes stored before the upgrade are bcrypt in the modular crypt
+	// format, all its variants are accepted
+	legacy := hash(t, testBcrypt)
+	if !strings.HasPrefix(legacy, "$2a$04$") {
+		t.Fatalf("Hash() = %q, want a $2a$ bcrypt hash", legacy)
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		wantErr  error
+	}{
+		{name: "2a", hash: legacy, password: testPassword},
+		{name: "2b", hash: "$2b$" + legacy[4:], password: testPassword},
+		{name: "2y", hash: "$2y$" + legacy[4:], password: testPassword},
+		{name: "wrong password", hash: legacy, password: "Wrong.Blumenfeld", wantErr: ErrMismatch},
+		{name: "2x is not bcrypt", hash: "$2x$" + legacy[4:], password: testPassword, wantErr: ErrUnknownAlgorithm},
+	}
+	// verified by a hasher configured for argon2id like after the upgrade
+	h := newHasher(t, testArgon2)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.Verify([]byte(tt.hash), tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := h.Verify([]byte(legacy[:20]), testPassword)
+		if err == nil || errors.Is(err, ErrMismatch) {
+			t.Fatalf("Verify() error = %v, want a malformed hash error", err)
+		}
+	})
+}
+
+func TestNeedsRehash(t *testing.T) {
+	withArgon2 := func(change func(p *Params)) Params {
+		p := testArgon2
+		change(&p)
+		return p
+	}
+
+	tests := []struct {
+		name   string
+		hashed Params
+		// configured are the params of the hasher verifying the hash
+		configured Params
+		want       bool
+	}{
+		{name: "same argon2id params", hashed: testArgon2, configured: testArgon2, want: false},
+		{name: "argon2id memory raised", hashed: testArgon2, configured: withArgon2(func(p *Params) { p.Argon2Memory = 128 }), want: true},
+		{name: "argon2id time raised", hashed: testArgon2, configured: withArgon2(func(p *Params) { p.Argon2Time = 2 }), want: true},
+		{name: "argon2id threads changed", hashed: testArgon2, configured: withArgon2(func(p *Params) { p.Argon2Threads = 2 }), want: true},
+		{name: "argon2id salt length changed", hashed: testArgon2, configured: withArgon2(func(p *Params) { p.Argon2SaltLen = 32 }), want: true},
+		{name: "argon2id key length changed", hashed: testArgon2, configured: withArgon2(func(p *Params) { p.Argon2KeyLen = 64 }), want: true},
+		{name: "argon2id to bcrypt", hashed: testArgon2, configured: testBcrypt, want: true},
+		{name: "same bcrypt cost", hashed: testBcrypt, configured: testBcrypt, want: false},
+		{name: "bcrypt cost raised", hashed: testBcrypt, configured: Params{Algorithm: AlgorithmBcrypt, BcryptCost: 5}, want: true},
+		{name: "bcrypt to argon2id", hashed: testBcrypt, configured: testArgon2, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHasher(t, tt.configured)
+
+			needsRehash, err := h.Verify([]byte(hash(t, tt.hashed)), testPassword)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if needsRehash != tt.want {
+				t.Errorf("Verify() needsRehash = %v, want %v", needsRehash, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		params Params
+	}{
+		{name: "unknown algorithm", params: Params{Algorithm: "md5"}},
+		{name: "bcrypt cost too low", params: Params{Algorithm: AlgorithmBcrypt, BcryptCost: 3}},
+		{name: "bcrypt cost too high", params: Params{Algorithm: AlgorithmBcrypt, BcryptCost: 32}},
+		{name: "argon2id without memory", params: Params{Algorithm: AlgorithmArgon2id, Argon2Time: 1, Argon2Threads: 1, Argon2SaltLen: 16, Argon2KeyLen: 32}},
+		{name: "argon2id short salt", params: Params{Algorithm: AlgorithmArgon2id, Argon2Memory: 64, Argon2Time: 1, Argon2Threads: 1, Argon2SaltLen: 4, Argon2KeyLen: 32}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.params); err == nil {
+				t.Fatal("New() error = nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package phone
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	minDigits = 8
+	// maxDigits is the E.164 limit including the country code
+	maxDigits = 15
+)
+
+var ErrInvalidNumber = errors.New("phone number must be in international format, e.g. +14155552671")
+
+// Normalize turns a phone number in international format into E.164, i.e. "+" followed by digits.
+// Spaces, dashes, dots and brackets are dropped and the "00" international prefix is accepted.
+func Normalize(raw string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(raw) {
+		switch {
+		case r >= '0' && r <= '9', r == '+':
+			b.WriteRune(r)
+		case r == ' ', r == '-', r == '.', r == '(', r == ')':
+		default:
+			return "", ErrInvalidNumber
+		}
+	}
+
+	number := b.String()
+	if strings.HasPrefix(number, "00") {
+		number = "+" + number[2:]
+	}
+
+	digits, ok := strings.CutPrefix(number, "+")
+	if !ok || strings.Contains(digits, "+") {
+		return "", ErrInvalidNumber
+	}
+	if len(digits) < minDigits || len(digits) > maxDigits || digits[0] == '0' {
+		return "", ErrInvalidNumber
+	}
+
+	return "+" + digits, nil
+}
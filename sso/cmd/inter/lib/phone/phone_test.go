@@ -0,0 +1,41 @@
+package phone
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+		err  error
+	}{
+		{name: "e164", raw: "+14155552671", want: "+14155552671"},
+		{name: "separators", raw: " +1 (415) 555-26.71 ", want: "+14155552671"},
+		{name: "international prefix", raw: "0044 20 7946 0958", want: "+442079460958"},
+		{name: "max digits", raw: "+123456789012345", want: "+123456789012345"},
+		{name: "min digits", raw: "+12345678", want: "+12345678"},
+		{name: "no plus", raw: "14155552671", err: ErrInvalidNumber},
+		{name: "national", raw: "8 (912) 345-67-89", err: ErrInvalidNumber},
+		{name: "leading zero", raw: "+04155552671", err: ErrInvalidNumber},
+		{name: "too short", raw: "+1234567", err: ErrInvalidNumber},
+		{name: "too long", raw: "+1234567890123456", err: ErrInvalidNumber},
+		{name: "second plus", raw: "+1415+5552671", err: ErrInvalidNumber},
+		{name: "letters", raw: "+1415555CALL", err: ErrInvalidNumber},
+		{name: "empty", raw: "", err: ErrInvalidNumber},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.raw)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Normalize(%q) error = %v, want %v", tt.raw, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
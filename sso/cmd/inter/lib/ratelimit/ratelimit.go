@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the buckets that refilled are dropped
+const sweepInterval = time.Minute
+
+// Rule is a token bucket refilled at Rate tokens a second up to Burst, a
+// Rate of 0 means no limit.
+type Rule struct {
+	Rate  float64
+	Burst int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps a token bucket per key, like the address of a client.
+type Limiter struct {
+	rule Rule
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func New(rule Rule) *Limiter {
+	return &Limiter{
+		rule:      rule,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of key and reports if there was one.
+func (l *Limiter) Allow(key string) bool {
+	if l.rule.Rate <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rule.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(float64(l.rule.Burst), b.tokens+now.Sub(b.last).Seconds()*l.rule.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// sweep drops the buckets that are full again, they are the same as new ones
+func (l *Limiter) sweep(now time.Time) {
+	full := time.Duration(float64(l.rule.Burst) / l.rule.Rate * float64(time.Second))
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
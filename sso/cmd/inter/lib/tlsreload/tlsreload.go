@@ -0,0 +1,188 @@
+package tlsreload
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader serves the certificate and the client CAs read from files and
+// reloads them when the files change, so renewed certificates are picked up
+// without a restart.
+type Reloader struct {
+	log          *slog.Logger
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	clientAuth   tls.ClientAuthType
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+// New loads the files, clientCAFile enables mutual TLS: a client certificate
+// signed by one of its CAs is required, or only verified if the client sends
+// one when clientCertOptional is set.
+func New(log *slog.Logger, certFile string, keyFile string, clientCAFile string, clientCertOptional bool) (*Reloader, error) {
+	const op = "tlsreload.New"
+
+	r := &Reloader{
+		log:          log,
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		clientAuth:   tls.NoClientCert,
+	}
+	if clientCAFile != "" {
+		r.clientAuth = tls.RequireAndVerifyClientCert
+		if clientCertOptional {
+			r.clientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	if err := r.load(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return r, nil
+}
+
+// Config returns the server config of the gRPC listener, every handshake
+// uses the files loaded last.
+func (r *Reloader) Config() *tls.Config {
+	// gRPC needs HTTP/2 to be negotiated
+	return r.config(r.clientAuth, "h2")
+}
+
+// HTTPConfig is Config for HTTP servers, HTTP/1.1 clients are served as well.
+// Browsers have no client certificate, so one is only verified if given.
+func (r *Reloader) HTTPConfig() *tls.Config {
+	clientAuth := tls.NoClientCert
+	if r.clientAuth != tls.NoClientCert {
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+	return r.config(clientAuth, "h2", "http/1.1")
+}
+
+func (r *Reloader) config(clientAuth tls.ClientAuthType, nextProtos ...string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientCAs:    r.clientCAs,
+				ClientAuth:   clientAuth,
+				NextProtos:   nextProtos,
+			}, nil
+		},
+	}
+}
+
+// Run checks the files every interval until ctx is cancelled, a failed reload
+// keeps serving the files loaded before.
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) error {
+	const op = "tlsreload.Run"
+
+	log := r.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		changed, err := r.changed()
+		if err != nil {
+			log.Error("failed to check the certificate files", slog.String("error", err.Error()))
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		if err := r.load(); err != nil {
+			log.Error("failed to reload the certificate, the old one is kept", slog.String("error", err.Error()))
+			continue
+		}
+		log.Info("certificate reloaded")
+	}
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+	return files
+}
+
+func (r *Reloader) changed() (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *Reloader) load() error {
+	// the times are taken first so a write during the load is seen on the next check
+	modTimes := make(map[string]time.Time)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates in the client CA file")
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+
+	return nil
+}
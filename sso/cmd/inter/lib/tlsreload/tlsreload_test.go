@@ -0,0 +1,343 @@
+package tlsreload
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCA issues throwaway certificates
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of a leaf for localhost
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) (certPEM []byte, keyPEM []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (ca *testCA) clientCert(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+
+	certPEM, keyPEM := ca.issue(t, commonName, x509.ExtKeyUsageClientAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// writeFile writes the file with a modification time later than the last one,
+// so the change is seen however coarse the clock of the file system is
+func writeFile(t *testing.T, path string, content []byte, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type handshakeResult struct {
+	// served is the common name of the server certificate
+	served string
+	// client is the common name of the verified client certificate
+	client string
+}
+
+// handshake connects a client with clientCert to a listener with cfg, the
+// error is the one of the server
+func handshake(t *testing.T, cfg *tls.Config, ca *testCA, clientCert *tls.Certificate) (handshakeResult, error) {
+	t.Helper()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	type accepted struct {
+		state tls.ConnectionState
+		err   error
+	}
+	done := make(chan accepted, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			done <- accepted{err: err}
+			return
+		}
+		defer conn.Close()
+
+		tlsConn := conn.(*tls.Conn)
+		err = tlsConn.Handshake()
+		done <- accepted{state: tlsConn.ConnectionState(), err: err}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCfg := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+	if clientCert != nil {
+		clientCfg.Certificates = []tls.Certificate{*clientCert}
+	}
+
+	var res handshakeResult
+	conn, clientErr := tls.Dial("tcp", l.Addr().String(), clientCfg)
+	if clientErr == nil {
+		defer conn.Close()
+		res.served = conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	server := <-done
+	if server.err != nil {
+		return handshakeResult{}, server.err
+	}
+	if clientErr != nil {
+		t.Fatalf("client handshake error = %v", clientErr)
+	}
+	if chains := server.state.VerifiedChains; len(chains) > 0 {
+		res.client = chains[0][0].Subject.CommonName
+	}
+
+	return res, nil
+}
+
+// logBuffer is written by Run and read by the test
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+// waitFor waits until a line with msg is logged
+func (b *logBuffer) waitFor(t *testing.T, msg string) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		b.mu.Lock()
+		found := strings.Contains(b.buf.String(), msg)
+		b.mu.Unlock()
+		if found {
+			return
+		}
+	}
+	t.Fatalf("%q is not logged", msg)
+}
+
+func TestRunReloadsCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	modTime := time.Now().Add(-time.Hour)
+	certPEM, keyPEM := ca.issue(t, "first", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certPEM, modTime)
+	writeFile(t, keyFile, keyPEM, modTime)
+
+	logs := &logBuffer{}
+	r, err := New(slog.New(slog.NewTextHandler(logs, nil)), certFile, keyFile, "", false)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = r.Run(ctx, 10*time.Millisecond)
+	}()
+
+	assertServed := func(want string) {
+		t.Helper()
+
+		res, err := handshake(t, r.Config(), ca, nil)
+		if err != nil {
+			t.Fatalf("handshake error = %v", err)
+		}
+		if res.served != want {
+			t.Errorf("served %q, want %q", res.served, want)
+		}
+	}
+
+	assertServed("first")
+
+	modTime = modTime.Add(time.Minute)
+	certPEM, keyPEM = ca.issue(t, "second", x509.ExtKeyUsageServerAuth)
+	writeFile(t, keyFile, keyPEM, modTime)
+	writeFile(t, certFile, certPEM, modTime)
+	logs.waitFor(t, "certificate reloaded")
+
+	assertServed("second")
+
+	// a broken file keeps the certificate loaded before, the key may have
+	// been seen alone above so only the failures from now on count
+	logs.reset()
+	modTime = modTime.Add(time.Minute)
+	writeFile(t, certFile, []byte("not a certificate"), modTime)
+	logs.waitFor(t, "failed to reload the certificate")
+
+	assertServed("second")
+}
+
+func TestNewRejectsBrokenFiles(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+
+	certPEM, keyPEM := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certPEM, time.Now())
+	writeFile(t, keyFile, keyPEM, time.Now())
+	writeFile(t, caFile, []byte("not a certificate"), time.Now())
+
+	if _, err := New(slog.Default(), certFile, keyFile, caFile, false); err == nil {
+		t.Error("New() with a broken client CA file error = nil")
+	}
+	if _, err := New(slog.Default(), keyFile, certFile, "", false); err == nil {
+		t.Error("New() with swapped certificate and key error = nil")
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	ca := newTestCA(t)
+	other := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+
+	certPEM, keyPEM := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certPEM, time.Now())
+	writeFile(t, keyFile, keyPEM, time.Now())
+	writeFile(t, caFile, ca.pem, time.Now())
+
+	trusted := ca.clientCert(t, "billing")
+	untrusted := other.clientCert(t, "intruder")
+
+	tests := []struct {
+		name     string
+		clientCA string
+		optional bool
+		// http uses HTTPConfig instead of Config
+		http       bool
+		clientCert *tls.Certificate
+		wantErr    bool
+		// wantClient is the verified client certificate
+		wantClient string
+	}{
+		{name: "no mtls", clientCert: &trusted},
+		{name: "required without certificate", clientCA: caFile, wantErr: true},
+		{name: "required", clientCA: caFile, clientCert: &trusted, wantClient: "billing"},
+		{name: "required with untrusted certificate", clientCA: caFile, clientCert: &untrusted, wantErr: true},
+		{name: "optional without certificate", clientCA: caFile, optional: true},
+		{name: "optional", clientCA: caFile, optional: true, clientCert: &trusted, wantClient: "billing"},
+		{name: "optional with untrusted certificate", clientCA: caFile, optional: true, clientCert: &untrusted, wantErr: true},
+		// browsers have no client certificate
+		{name: "http without certificate", clientCA: caFile, http: true},
+		{name: "http", clientCA: caFile, http: true, clientCert: &trusted, wantClient: "billing"},
+		{name: "http with untrusted certificate", clientCA: caFile, http: true, clientCert: &untrusted, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(slog.Default(), certFile, keyFile, tt.clientCA, tt.optional)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			cfg := r.Config()
+			if tt.http {
+				cfg = r.HTTPConfig()
+			}
+
+			res, err := handshake(t, cfg, ca, tt.clientCert)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("handshake error = %v, want error %v", err, tt.wantErr)
+			}
+			if res.client != tt.wantClient {
+				t.Errorf("verified client = %q, want %q", res.client, tt.wantClient)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+
+	serviceName = "sso"
+)
+
+// Start starts a span named after the op of the caller, the span is a no-op
+// while tracing is disabled
+func Start(ctx context.Context, op string) (context.Context, trace.Span) {
+	return otel.Tracer(serviceName).Start(ctx, op)
+}
+
+// End records the error the caller returns on the span and ends it, it is
+// deferred with a pointer to the named error result:
+//
+//	defer tracing.End(span, &err)
+func End(span trace.Span, err *error) {
+	RecordError(span, *err)
+	span.End()
+}
+
+// RecordError marks the span failed with err, nil errors are ignored.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Params are where the spans are exported to.
+type Params struct {
+	// Exporter is one of ExporterNone, ExporterStdout or ExporterOTLP
+	Exporter string
+	// Endpoint is the host:port of the OTLP gRPC collector, the OTEL_EXPORTER_OTLP_* env is used when empty
+	Endpoint string
+	Insecure bool
+	// SampleRatio is the share of the traces started here that are recorded
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider, it returns nil when tracing is disabled.
+// The provider must be shut down to flush the last spans.
+func Setup(ctx context.Context, params Params) (*sdktrace.TracerProvider, error) {
+	const op = "tracing.Setup"
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch params.Exporter {
+	case ExporterNone, "":
+		return nil, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		var opts []otlptracegrpc.Option
+		if params.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(params.Endpoint))
+		}
+		if params.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("%s: unknown exporter %q", op, params.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	provider := NewProvider(exporter, params.SampleRatio)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider, nil
+}
+
+// NewProvider returns a provider exporting to exporter, e.g. an in-memory
+// exporter of sdk/trace/tracetest in tests. Traces continued from a caller
+// keep the sampling decision of the caller.
+func NewProvider(exporter sdktrace.SpanExporter, sampleRatio float64) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+}
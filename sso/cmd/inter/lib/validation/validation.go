@@ -0,0 +1,227 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nbutton23/zxcvbn-go"
+)
+
+// DateLayout is the ISO-8601 calendar date the date of birth is expected in
+const DateLayout = "2006-01-02"
+
+// maxAge rejects dates of birth that are obviously mistyped
+const maxAge = 150
+
+const maxURLLength = 2048
+
+var telegramNameRe = regexp.MustCompile(`^[A-Za-z0-9_]{5,32}$`)
+
+// Policy holds the configurable limits of the rules.
+type Policy struct {
+	MinPasswordLength int
+	MaxPasswordLength int
+	// MinPasswordScore is the lowest accepted zxcvbn score, from 0 to 4
+	MinPasswordScore int
+	MinAge           int
+	MaxEmailLength   int
+	MaxNameLength    int
+}
+
+// FieldError describes why the value of a single request field is invalid.
+type FieldError struct {
+	Field       string
+	Description string
+}
+
+// Errors collects the field errors of a request.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, 0, len(e))
+	for _, fe := range e {
+		parts = append(parts, fmt.Sprintf("%s: %s", fe.Field, fe.Description))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// Check records err as the error of the field, nil errors are ignored.
+func (e *Errors) Check(field string, err error) {
+	if err != nil {
+		*e = append(*e, FieldError{Field: field, Description: err.Error()})
+	}
+}
+
+// Err returns nil if no errors were collected.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+type Validator struct {
+	policy Policy
+	now    func() time.Time
+}
+
+// New returns a new instance of the validator
+func New(policy Policy) *Validator {
+	return &Validator{
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+// Required fails on empty values.
+func Required(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return errors.New("must not be empty")
+	}
+
+	return nil
+}
+
+// Email accepts a bare RFC 5322 address, display names like "Bob <bob@example.com>" are rejected.
+func (v *Validator) Email(email string) error {
+	if err := Required(email); err != nil {
+		return err
+	}
+	if len(email) > v.policy.MaxEmailLength {
+		return fmt.Errorf("must be at most %d characters long", v.policy.MaxEmailLength)
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return errors.New("must be a valid email address")
+	}
+
+	return nil
+}
+
+// DateOfBirth accepts an ISO-8601 date of a person at least Policy.MinAge years old.
+func (v *Validator) DateOfBirth(date string) error {
+	if err := Required(date); err != nil {
+		return err
+	}
+
+	birth, err := time.Parse(DateLayout, date)
+	if err != nil {
+		return errors.New("must be a date in YYYY-MM-DD format")
+	}
+
+	now := v.now().UTC()
+	if birth.After(now) {
+		return errors.New("must not be in the future")
+	}
+
+	if birth.AddDate(v.policy.MinAge, 0, 0).After(now) {
+		return fmt.Errorf("you must be at least %d years old", v.policy.MinAge)
+	}
+	if birth.AddDate(maxAge, 0, 0).Before(now) {
+		return errors.New("must be a real date of birth")
+	}
+
+	return nil
+}
+
+// Password checks the length and the strength of the password,
+// userInputs like the email or the name make passwords built from them weaker.
+func (v *Validator) Password(password string, userInputs ...string) error {
+	if err := Required(password); err != nil {
+		return err
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < v.policy.MinPasswordLength {
+		return fmt.Errorf("must be at least %d characters long", v.policy.MinPasswordLength)
+	}
+	// bcrypt ignores everything past 72 bytes so the limit is in bytes
+	if len(password) > v.policy.MaxPasswordLength {
+		return fmt.Errorf("must be at most %d bytes long", v.policy.MaxPasswordLength)
+	}
+
+	if zxcvbn.PasswordStrength(password, userInputs).Score < v.policy.MinPasswordScore {
+		return errors.New("is too weak, avoid common words, names and simple patterns")
+	}
+
+	return nil
+}
+
+// FullName accepts printable names no longer than Policy.MaxNameLength.
+func (v *Validator) FullName(name string) error {
+	if err := Required(name); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(name) > v.policy.MaxNameLength {
+		return fmt.Errorf("must be at most %d characters long", v.policy.MaxNameLength)
+	}
+
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return errors.New("must not contain control characters")
+		}
+	}
+
+	return nil
+}
+
+// TelegramName accepts a telegram username without the leading "@".
+func (v *Validator) TelegramName(name string) error {
+	if err := Required(name); err != nil {
+		return err
+	}
+	if !telegramNameRe.MatchString(name) {
+		return errors.New("must be 5-32 letters, digits or underscores without the leading @")
+	}
+
+	return nil
+}
+
+// WebhookURL accepts absolute https urls without credentials or a fragment.
+func (v *Validator) WebhookURL(raw string) error {
+	if err := Required(raw); err != nil {
+		return err
+	}
+	if len(raw) > maxURLLength {
+		return fmt.Errorf("must be at most %d characters long", maxURLLength)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("must be an absolute url")
+	}
+	if u.Scheme != "https" {
+		return errors.New("must use https")
+	}
+	if u.User != nil || u.Fragment != "" {
+		return errors.New("must not contain credentials or a fragment")
+	}
+
+	return nil
+}
+
+// Subset accepts a non-empty list of the allowed values.
+func Subset(values []string, allowed []string) error {
+	if len(values) == 0 {
+		return errors.New("must not be empty")
+	}
+
+	for _, value := range values {
+		if !slices.Contains(allowed, value) {
+			return fmt.Errorf("unknown value %q, must be one of %s", value, strings.Join(allowed, ", "))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"sso/sso/cmd/inter/domain/models"
+	"time"
+)
+
+// Sink stores audit events.
+type Sink interface {
+	SaveAuditEvent(ctx context.Context, event models.AuditEvent) error
+}
+
+// Client describes the caller of the request being audited.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type clientKey struct{}
+
+// WithClient returns a copy of ctx carrying the caller.
+func WithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientFromContext returns the caller stored by WithClient.
+func ClientFromContext(ctx context.Context) Client {
+	client, _ := ctx.Value(clientKey{}).(Client)
+	return client
+}
+
+// Logger records audit events to every sink.
+type Logger struct {
+	log   *slog.Logger
+	sinks []Sink
+}
+
+// New returns a new instance of the audit logger
+func New(log *slog.Logger, sinks ...Sink) *Logger {
+	return &Logger{
+		log:   log,
+		sinks: sinks,
+	}
+}
+
+// Record fills the time and the caller of the event from ctx and stores it.
+// Sink failures are logged, they never fail the audited operation.
+func (l *Logger) Record(ctx context.Context, event models.AuditEvent) {
+	const op = "audit.Record"
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	client := ClientFromContext(ctx)
+	if event.IP == "" {
+		event.IP = client.IP
+	}
+	if event.UserAgent == "" {
+		event.UserAgent = client.UserAgent
+	}
+
+	l.log.Info("audit",
+		slog.String("event", event.Event),
+		slog.Int64("actor_id", event.ActorID),
+		slog.Int64("target_id", event.TargetID),
+		slog.Int("app_id", event.AppID),
+		slog.String("outcome", event.Outcome),
+		slog.String("reason", event.Reason),
+	)
+
+	// the event is recorded even if the caller has gone away
+	ctx = context.WithoutCancel(ctx)
+
+	for _, sink := range l.sinks {
+		if err := sink.SaveAuditEvent(ctx, event); err != nil {
+			l.log.With(slog.String("op", op)).Error("failed to save audit event",
+				slog.String("event", event.Event),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
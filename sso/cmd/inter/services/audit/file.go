@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sso/sso/cmd/inter/domain/models"
+	"sync"
+	"time"
+)
+
+// FileSink appends events to a file as JSON lines.
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+type fileEvent struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	ActorID    int64     `json:"actor_id,omitempty"`
+	TargetID   int64     `json:"target_id,omitempty"`
+	Identifier string    `json:"identifier,omitempty"`
+	AppID      int       `json:"app_id,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Outcome    string    `json:"outcome"`
+	Reason     string    `json:"reason,omitempty"`
+}
+
+func (s *FileSink) SaveAuditEvent(_ context.Context, event models.AuditEvent) error {
+	const op = "audit.FileSink.SaveAuditEvent"
+
+	line, err := json.Marshal(fileEvent{
+		Time:       event.CreatedAt,
+		Event:      event.Event,
+		ActorID:    event.ActorID,
+		TargetID:   event.TargetID,
+		Identifier: event.Identifier,
+		AppID:      event.AppID,
+		IP:         event.IP,
+		UserAgent:  event.UserAgent,
+		Outcome:    event.Outcome,
+		Reason:     event.Reason,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,314 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/metrics"
+	"sso/sso/cmd/inter/lib/tracing"
+	"sso/sso/cmd/inter/storage"
+	"strconv"
+	"time"
+)
+
+const (
+	resetCodeDigits = 8
+	resetCodeTTL    = 15 * time.Minute
+)
+
+var (
+	ErrInvalidResetCode    = errors.New("invalid or expired reset code")
+	ErrInvalidTelegramChat = errors.New("telegram chat can't be bound")
+	ErrTelegramChatTaken   = errors.New("telegram chat is bound to another account")
+	// ErrTelegramRebindRequired means the account is bound to another chat,
+	// a code to move it was sent to that chat and to the email
+	ErrTelegramRebindRequired = errors.New("account is bound to another telegram chat")
+)
+
+// UserByTelegramChat returns the user bound to the telegram chat
+func (a *Auth) UserByTelegramChat(ctx context.Context, chatID int64) (_ models.User, err error) {
+	const op = "auth.UserByTelegramChat"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	user, err := a.usrProvider.UserByTelegramChat(ctx, chatID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// ConfirmAccountTG binds the private chat to the user with the telegram name
+// and verifies the telegram channel. It returns false if the account already
+// was confirmed. An account bound to another chat isn't moved, a rebind code
+// is sent instead and ErrTelegramRebindRequired is returned.
+func (a *Auth) ConfirmAccountTG(ctx context.Context, telegramName string, chatID int64) (_ bool, err error) {
+	const op = "auth.ConfirmAccountTG"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	if chatID == 0 {
+		return false, fmt.Errorf("%s: %w", op, ErrInvalidTelegramChat)
+	}
+
+	confirmed, err := a.verifier.ConfirmAccountTG(ctx, telegramName, chatID)
+	switch {
+	case errors.Is(err, storage.ErrTelegramChatBound):
+		if err := a.startTelegramRebind(ctx, telegramName, chatID); err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+		return false, fmt.Errorf("%s: %w", op, ErrTelegramRebindRequired)
+	case errors.Is(err, storage.ErrTelegramChatTaken):
+		return false, fmt.Errorf("%s: %w", op, ErrTelegramChatTaken)
+	case err != nil:
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if !confirmed {
+		return false, nil
+	}
+
+	user, err := a.usrProvider.UserByTelegramChat(ctx, chatID)
+	if err != nil {
+		a.logger(ctx).Error("failed to get the verified user", slog.String("op", op), slog.String("error", err.Error()))
+		return true, nil
+	}
+
+	a.publish(ctx, user.ID, models.UserEventVerified, map[string]string{"channel": models.ChannelTelegram})
+
+	return true, nil
+}
+
+// startTelegramRebind sends a code for moving the account to the new chat over
+// the channels the owner already has, the old chat and the email
+func (a *Auth) startTelegramRebind(ctx context.Context, telegramName string, chatID int64) (err error) {
+	const op = "auth.startTelegramRebind"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	log := a.logger(ctx).With(slog.String("op", op))
+
+	user, err := a.usrProvider.UserByTelegramName(ctx, telegramName)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("user_id", user.ID))
+
+	code, err := a.newOneTimeCode(ctx, user.ID, models.CodePurposeTelegramRebind, strconv.FormatInt(chatID, 10))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	text := fmt.Sprintf("Someone asked to link your account to another telegram chat. "+
+		"If it was you, send /rebind %s in the new chat. Otherwise just ignore this message", code)
+
+	var delivered bool
+	if a.notifier != nil {
+		err := a.notifier.SendText(ctx, user.TelegramChatID, text)
+		metrics.CodeSent(models.CodePurposeTelegramRebind, models.ChannelTelegram, err)
+		if err != nil {
+			log.Warn("failed to send rebind code to the bound chat", slog.String("error", err.Error()))
+		} else {
+			delivered = true
+		}
+	}
+
+	err = a.mailer.Send(ctx, user.Email, "Link your account to another telegram chat", text)
+	metrics.CodeSent(models.CodePurposeTelegramRebind, models.ChannelEmail, err)
+	if err != nil {
+		log.Warn("failed to send rebind code by email", slog.String("error", err.Error()))
+	} else {
+		delivered = true
+	}
+
+	if !delivered {
+		return fmt.Errorf("%s: rebind code was not delivered", op)
+	}
+
+	log.Info("telegram rebind code sent")
+
+	return nil
+}
+
+// RebindTelegram moves the account with the telegram name to the chat once the
+// rebind code sent to the previous chat or the email is confirmed
+func (a *Auth) RebindTelegram(ctx context.Context, telegramName string, chatID int64, code string) (err error) {
+	const op = "auth.RebindTelegram"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	if chatID == 0 {
+		return fmt.Errorf("%s: %w", op, ErrInvalidTelegramChat)
+	}
+
+	user, err := a.usrProvider.UserByTelegramName(ctx, telegramName)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidCode)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	otc, err := a.consumeOneTimeCode(ctx, user.ID, models.CodePurposeTelegramRebind, code)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	// the code is only good for the chat it was asked from
+	if otc.Payload != strconv.FormatInt(chatID, 10) {
+		return fmt.Errorf("%s: %w", op, ErrInvalidCode)
+	}
+
+	if err := a.verifier.BindTelegramChat(ctx, user.ID, chatID); err != nil {
+		if errors.Is(err, storage.ErrTelegramChatTaken) {
+			return fmt.Errorf("%s: %w", op, ErrTelegramChatTaken)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.logger(ctx).Info("telegram chat rebound", slog.String("op", op), slog.Int64("user_id", user.ID))
+	a.publish(ctx, user.ID, models.UserEventVerified, map[string]string{"channel": models.ChannelTelegram})
+
+	return nil
+}
+
+// ContactVerifications returns the verification state of every contact channel of the user
+func (a *Auth) ContactVerifications(ctx context.Context, userID int64) (_ []models.ContactVerification, err error) {
+	const op = "auth.ContactVerifications"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	verifications, err := a.verifier.ContactVerifications(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return verifications, nil
+}
+
+func (a *Auth) Sessions(ctx context.Context, userID int64) (_ []models.Session, err error) {
+	const op = "auth.Sessions"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	sessions, err := a.sessions.Sessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSessions logs the user out everywhere and returns the number of revoked sessions
+func (a *Auth) RevokeSessions(ctx context.Context, userID int64) (_ int64, err error) {
+	const op = "auth.RevokeSessions"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	revoked, err := a.sessions.DeleteSessions(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.logger(ctx).Info("sessions revoked",
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int64("count", revoked),
+	)
+	if revoked > 0 {
+		a.publish(ctx, userID, models.UserEventSessionRevoked, map[string]string{
+			"reason": "logout_everywhere",
+			"count":  strconv.FormatInt(revoked, 10),
+		})
+	}
+
+	return revoked, nil
+}
+
+// StartPasswordReset creates a reset code for the user, the caller is
+// responsible for delivering it over a trusted channel
+func (a *Auth) StartPasswordReset(ctx context.Context, userID int64) (_ string, err error) {
+	const op = "auth.StartPasswordReset"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	code, err := randomCode(resetCodeDigits)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// stored like the other one time codes, hashed and with limited attempts
+	err = a.codes.SaveOneTimeCode(ctx, models.OneTimeCode{
+		UserID:    userID,
+		Purpose:   models.CodePurposePasswordReset,
+		CodeHash:  a.hashCode(code),
+		ExpiresAt: time.Now().Add(resetCodeTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
+
+// ResetPassword sets a new password if the reset code is valid and revokes all sessions
+func (a *Auth) ResetPassword(ctx context.Context, email string, resetCode string, newPassword string) (err error) {
+	const op = "auth.ResetPassword"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	log := a.logger(ctx).With(slog.String("op", op), slog.String("email", email))
+
+	// checked before the code is consumed so the user can retry with another
+	// password, and before the user is looked up so the answer is the same
+	// for unknown emails
+	if err := a.checkBreached(ctx, newPassword); err != nil {
+		log.Info("breached password rejected")
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.usrProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidResetCode)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := a.consumeOneTimeCode(ctx, user.ID, models.CodePurposePasswordReset, resetCode); err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			log.Warn("invalid reset code")
+			a.auditAnonymous(ctx, models.AuditPasswordReset, user.ID, email, 0, models.AuditOutcomeFailure, "invalid reset code")
+			return fmt.Errorf("%s: %w", op, ErrInvalidResetCode)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	passHash, err := a.hashPassword(ctx, newPassword)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.usrUpdater.UpdatePassword(ctx, user.ID, passHash); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	revoked, err := a.sessions.DeleteSessions(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("password reset")
+	a.auditAnonymous(ctx, models.AuditPasswordReset, user.ID, email, 0, models.AuditOutcomeSuccess, "")
+	a.publish(ctx, user.ID, models.UserEventPasswordChanged, map[string]string{"reason": "reset"})
+	if revoked > 0 {
+		a.publish(ctx, user.ID, models.UserEventSessionRevoked, map[string]string{
+			"reason": "password_reset",
+			"count":  strconv.FormatInt(revoked, 10),
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/identity"
+	"sso/sso/cmd/inter/lib/tracing"
+	"sso/sso/cmd/inter/storage"
+	"strconv"
+)
+
+// authenticateAdmin returns the owner of the token if they are an admin,
+// the user is returned with ErrPermissionDenied as well so it can be audited.
+// A privileged service authenticated by its client certificate is let in as
+// the zero user, the token is not checked then.
+func (a *Auth) authenticateAdmin(ctx context.Context, token string) (_ models.User, err error) {
+	const op = "auth.authenticateAdmin"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	if service, ok := identity.PrivilegedService(ctx); ok {
+		a.logger(ctx).Info("admin call of a privileged service", slog.String("op", op), slog.String("service", service.Name))
+		return models.User{}, nil
+	}
+
+	user, err := a.authenticate(ctx, token)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	isAdmin, err := a.usrProvider.IsAdmin(ctx, user.ID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !isAdmin {
+		return user, fmt.Errorf("%s: %w", op, ErrPermissionDenied)
+	}
+
+	return user, nil
+}
+
+// SetAdmin grants or revokes admin rights of the user, admins only
+func (a *Auth) SetAdmin(ctx context.Context, token string, userID int64, isAdmin bool) (err error) {
+	const op = "auth.SetAdmin"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	admin, err := a.authenticateAdmin(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrPermissionDenied) {
+			a.auditAdmin(ctx, admin.ID, userID, models.AuditOutcomeFailure, "not an admin")
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.usrUpdater.SetAdmin(ctx, userID, isAdmin); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	reason := "revoked"
+	if isAdmin {
+		reason = "granted"
+	}
+	a.auditAdmin(ctx, admin.ID, userID, models.AuditOutcomeSuccess, reason)
+	a.publish(ctx, userID, models.UserEventRoleChanged, map[string]string{"is_admin": strconv.FormatBool(isAdmin)})
+
+	return nil
+}
+
+func (a *Auth) auditAdmin(ctx context.Context, actorID int64, targetID int64, outcome string, reason string) {
+	a.auditor.Record(ctx, models.AuditEvent{
+		Event:    models.AuditRoleChange,
+		ActorID:  actorID,
+		TargetID: targetID,
+		Outcome:  outcome,
+		Reason:   reason,
+	})
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/metrics"
+	"sso/sso/cmd/inter/lib/tracing"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+var ErrPermissionDenied = errors.New("permission denied")
+
+// audit records an event the user did to their own account
+func (a *Auth) audit(ctx context.Context, event string, userID int64, outcome string, reason string) {
+	a.auditor.Record(ctx, models.AuditEvent{
+		Event:    event,
+		ActorID:  userID,
+		TargetID: userID,
+		Outcome:  outcome,
+		Reason:   reason,
+	})
+}
+
+// auditAnonymous records an event of a caller that isn't authenticated,
+// identifier is what the caller named the target by
+func (a *Auth) auditAnonymous(ctx context.Context, event string, targetID int64, identifier string, appID int, outcome string, reason string) {
+	a.auditor.Record(ctx, models.AuditEvent{
+		Event:      event,
+		TargetID:   targetID,
+		Identifier: identifier,
+		AppID:      appID,
+		Outcome:    outcome,
+		Reason:     reason,
+	})
+}
+
+// auditLogin records a login attempt and counts it in the metrics, a successful one is done by the user
+// themselves. userID is 0 when the email is unknown.
+func (a *Auth) auditLogin(ctx context.Context, userID int64, email string, appID int, outcome string, reason string) {
+	var actorID int64
+	if outcome == models.AuditOutcomeSuccess {
+		actorID = userID
+	}
+
+	metricsReason := reason
+	if metricsReason == "" {
+		metricsReason = "password"
+	}
+	metrics.LoginAttempt(outcome, metricsReason)
+
+	a.auditor.Record(ctx, models.AuditEvent{
+		Event:      models.AuditLogin,
+		ActorID:    actorID,
+		TargetID:   userID,
+		Identifier: email,
+		AppID:      appID,
+		Outcome:    outcome,
+		Reason:     reason,
+	})
+}
+
+// QueryAuditLog returns a page of the audit log to an admin, newest events first.
+// The returned cursor is the BeforeID of the next page, 0 if there are no more events.
+func (a *Auth) QueryAuditLog(ctx context.Context, token string, filter models.AuditFilter) (_ []models.AuditEvent, _ int64, err error) {
+	const op = "auth.QueryAuditLog"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	user, err := a.authenticateAdmin(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrPermissionDenied) {
+			a.audit(ctx, models.AuditQueryAuditLog, user.ID, models.AuditOutcomeFailure, "not an admin")
+		}
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log := a.logger(ctx).With(slog.String("op", op), slog.Int64("user_id", user.ID))
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditPageSize
+	}
+	limit = min(limit, maxAuditPageSize)
+
+	// one more event tells whether there is a next page
+	filter.Limit = limit + 1
+
+	events, err := a.auditLog.AuditEvents(ctx, filter)
+	if err != nil {
+		log.Error("failed to query the audit log", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var next int64
+	if len(events) > limit {
+		events = events[:limit]
+		next = events[limit-1].ID
+	}
+
+	a.audit(ctx, models.AuditQueryAuditLog, user.ID, models.AuditOutcomeSuccess, "")
+
+	return events, next, nil
+}
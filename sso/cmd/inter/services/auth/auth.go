@@ -5,15 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"math/rand"
 	"sso/sso/cmd/inter/domain/models"
 	"sso/sso/cmd/inter/jwt"
+	"sso/sso/cmd/inter/lib/logctx"
+	"sso/sso/cmd/inter/lib/metrics"
+	"sso/sso/cmd/inter/lib/notify"
+	"sso/sso/cmd/inter/lib/tracing"
 	"sso/sso/cmd/inter/storage"
-	"strconv"
+	"sync/atomic"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
-	"gopkg.in/gomail.v2"
 )
 
 var (
@@ -23,13 +23,43 @@ var (
 )
 
 type Auth struct {
-	log          *slog.Logger
-	usrSaver     UserSaver
-	usrProvider  UserProvider
-	appProvider  AppProvider
-	emailSaver   EmailConfirmationSaver
-	emailUpdater EmailUpdater
-	tokenTTL     time.Duration
+	log           *slog.Logger
+	usrSaver      UserSaver
+	usrProvider   UserProvider
+	appProvider   AppProvider
+	emailSaver    EmailConfirmationSaver
+	emailUpdater  EmailUpdater
+	usrUpdater    UserUpdater
+	verifier      VerificationStorage
+	sessions      SessionStorage
+	approvals     LoginApprovalStorage
+	notifier      LoginNotifier
+	codes         OneTimeCodeStorage
+	mailer        Mailer
+	smsSender     SMSSender
+	breachChecker BreachChecker
+	hasher        PasswordHasher
+	auditor       Auditor
+	auditLog      AuditLogProvider
+	userEvents    UserEventStorage
+	webhooks      WebhookStorage
+	accountData   AccountDataStorage
+	eventsHub     *notify.Broadcaster
+	// tokenTTL is in nanoseconds, it is changed by SetTokenTTL while serving
+	tokenTTL     atomic.Int64
+	codeTTL      time.Duration
+	loginLinkURL string
+	// enumerationSafe hides whether an email, phone number or telegram name is
+	// registered from Register, ChangeEmail and UpdateProfile callers
+	enumerationSafe bool
+	// deletionGracePeriod is how long a deleted account can still be restored by logging in
+	deletionGracePeriod time.Duration
+	// pseudonymize keeps purged users under placeholder values instead of deleting them
+	pseudonymize bool
+	// dummyHash is checked for unknown users so their logins take as long as the others
+	dummyHash []byte
+	// codeKey keys the hashes of the one time codes
+	codeKey []byte
 }
 
 // EmailVerification implements auth.Auth.
@@ -54,33 +84,212 @@ type EmailUpdater interface {
 
 type UserProvider interface {
 	User(ctx context.Context, email string) (models.User, error)
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+	UserByTelegramChat(ctx context.Context, chatID int64) (models.User, error)
+	UserByTelegramName(ctx context.Context, telegramName string) (models.User, error)
+	UserByPhone(ctx context.Context, phoneNumber string) (models.User, error)
 	IsAdmin(ctx context.Context, userID int64) (bool, error)
 	IsCodeSent(ctx context.Context, userID int) (bool, error)
 }
 
+type UserUpdater interface {
+	UpdatePassword(ctx context.Context, userID int64, passHash []byte) error
+	UpdateEmail(ctx context.Context, userID int64, email string) error
+	UpdateProfile(ctx context.Context, user models.User, resetChannels []string) error
+	SetAdmin(ctx context.Context, userID int64, isAdmin bool) error
+}
+
+type VerificationStorage interface {
+	SetContactVerified(ctx context.Context, userID int64, channel string, verified bool) error
+	ContactVerifications(ctx context.Context, userID int64) ([]models.ContactVerification, error)
+	ConfirmAccountTG(ctx context.Context, telegramName string, chatID int64) (bool, error)
+	BindTelegramChat(ctx context.Context, userID int64, chatID int64) error
+}
+
+type SessionStorage interface {
+	SaveSession(ctx context.Context, userID int64, appID int, accessToken string) (int64, error)
+	SessionByToken(ctx context.Context, accessToken string) (models.Session, error)
+	Sessions(ctx context.Context, userID int64) ([]models.Session, error)
+	DeleteSessions(ctx context.Context, userID int64) (int64, error)
+	DeleteOtherSessions(ctx context.Context, userID int64, keepToken string) (int64, error)
+}
+
+type LoginApprovalStorage interface {
+	SaveLoginApproval(ctx context.Context, approval models.LoginApproval) error
+	LoginApproval(ctx context.Context, approvalID string) (models.LoginApproval, error)
+	DecideLoginApproval(ctx context.Context, approvalID string, userID int64, status string) error
+	PendingLoginApprovals(ctx context.Context, userID int64) ([]models.LoginApproval, error)
+	ConsumeLoginApproval(ctx context.Context, approvalID string) error
+}
+
+type OneTimeCodeStorage interface {
+	SaveOneTimeCode(ctx context.Context, code models.OneTimeCode) error
+	ConsumeOneTimeCode(ctx context.Context, userID int64, purpose string, codeHash string) (models.OneTimeCode, error)
+}
+
+// Mailer delivers emails to the users.
+type Mailer interface {
+	Send(ctx context.Context, to string, subject string, body string) error
+}
+
+// SMSSender delivers text messages to phone numbers in E.164 format.
+type SMSSender interface {
+	Send(ctx context.Context, phone string, text string) error
+}
+
+// BreachChecker tells whether a password is known from data breaches.
+type BreachChecker interface {
+	IsBreached(ctx context.Context, password string) (bool, error)
+}
+
+// PasswordHasher makes password hashes and verifies them, needsRehash reports
+// hashes made with outdated params.
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	Verify(hash []byte, password string) (needsRehash bool, err error)
+}
+
+// Auditor records security relevant events.
+type Auditor interface {
+	Record(ctx context.Context, event models.AuditEvent)
+}
+
+type AuditLogProvider interface {
+	AuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error)
+}
+
+// UserEventStorage keeps the user events in the order they happened.
+type UserEventStorage interface {
+	SaveUserEvent(ctx context.Context, event models.UserEvent) (int64, error)
+	UserEvents(ctx context.Context, afterID int64, limit int) ([]models.UserEvent, error)
+}
+
+type WebhookStorage interface {
+	SaveWebhookEndpoint(ctx context.Context, endpoint models.WebhookEndpoint) (int64, error)
+	WebhookEndpoint(ctx context.Context, endpointID int64) (models.WebhookEndpoint, error)
+	WebhookEndpoints(ctx context.Context, appID int, failingOnly bool) ([]models.WebhookEndpoint, error)
+	SetWebhookEndpointDisabled(ctx context.Context, endpointID int64, disabled bool) error
+	WebhookDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error)
+	ReplayWebhookDeliveries(ctx context.Context, endpointID int64, deliveryID int64) (int64, error)
+}
+
+// AccountDataStorage reads the records of a user for the data export and erases them.
+type AccountDataStorage interface {
+	AccountConfirmations(ctx context.Context, userID int64) ([]models.AccountConfirmation, error)
+	ExternalAuths(ctx context.Context, userID int64) ([]models.ExternalAuth, error)
+	UserAuditEvents(ctx context.Context, userID int64) ([]models.AuditEvent, error)
+	AccountDeletion(ctx context.Context, userID int64) (models.AccountDeletion, bool, error)
+	ScheduleAccountDeletion(ctx context.Context, deletion models.AccountDeletion) (models.AccountDeletion, error)
+	CancelAccountDeletion(ctx context.Context, userID int64) (bool, error)
+	DueAccountDeletions(ctx context.Context, limit int) ([]models.AccountDeletion, error)
+	PostponeAccountDeletion(ctx context.Context, userID int64, purgeAfter time.Time) error
+	PurgeUser(ctx context.Context, userID int64, pseudonymize bool) error
+}
+
+// LoginNotifier reaches the user in the bound telegram chat, it asks to
+// approve logins out of band.
+type LoginNotifier interface {
+	SendLoginApproval(ctx context.Context, chatID int64, approvalID string, appName string) error
+	SendText(ctx context.Context, chatID int64, text string) error
+}
+
 type AppProvider interface {
 	App(ctx context.Context, appID int) (models.App, error)
 }
 
+// Deps are the collaborators of the auth service, most of them are
+// implemented by the storage.
+type Deps struct {
+	UserSaver     UserSaver
+	UserProvider  UserProvider
+	AppProvider   AppProvider
+	EmailSaver    EmailConfirmationSaver
+	EmailUpdater  EmailUpdater
+	UserUpdater   UserUpdater
+	Verifier      VerificationStorage
+	Sessions      SessionStorage
+	Approvals     LoginApprovalStorage
+	Notifier      LoginNotifier
+	Codes         OneTimeCodeStorage
+	Mailer        Mailer
+	SMSSender     SMSSender
+	BreachChecker BreachChecker
+	Hasher        PasswordHasher
+	Auditor       Auditor
+	AuditLog      AuditLogProvider
+	UserEvents    UserEventStorage
+	Webhooks      WebhookStorage
+	AccountData   AccountDataStorage
+	// EventsHub is notified after a user event is saved
+	EventsHub *notify.Broadcaster
+}
+
+// Params tune the auth service.
+type Params struct {
+	TokenTTL time.Duration
+	// CodeTTL is the lifetime of the passwordless codes and links
+	CodeTTL      time.Duration
+	LoginLinkURL string
+	// EnumerationSafe makes Register, ChangeEmail and UpdateProfile succeed for
+	// taken contacts and tell their owners instead
+	EnumerationSafe     bool
+	DeletionGracePeriod time.Duration
+	// Pseudonymize keeps purged users under placeholder values
+	Pseudonymize bool
+	// CodeKey keys the hashes the one time codes are stored as, a random key
+	// is used when it is empty
+	CodeKey []byte
+}
+
 // New returns a new instance of the auth service
-func New(
-	log *slog.Logger,
-	userSaver UserSaver,
-	userProvider UserProvider,
-	appProvider AppProvider,
-	emailSaver EmailConfirmationSaver,
-	emailUpdater EmailUpdater,
-	tokenTTL time.Duration,
-) *Auth {
-	return &Auth{
-		usrSaver:     userSaver,
-		usrProvider:  userProvider,
-		emailSaver:   emailSaver,
-		log:          log,
-		appProvider:  appProvider,
-		emailUpdater: emailUpdater,
-		tokenTTL:     tokenTTL,
+func New(log *slog.Logger, deps Deps, params Params) *Auth {
+	a := &Auth{
+		usrSaver:            deps.UserSaver,
+		usrProvider:         deps.UserProvider,
+		emailSaver:          deps.EmailSaver,
+		log:                 log,
+		appProvider:         deps.AppProvider,
+		emailUpdater:        deps.EmailUpdater,
+		usrUpdater:          deps.UserUpdater,
+		verifier:            deps.Verifier,
+		sessions:            deps.Sessions,
+		approvals:           deps.Approvals,
+		notifier:            deps.Notifier,
+		codes:               deps.Codes,
+		mailer:              deps.Mailer,
+		smsSender:           deps.SMSSender,
+		breachChecker:       deps.BreachChecker,
+		hasher:              deps.Hasher,
+		auditor:             deps.Auditor,
+		auditLog:            deps.AuditLog,
+		userEvents:          deps.UserEvents,
+		webhooks:            deps.Webhooks,
+		accountData:         deps.AccountData,
+		eventsHub:           deps.EventsHub,
+		codeTTL:             params.CodeTTL,
+		loginLinkURL:        params.LoginLinkURL,
+		enumerationSafe:     params.EnumerationSafe,
+		deletionGracePeriod: params.DeletionGracePeriod,
+		pseudonymize:        params.Pseudonymize,
+		codeKey:             params.CodeKey,
 	}
+	a.tokenTTL.Store(int64(params.TokenTTL))
+	a.dummyHash = a.newDummyHash()
+	if len(a.codeKey) == 0 {
+		a.codeKey = a.newCodeKey()
+	}
+
+	return a
+}
+
+// SetTokenTTL changes the lifetime of the tokens issued from now on.
+func (a *Auth) SetTokenTTL(ttl time.Duration) {
+	a.tokenTTL.Store(int64(ttl))
+}
+
+// logger returns the logger of the request, it carries the request id
+func (a *Auth) logger(ctx context.Context) *slog.Logger {
+	return logctx.From(ctx, a.log)
 }
 
 func (a *Auth) Login(
@@ -88,71 +297,153 @@ func (a *Auth) Login(
 	email string,
 	password string,
 	appID int,
-) (string, error) {
+) (_ string, err error) {
 	const op = "auth.Login"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
 
-	log := a.log.With(slog.String("op", op), slog.String("username", email))
+	log := a.logger(ctx).With(slog.String("op", op), slog.String("username", email))
 
-	a.log.Info("Attempting to login the user", email)
+	log.Info("Attempting to login the user")
 
+	user, err := a.checkCredentials(ctx, log, email, password, appID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := a.issueToken(ctx, user, appID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("logged successfully")
+	a.auditLogin(ctx, user.ID, email, appID, models.AuditOutcomeSuccess, "")
+
+	return token, nil
+}
+
+// checkCredentials returns the user if the password is right, unknown users take
+// as long as the others. Failures are audited as failed logins into the app.
+func (a *Auth) checkCredentials(ctx context.Context, log *slog.Logger, email string, password string, appID int) (models.User, error) {
 	user, err := a.usrProvider.User(ctx, email)
-	fmt.Print(user)
-	fmt.Print(user.PassHash)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
-			a.log.Warn("user not found", err)
+			log.Warn("user not found", slog.String("error", err.Error()))
+			a.verifyDummy(ctx, password)
+			a.auditLogin(ctx, 0, email, appID, models.AuditOutcomeFailure, "user not found")
 
-			return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+			return models.User{}, ErrInvalidCredentials
 		}
 
-		a.log.Error("failed to get the user", err)
+		log.Error("failed to get the user", slog.String("error", err.Error()))
 
-		return "", fmt.Errorf("%s: %w", op, err)
+		return models.User{}, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
-		a.log.Info("invalid credentials", err)
+	needsRehash, err := a.verifyPassword(ctx, user.PassHash, password)
+	if err != nil {
+		log.Info("invalid credentials", slog.String("error", err.Error()))
+		a.auditLogin(ctx, user.ID, email, appID, models.AuditOutcomeFailure, "invalid password")
+
+		return models.User{}, ErrInvalidCredentials
+	}
+	if needsRehash {
+		a.rehashPassword(ctx, user.ID, password)
+	}
+
+	return user, nil
+}
+
+// rehashPassword replaces an outdated hash after a successful login,
+// failures are only logged since the old hash keeps working
+func (a *Auth) rehashPassword(ctx context.Context, userID int64, password string) {
+	const op = "auth.rehashPassword"
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
 
-		return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	log := a.logger(ctx).With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	passHash, err := a.hashPassword(ctx, password)
+	if err != nil {
+		tracing.RecordError(span, err)
+		log.Error("failed to generate password hash", slog.String("error", err.Error()))
+		return
+	}
+
+	if err := a.usrUpdater.UpdatePassword(ctx, userID, passHash); err != nil {
+		tracing.RecordError(span, err)
+		log.Error("failed to update password hash", slog.String("error", err.Error()))
+		return
 	}
 
+	log.Info("password hash upgraded")
+}
+
+// hashPassword hashes the password in a span of its own, hashing is meant to
+// be the slowest part of the requests that do it
+func (a *Auth) hashPassword(ctx context.Context, password string) ([]byte, error) {
+	_, span := tracing.Start(ctx, "passhash.Hash")
+	defer span.End()
+
+	return a.hasher.Hash(password)
+}
+
+// verifyPassword checks the password against the hash in a span of its own
+func (a *Auth) verifyPassword(ctx context.Context, hash []byte, password string) (bool, error) {
+	_, span := tracing.Start(ctx, "passhash.Verify")
+	defer span.End()
+
+	return a.hasher.Verify(hash, password)
+}
+
+// issueToken creates a token for the user in the app and saves it as a new session
+func (a *Auth) issueToken(ctx context.Context, user models.User, appID int) (_ string, err error) {
+	const op = "auth.issueToken"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	log := a.logger(ctx).With(slog.String("op", op), slog.Int64("user_id", user.ID))
+
 	app, err := a.appProvider.App(ctx, appID)
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	log.Info("logged successfully")
-
-	token, err := jwt.NewToken(user, app, a.tokenTTL)
+	token, err := jwt.NewToken(user, app, time.Duration(a.tokenTTL.Load()))
 	if err != nil {
-		a.log.Error("failed to generate the token", err)
+		log.Error("failed to generate the token", slog.String("error", err.Error()))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := a.sessions.SaveSession(ctx, user.ID, app.ID, token); err != nil {
+		log.Error("failed to save the session", slog.String("error", err.Error()))
 
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
+	a.cancelDeletion(ctx, user)
+
 	return token, nil
 }
 
-func (a *Auth) SendConfirmationCode(ctx context.Context, receiptorEmail string, userid int64) (bool, error) {
+func (a *Auth) SendConfirmationCode(ctx context.Context, receiptorEmail string, userid int64) (_ bool, err error) {
 	const op = "services.auth.SendConfirmationCode"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
 
-	src := rand.NewSource(time.Now().UnixNano())
-	r := rand.New(src)
-
-	randomNumber := r.Intn(90000) + 10000
-	m := gomail.NewMessage()
-	m.SetHeader("From", "username@gmail.com")
-	m.SetHeader("To", receiptorEmail)
-	m.SetHeader("Subject", "Confirmation email")
-	confirmationString := fmt.Sprintf("Hello, your confirmation code is %d", randomNumber)
-	m.SetBody("text/html", confirmationString)
-
-	d := gomail.NewDialer("smtp.gmail.com", 587, "username@gmail.com", "")
+	code, err := randomCode(confirmationCodeDigits)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
 
-	if err := d.DialAndSend(m); err != nil {
-		return false, err
+	err = a.mailer.Send(ctx, receiptorEmail, "Confirmation email", fmt.Sprintf("Hello, your confirmation code is %s", code))
+	metrics.CodeSent("account_confirmation", models.ChannelEmail, err)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
 	}
-	_, err := a.emailSaver.SaveEmailCode(ctx, userid, strconv.Itoa(randomNumber))
+
+	_, err = a.emailSaver.SaveEmailCode(ctx, userid, code)
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
 	}
@@ -160,13 +451,25 @@ func (a *Auth) SendConfirmationCode(ctx context.Context, receiptorEmail string,
 
 }
 
-func (a *Auth) EmailVerification(ctx context.Context, email string, verificationCode string) (bool, error) {
+func (a *Auth) EmailVerification(ctx context.Context, email string, verificationCode string) (_ bool, err error) {
 	const op = "services.auth.EmailVerification"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
 
-	err := a.emailUpdater.ConfirmAccount(ctx, email, verificationCode)
+	err = a.emailUpdater.ConfirmAccount(ctx, email, verificationCode)
 	if err != nil {
+		a.auditAnonymous(ctx, models.AuditEmailVerification, 0, email, 0, models.AuditOutcomeFailure, "invalid code")
 		return false, fmt.Errorf("%s: %w", op, err)
 	}
+
+	a.auditAnonymous(ctx, models.AuditEmailVerification, 0, email, 0, models.AuditOutcomeSuccess, "")
+
+	if user, err := a.usrProvider.User(ctx, email); err == nil {
+		a.publish(ctx, user.ID, models.UserEventVerified, map[string]string{"channel": models.ChannelEmail})
+	} else {
+		a.logger(ctx).Error("failed to get the verified user", slog.String("op", op), slog.String("error", err.Error()))
+	}
+
 	return true, nil
 }
 
@@ -178,29 +481,59 @@ func (a *Auth) RegisterNewUser(
 	fullName string,
 	phoneNumber string,
 	telegramName string,
-) (int64, error) {
+) (_ int64, err error) {
 	const op = "auth.RegisterNewUser"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
 
-	log := a.log.With(slog.String("op", op),
+	log := a.logger(ctx).With(slog.String("op", op),
 		slog.String("email", email),
 	)
 
 	log.Info("registering user")
 
-	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err := a.checkBreached(ctx, password); err != nil {
+		log.Info("breached password rejected")
+		a.auditAnonymous(ctx, models.AuditRegister, 0, email, 0, models.AuditOutcomeFailure, "breached password")
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
 
+	passHash, err := a.hashPassword(ctx, password)
 	if err != nil {
-		log.Error("failed to generate password hash", err)
+		log.Error("failed to generate password hash", slog.String("error", err.Error()))
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
 	id, err := a.usrSaver.SaveUser(ctx, passHash, email, dateOfBirth, fullName, phoneNumber, telegramName)
 	if err != nil {
-		log.Error("Failed to save the user", err)
+		if errors.Is(err, storage.ErrUserExists) {
+			a.auditAnonymous(ctx, models.AuditRegister, 0, email, 0, models.AuditOutcomeFailure, "user already exists")
+		}
+
+		if a.enumerationSafe && errors.Is(err, storage.ErrUserExists) {
+			log.Info("user already exists")
+
+			if err := a.registerExisting(ctx, email, phoneNumber, telegramName); err != nil {
+				return 0, fmt.Errorf("%s: %w", op, err)
+			}
+			return 0, nil
+		}
+
+		log.Error("Failed to save the user", slog.String("error", err.Error()))
 
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	a.SendConfirmationCode(ctx, email, id)
+	a.auditAnonymous(ctx, models.AuditRegister, id, email, 0, models.AuditOutcomeSuccess, "")
+	a.publish(ctx, id, models.UserEventRegistered, nil)
+
+	if _, err := a.SendConfirmationCode(ctx, email, id); err != nil {
+		log.Error("failed to send the confirmation code", slog.String("error", err.Error()))
+	}
+
+	// the id would tell new users from existing ones
+	if a.enumerationSafe {
+		return 0, nil
+	}
 
 	return id, nil
 }
@@ -208,13 +541,22 @@ func (a *Auth) RegisterNewUser(
 func (a *Auth) IsAdmin(
 	ctx context.Context,
 	userID int64,
-) (bool, error) {
+) (_ bool, err error) {
 	const op = "auth.IsAdmin"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
 	isAdmin, err := a.usrProvider.IsAdmin(ctx, userID)
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
 
 	}
+
+	reason := "not an admin"
+	if isAdmin {
+		reason = "admin"
+	}
+	a.auditAnonymous(ctx, models.AuditIsAdmin, userID, "", 0, models.AuditOutcomeSuccess, reason)
+
 	return isAdmin, nil
 }
 
@@ -223,10 +565,12 @@ func (a *Auth) VerifyEmail(
 	ctx context.Context,
 	email string,
 	code string,
-) (bool, error) {
+) (_ bool, err error) {
 
 	const op = "test"
-	err := a.emailUpdater.ConfirmAccount(ctx, email, code)
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+	err = a.emailUpdater.ConfirmAccount(ctx, email, code)
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
 	}
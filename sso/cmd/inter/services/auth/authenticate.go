@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/jwt"
+	"sso/sso/cmd/inter/lib/tracing"
+)
+
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// authenticate returns the owner of the token, the token must be valid
+// and its session must not be revoked
+func (a *Auth) authenticate(ctx context.Context, token string) (_ models.User, err error) {
+	const op = "auth.authenticate"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	claims, err := jwt.ParseToken(token, func(appID int) (string, error) {
+		app, err := a.appProvider.App(ctx, appID)
+		if err != nil {
+			return "", err
+		}
+		return app.Secret, nil
+	})
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, ErrUnauthenticated)
+	}
+
+	session, err := a.sessions.SessionByToken(ctx, token)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w: %w", op, ErrUnauthenticated, err)
+	}
+	if session.UserID != claims.UserID {
+		return models.User{}, fmt.Errorf("%s: %w", op, ErrUnauthenticated)
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, claims.UserID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w: %w", op, ErrUnauthenticated, err)
+	}
+
+	return user, nil
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/sso/cmd/inter/lib/tracing"
+)
+
+var ErrPasswordBreached = errors.New("password was found in a data breach")
+
+// checkBreached fails with ErrPasswordBreached if the password is known from
+// data breaches. An unavailable corpus doesn't block users, it is only logged.
+func (a *Auth) checkBreached(ctx context.Context, password string) (err error) {
+	const op = "auth.checkBreached"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	if a.breachChecker == nil {
+		return nil
+	}
+
+	breached, err := a.breachChecker.IsBreached(ctx, password)
+	if err != nil {
+		a.logger(ctx).With(slog.String("op", op)).Warn("failed to check the password against breaches", slog.String("error", err.Error()))
+		return nil
+	}
+	if breached {
+		return fmt.Errorf("%s: %w", op, ErrPasswordBreached)
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/metrics"
+	"sso/sso/cmd/inter/lib/tracing"
+	"sso/sso/cmd/inter/storage"
+	"strconv"
+)
+
+// ChangePassword sets a new password for the owner of the token and revokes
+// all their other sessions
+func (a *Auth) ChangePassword(ctx context.Context, token string, currentPassword string, newPassword string) (err error) {
+	const op = "auth.ChangePassword"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	user, err := a.authenticate(ctx, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log := a.logger(ctx).With(slog.String("op", op), slog.Int64("user_id", user.ID))
+
+	if _, err := a.verifyPassword(ctx, user.PassHash, currentPassword); err != nil {
+		a.audit(ctx, models.AuditPasswordChange, user.ID, models.AuditOutcomeFailure, "invalid current password")
+
+		return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	if err := a.checkBreached(ctx, newPassword); err != nil {
+		a.audit(ctx, models.AuditPasswordChange, user.ID, models.AuditOutcomeFailure, "breached password")
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	passHash, err := a.hashPassword(ctx, newPassword)
+	if err != nil {
+		log.Error("failed to generate password hash", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.usrUpdater.UpdatePassword(ctx, user.ID, passHash); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	revoked, err := a.sessions.DeleteOtherSessions(ctx, user.ID, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("password changed", slog.Int64("revoked_sessions", revoked))
+	a.audit(ctx, models.AuditPasswordChange, user.ID, models.AuditOutcomeSuccess, "")
+	a.publish(ctx, user.ID, models.UserEventPasswordChanged, map[string]string{"reason": "change"})
+	if revoked > 0 {
+		a.publish(ctx, user.ID, models.UserEventSessionRevoked, map[string]string{
+			"reason": "password_change",
+			"count":  strconv.FormatInt(revoked, 10),
+		})
+	}
+
+	return nil
+}
+
+// ChangeEmail sends a confirmation code to the new address, the email is
+// only changed by ConfirmEmailChange
+func (a *Auth) ChangeEmail(ctx context.Context, token string, newEmail string) (err error) {
+	const op = "auth.ChangeEmail"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	user, err := a.authenticate(ctx, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log := a.logger(ctx).With(slog.String("op", op), slog.Int64("user_id", user.ID))
+
+	if _, err := a.usrProvider.User(ctx, newEmail); err == nil {
+		a.audit(ctx, models.AuditEmailChangeRequested, user.ID, models.AuditOutcomeFailure, "email is taken")
+
+		if a.enumerationSafe {
+			a.changeEmailToExisting(ctx, newEmail)
+			return nil
+		}
+		return fmt.Errorf("%s: %w", op, ErrUserExists)
+	} else if !errors.Is(err, storage.ErrUserNotFound) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := a.newOneTimeCode(ctx, user.ID, models.CodePurposeEmailChange, newEmail)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.mailer.Send(ctx, newEmail, "Confirm your new email", fmt.Sprintf("Hello, your email change code is %s", code))
+	metrics.CodeSent(models.CodePurposeEmailChange, models.ChannelEmail, err)
+	if err != nil {
+		log.Error("failed to send email change code", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.audit(ctx, models.AuditEmailChangeRequested, user.ID, models.AuditOutcomeSuccess, "")
+
+	return nil
+}
+
+// ConfirmEmailChange swaps the email of the owner of the token to the one the code was sent to
+func (a *Auth) ConfirmEmailChange(ctx context.Context, token string, code string) (err error) {
+	const op = "auth.ConfirmEmailChange"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	user, err := a.authenticate(ctx, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log := a.logger(ctx).With(slog.String("op", op), slog.Int64("user_id", user.ID))
+
+	otc, err := a.consumeOneTimeCode(ctx, user.ID, models.CodePurposeEmailChange, code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			a.audit(ctx, models.AuditEmailChange, user.ID, models.AuditOutcomeFailure, "invalid code")
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.usrUpdater.UpdateEmail(ctx, user.ID, otc.Payload); err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			a.audit(ctx, models.AuditEmailChange, user.ID, models.AuditOutcomeFailure, "email is taken")
+
+			// taken since the code was sent, answered like a stale code
+			if a.enumerationSafe {
+				return fmt.Errorf("%s: %w", op, ErrInvalidCode)
+			}
+			return fmt.Errorf("%s: %w", op, ErrUserExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the code was delivered to the new address, so it is verified
+	if err := a.verifier.SetContactVerified(ctx, user.ID, models.ChannelEmail, true); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.audit(ctx, models.AuditEmailChange, user.ID, models.AuditOutcomeSuccess, "")
+	a.publish(ctx, user.ID, models.UserEventEmailChanged, nil)
+	a.publish(ctx, user.ID, models.UserEventVerified, map[string]string{"channel": models.ChannelEmail})
+
+	// let the previous owner of the address know in case it wasn't them
+	if err := a.mailer.Send(ctx, user.Email, "Your email was changed", "Hello, the email of your account was changed. If it wasn't you, contact support."); err != nil {
+		log.Warn("failed to notify the old email", slog.String("error", err.Error()))
+	}
+
+	return nil
+}
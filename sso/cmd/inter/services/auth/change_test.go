@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"sso/sso/cmd/inter/lib/notify"
+	"testing"
+)
+
+func TestChangePassword(t *testing.T) {
+	const newPassword = "Quintus.Aurelius.77"
+
+	a, st := newTestAuth(t)
+	a.userEvents = st
+	a.eventsHub = notify.NewBroadcaster()
+	ctx := context.Background()
+
+	current, other := login(t, a), login(t, a)
+
+	if err := a.ChangePassword(ctx, current, "wrong password", newPassword); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("ChangePassword() with a wrong password error = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if _, err := a.authenticate(ctx, other); err != nil {
+		t.Fatalf("a failed change revoked the other session: %v", err)
+	}
+
+	if err := a.ChangePassword(ctx, current, testPassword, newPassword); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+
+	if _, err := a.authenticate(ctx, current); err != nil {
+		t.Errorf("current session error = %v, want it kept", err)
+	}
+	if _, err := a.authenticate(ctx, other); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("other session error = %v, want %v", err, ErrUnauthenticated)
+	}
+
+	if _, err := a.Login(ctx, testEmail, testPassword, 1); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() with the old password error = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if _, err := a.Login(ctx, testEmail, newPassword, 1); err != nil {
+		t.Errorf("Login() with the new password error = %v", err)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	const carolEmail = "carol@example.com"
+
+	tests := []struct {
+		name    string
+		email   string
+		wantErr error
+		wantTo  []string
+	}{
+		{name: "free email", email: carolEmail, wantTo: []string{carolEmail}},
+		{name: "taken email", email: bobEmail, wantErr: ErrUserExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, st, mailer := newEnumerationSafeAuth(t)
+			a.enumerationSafe = false
+			ctx := context.Background()
+
+			token := login(t, a)
+			if err := a.ChangeEmail(ctx, token, tt.email); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ChangeEmail() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(mailer.to, tt.wantTo) {
+				t.Fatalf("emailed %v, want %v", mailer.to, tt.wantTo)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			// the email is only changed once the code is confirmed
+			if _, err := st.User(ctx, testEmail); err != nil {
+				t.Fatalf("User(%s) before the confirmation error = %v", testEmail, err)
+			}
+
+			code := regexp.MustCompile(`\d{6}`).FindString(mailer.body)
+			if err := a.ConfirmEmailChange(ctx, token, code); err != nil {
+				t.Fatalf("ConfirmEmailChange() error = %v", err)
+			}
+			if _, err := st.User(ctx, tt.email); err != nil {
+				t.Errorf("User(%s) error = %v, want the changed email", tt.email, err)
+			}
+			// the old address is told about the change
+			if last := mailer.to[len(mailer.to)-1]; last != testEmail {
+				t.Errorf("last email to %s, want %s", last, testEmail)
+			}
+		})
+	}
+}
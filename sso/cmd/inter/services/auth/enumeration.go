@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/tracing"
+	"sso/sso/cmd/inter/storage"
+)
+
+// newDummyHash hashes a random password with the current hasher so checking
+// it costs as much as checking an up to date hash
+func (a *Auth) newDummyHash() []byte {
+	const op = "auth.newDummyHash"
+
+	log := a.log.With(slog.String("op", op))
+
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		log.Error("failed to generate dummy password", slog.String("error", err.Error()))
+		return nil
+	}
+
+	hash, err := a.hasher.Hash(hex.EncodeToString(secret))
+	if err != nil {
+		log.Error("failed to generate dummy hash", slog.String("error", err.Error()))
+		return nil
+	}
+
+	return hash
+}
+
+// verifyDummy spends as much time as checking the password of an existing
+// user so failed logins don't reveal which emails are registered.
+func (a *Auth) verifyDummy(ctx context.Context, password string) {
+	if a.dummyHash != nil {
+		_, _ = a.verifyPassword(ctx, a.dummyHash, password)
+	}
+}
+
+// registerExisting handles a registration conflict in the enumeration safe
+// mode: the owners of the taken email, phone number and telegram name are
+// told about the attempt and the caller gets the same response as a
+// successful registration.
+func (a *Auth) registerExisting(ctx context.Context, email string, phoneNumber string, telegramName string) (err error) {
+	const op = "auth.registerExisting"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	log := a.logger(ctx).With(slog.String("op", op))
+
+	// warned are the users that got an email already
+	warned := make(map[int64]bool)
+
+	owner, err := a.usrProvider.User(ctx, email)
+	switch {
+	case err == nil:
+		warned[owner.ID] = true
+
+		body := "Hello, someone tried to create an account with your email. " +
+			"If it was you, you already have an account and can log in or reset your password. " +
+			"Otherwise you can ignore this email."
+		if err := a.mailer.Send(ctx, email, "Account already exists", body); err != nil {
+			log.Error("failed to notify the owner of the email", slog.String("error", err.Error()))
+		}
+	case !errors.Is(err, storage.ErrUserNotFound):
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, contact := range []struct {
+		channel string
+		lookup  func() (models.User, error)
+	}{
+		{models.ChannelPhone, func() (models.User, error) { return a.usrProvider.UserByPhone(ctx, phoneNumber) }},
+		{models.ChannelTelegram, func() (models.User, error) { return a.usrProvider.UserByTelegramName(ctx, telegramName) }},
+	} {
+		owner, err := contact.lookup()
+		if errors.Is(err, storage.ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if warned[owner.ID] {
+			continue
+		}
+		warned[owner.ID] = true
+
+		a.warnContactOwner(ctx, owner.Email, contact.channel)
+	}
+
+	return nil
+}
+
+// changeEmailToExisting handles an email change to a registered address in the
+// enumeration safe mode: the caller gets the same response as for a free
+// address and the owner of the address is told about the attempt.
+func (a *Auth) changeEmailToExisting(ctx context.Context, email string) {
+	const op = "auth.changeEmailToExisting"
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	body := "Hello, someone tried to move another account to your email. " +
+		"Your account wasn't changed, you can ignore this email."
+	if err := a.mailer.Send(ctx, email, "Email change attempt", body); err != nil {
+		tracing.RecordError(span, err)
+		a.logger(ctx).Error("failed to notify the owner of the email", slog.String("op", op), slog.String("error", err.Error()))
+	}
+}
+
+// holdTakenContacts saves a profile update that conflicts with another user
+// in the enumeration safe mode. The taken phone number and telegram name are
+// held as pending until they are verified, their owners are warned and the
+// caller gets the same profile as after a successful update.
+func (a *Auth) holdTakenContacts(ctx context.Context, user models.User, update models.ProfileUpdate) (_ models.User, err error) {
+	const op = "auth.holdTakenContacts"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	var (
+		resetChannels []string
+		// warnings are the emails of the owners by the taken channel
+		warnings = make(map[string]string)
+	)
+	if update.FullName != nil {
+		user.FullName = *update.FullName
+	}
+	if update.DateOfBirth != nil {
+		user.DateOfBirth = *update.DateOfBirth
+	}
+	if update.PhoneNumber != nil {
+		user.PendingPhoneNumber = ""
+
+		if *update.PhoneNumber != user.PhoneNumber {
+			owner, err := a.usrProvider.UserByPhone(ctx, *update.PhoneNumber)
+			switch {
+			case err == nil:
+				user.PendingPhoneNumber = *update.PhoneNumber
+				warnings[models.ChannelPhone] = owner.Email
+			case errors.Is(err, storage.ErrUserNotFound):
+				user.PhoneNumber = *update.PhoneNumber
+				resetChannels = append(resetChannels, models.ChannelPhone)
+			default:
+				return models.User{}, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+	if update.TelegramName != nil {
+		user.PendingTelegramName = ""
+
+		if *update.TelegramName != user.TelegramName {
+			owner, err := a.usrProvider.UserByTelegramName(ctx, *update.TelegramName)
+			switch {
+			case err == nil:
+				user.PendingTelegramName = *update.TelegramName
+				warnings[models.ChannelTelegram] = owner.Email
+			case errors.Is(err, storage.ErrUserNotFound):
+				user.TelegramName = *update.TelegramName
+				user.TelegramChatID = 0
+				resetChannels = append(resetChannels, models.ChannelTelegram)
+			default:
+				return models.User{}, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+
+	if err := a.usrUpdater.UpdateProfile(ctx, user, resetChannels); err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for channel, email := range warnings {
+		a.warnContactOwner(ctx, email, channel)
+	}
+
+	return user, nil
+}
+
+// warnContactOwner tells the owner of the email that their contact of the
+// channel was entered for another account
+func (a *Auth) warnContactOwner(ctx context.Context, email string, channel string) {
+	const op = "auth.warnContactOwner"
+
+	contact := "phone number"
+	if channel == models.ChannelTelegram {
+		contact = "telegram name"
+	}
+
+	body := fmt.Sprintf("Hello, someone entered the %s of your account for another account. "+
+		"It won't be used there unless it is verified and your account wasn't changed, you can ignore this email.", contact)
+	if err := a.mailer.Send(ctx, email, "Your "+contact+" was used by another account", body); err != nil {
+		a.logger(ctx).Error("failed to notify the owner of the contact", slog.String("op", op), slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/notify"
+	"sso/sso/cmd/inter/storage/sqlite"
+	"testing"
+)
+
+const (
+	bobEmail    = "bob@example.com"
+	bobPhone    = "+15550101"
+	bobTelegram = "bob_tg"
+)
+
+// fakeMailer records the recipients of the emails and the last body
+type fakeMailer struct {
+	to   []string
+	body string
+}
+
+func (m *fakeMailer) Send(_ context.Context, to string, _ string, body string) error {
+	m.to = append(m.to, to)
+	m.body = body
+	return nil
+}
+
+// fakeSMSSender records the texted numbers and the last text
+type fakeSMSSender struct {
+	to   []string
+	text string
+}
+
+func (s *fakeSMSSender) Send(_ context.Context, phone string, text string) error {
+	s.to = append(s.to, phone)
+	s.text = text
+	return nil
+}
+
+// newEnumerationSafeAuth returns the auth service in the enumeration safe
+// mode with a second user, bob, whose contacts the tests try to take
+func newEnumerationSafeAuth(t *testing.T) (*Auth, *sqlite.Storage, *fakeMailer) {
+	t.Helper()
+
+	a, st := newTestAuth(t)
+	mailer := &fakeMailer{}
+	a.mailer = mailer
+	a.emailSaver = st
+	a.userEvents = st
+	a.eventsHub = notify.NewBroadcaster()
+	a.enumerationSafe = true
+
+	if _, err := st.SaveUser(context.Background(), []byte("hash"), bobEmail, "1991-02-03", "Bob", bobPhone, bobTelegram); err != nil {
+		t.Fatal(err)
+	}
+
+	return a, st, mailer
+}
+
+func login(t *testing.T, a *Auth) string {
+	t.Helper()
+
+	token, err := a.Login(context.Background(), testEmail, testPassword, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRegisterEnumerationSafe(t *testing.T) {
+	const (
+		carolEmail    = "carol@example.com"
+		carolPhone    = "+15550102"
+		carolTelegram = "carol_tg"
+	)
+
+	tests := []struct {
+		name     string
+		email    string
+		phone    string
+		telegram string
+		wantTo   []string
+	}{
+		{name: "free contacts", email: carolEmail, phone: carolPhone, telegram: carolTelegram, wantTo: []string{carolEmail}},
+		{name: "taken email", email: bobEmail, phone: carolPhone, telegram: carolTelegram, wantTo: []string{bobEmail}},
+		{name: "taken phone", email: carolEmail, phone: bobPhone, telegram: carolTelegram, wantTo: []string{bobEmail}},
+		{name: "taken telegram name", email: carolEmail, phone: carolPhone, telegram: bobTelegram, wantTo: []string{bobEmail}},
+		{name: "taken by two users", email: carolEmail, phone: "+15550100", telegram: bobTelegram, wantTo: []string{testEmail, bobEmail}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, mailer := newEnumerationSafeAuth(t)
+
+			id, err := a.RegisterNewUser(context.Background(), tt.email, "Quintus.Aurelius.77", "1992-03-04", "Carol", tt.phone, tt.telegram)
+			if err != nil || id != 0 {
+				t.Fatalf("RegisterNewUser() = %d, %v, want 0, nil", id, err)
+			}
+			if !reflect.DeepEqual(mailer.to, tt.wantTo) {
+				t.Errorf("emailed %v, want %v", mailer.to, tt.wantTo)
+			}
+		})
+	}
+}
+
+func TestChangeEmailEnumerationSafe(t *testing.T) {
+	tests := []struct {
+		name   string
+		email  string
+		wantTo []string
+	}{
+		{name: "free email", email: "carol@example.com", wantTo: []string{"carol@example.com"}},
+		{name: "taken email", email: bobEmail, wantTo: []string{bobEmail}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, st, mailer := newEnumerationSafeAuth(t)
+			a.codes = st
+
+			if err := a.ChangeEmail(context.Background(), login(t, a), tt.email); err != nil {
+				t.Fatalf("ChangeEmail() error = %v", err)
+			}
+			if !reflect.DeepEqual(mailer.to, tt.wantTo) {
+				t.Errorf("emailed %v, want %v", mailer.to, tt.wantTo)
+			}
+
+			bob, err := st.User(context.Background(), bobEmail)
+			if err != nil || bob.FullName != "Bob" {
+				t.Errorf("bob = %+v, %v, want unchanged", bob, err)
+			}
+		})
+	}
+}
+
+func TestUpdateProfileEnumerationSafe(t *testing.T) {
+	const (
+		freePhone    = "+15550199"
+		freeTelegram = "carol_tg"
+	)
+
+	tests := []struct {
+		name     string
+		phone    string
+		telegram string
+		wantTo   []string
+		// wantPending are the contacts alice must hold until they are verified
+		wantPending models.User
+	}{
+		{name: "free contacts", phone: freePhone, telegram: freeTelegram},
+		{
+			name:        "taken phone",
+			phone:       bobPhone,
+			telegram:    freeTelegram,
+			wantTo:      []string{bobEmail},
+			wantPending: models.User{PendingPhoneNumber: bobPhone},
+		},
+		{
+			name:        "taken telegram name",
+			phone:       freePhone,
+			telegram:    bobTelegram,
+			wantTo:      []string{bobEmail},
+			wantPending: models.User{PendingTelegramName: bobTelegram},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, st, mailer := newEnumerationSafeAuth(t)
+			ctx := context.Background()
+			token := login(t, a)
+
+			fullName := "Alice Liddell"
+			profile, err := a.UpdateProfile(ctx, token, models.ProfileUpdate{
+				FullName:     &fullName,
+				PhoneNumber:  &tt.phone,
+				TelegramName: &tt.telegram,
+			})
+			if err != nil {
+				t.Fatalf("UpdateProfile() error = %v", err)
+			}
+
+			// the response is the one of a successful update either way
+			got := profile.User
+			if got.FullName != fullName || got.PhoneNumber != tt.phone || got.TelegramName != tt.telegram {
+				t.Errorf("profile = %+v, want the requested values", got)
+			}
+			for _, v := range profile.Verifications {
+				if v.Channel != models.ChannelEmail && v.IsVerified {
+					t.Errorf("%s is verified, want it to be verified again", v.Channel)
+				}
+			}
+			if !reflect.DeepEqual(mailer.to, tt.wantTo) {
+				t.Errorf("emailed %v, want %v", mailer.to, tt.wantTo)
+			}
+
+			again, err := a.GetProfile(ctx, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(again.User, got) {
+				t.Errorf("GetProfile() = %+v, want %+v", again.User, got)
+			}
+
+			alice, err := st.User(ctx, testEmail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if alice.PendingPhoneNumber != tt.wantPending.PendingPhoneNumber || alice.PendingTelegramName != tt.wantPending.PendingTelegramName {
+				t.Errorf("pending contacts = %q, %q, want %q, %q", alice.PendingPhoneNumber, alice.PendingTelegramName,
+					tt.wantPending.PendingPhoneNumber, tt.wantPending.PendingTelegramName)
+			}
+
+			bob, err := st.User(ctx, bobEmail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bob.PhoneNumber != bobPhone || bob.TelegramName != bobTelegram {
+				t.Errorf("bob has %q, %q, want the contacts of bob unchanged", bob.PhoneNumber, bob.TelegramName)
+			}
+		})
+	}
+}
+
+func TestVerifyPendingPhone(t *testing.T) {
+	a, st, _ := newEnumerationSafeAuth(t)
+	sms := &fakeSMSSender{}
+	a.smsSender = sms
+	a.codes = st
+	ctx := context.Background()
+	token := login(t, a)
+
+	phone := bobPhone
+	if _, err := a.UpdateProfile(ctx, token, models.ProfileUpdate{PhoneNumber: &phone}); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func() error {
+		t.Helper()
+
+		if err := a.SendPhoneVerification(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+		if sms.to[len(sms.to)-1] != bobPhone {
+			t.Fatalf("texted %s, want the pending number", sms.to[len(sms.to)-1])
+		}
+		return a.VerifyPhone(ctx, token, regexp.MustCompile(`\d+$`).FindString(sms.text))
+	}
+
+	// bob still has the number, alice keeps it pending
+	if err := verify(); !errors.Is(err, ErrPhoneNumberTaken) {
+		t.Fatalf("VerifyPhone() error = %v, want %v", err, ErrPhoneNumberTaken)
+	}
+
+	alice, err := st.User(ctx, testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.PhoneNumber == bobPhone || alice.PendingPhoneNumber != bobPhone {
+		t.Errorf("alice has %q pending %q, want the number pending", alice.PhoneNumber, alice.PendingPhoneNumber)
+	}
+
+	bob, err := st.User(ctx, bobEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.PhoneNumber != bobPhone {
+		t.Fatalf("bob has %q, want the number kept", bob.PhoneNumber)
+	}
+	bob.PhoneNumber = "+15550103"
+	if err := st.UpdateProfile(ctx, bob, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verify(); err != nil {
+		t.Fatalf("VerifyPhone() error = %v", err)
+	}
+
+	alice, err = st.User(ctx, testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.PhoneNumber != bobPhone || alice.PendingPhoneNumber != "" {
+		t.Errorf("alice has %q pending %q, want the verified number", alice.PhoneNumber, alice.PendingPhoneNumber)
+	}
+}
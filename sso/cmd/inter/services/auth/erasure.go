@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/tracing"
+	"strconv"
+	"time"
+)
+
+// purgeBatch is the number of accounts purged per run
+const purgeBatch = 100
+
+// purgeRetryDelay postpones an account that failed to purge, so it doesn't
+// hold up the rest of the due accounts in the next runs
+const purgeRetryDelay = time.Hour
+
+type dataExport struct {
+	ExportedAt           time.Time                `json:"exported_at"`
+	User                 exportedUser             `json:"user"`
+	ContactVerifications []exportedVerification   `json:"contact_verifications"`
+	AccountConfirmations []exportedConfirmation   `json:"account_confirmations"`
+	Sessions             []exportedSession        `json:"sessions"`
+	ExternalAuth         []exportedExternalAuth   `json:"external_auth"`
+	AuditEvents          []exportedAuditEvent     `json:"audit_events"`
+	PendingDeletion      *exportedAccountDeletion `json:"pending_deletion,omitempty"`
+}
+
+type exportedUser struct {
+	ID             int64  `json:"id"`
+	Email          string `json:"email"`
+	DateOfBirth    string `json:"date_of_birth"`
+	FullName       string `json:"full_name"`
+	PhoneNumber    string `json:"phone_number"`
+	TelegramName   string `json:"telegram_name"`
+	TelegramChatID int64  `json:"telegram_chat_id,omitempty"`
+
+	PendingPhoneNumber  string `json:"pending_phone_number,omitempty"`
+	PendingTelegramName string `json:"pending_telegram_name,omitempty"`
+}
+
+type exportedVerification struct {
+	Channel    string     `json:"channel"`
+	IsVerified bool       `json:"is_verified"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+}
+
+// confirmation codes and access tokens are credentials, they are left out
+type exportedConfirmation struct {
+	ID          int  `json:"id"`
+	IsConfirmed bool `json:"is_confirmed"`
+}
+
+type exportedSession struct {
+	ID        int64     `json:"id"`
+	AppID     int       `json:"app_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportedExternalAuth struct {
+	Provider   string `json:"provider"`
+	ProviderID string `json:"provider_id"`
+}
+
+type exportedAuditEvent struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Event      string    `json:"event"`
+	ActorID    int64     `json:"actor_id"`
+	TargetID   int64     `json:"target_id"`
+	Identifier string    `json:"identifier,omitempty"`
+	AppID      int       `json:"app_id,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Outcome    string    `json:"outcome"`
+	Reason     string    `json:"reason,omitempty"`
+}
+
+type exportedAccountDeletion struct {
+	RequestedAt time.Time `json:"requested_at"`
+	PurgeAfter  time.Time `json:"purge_after"`
+}
+
+// ExportMyData returns a JSON archive of everything stored about the owner of the token
+func (a *Auth) ExportMyData(ctx context.Context, token string) (_ []byte, err error) {
+	const op = "auth.ExportMyData"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	user, err := a.authenticate(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	export := dataExport{
+		ExportedAt: time.Now().UTC(),
+		User: exportedUser{
+			ID:             user.ID,
+			Email:          user.Email,
+			DateOfBirth:    user.DateOfBirth,
+			FullName:       user.FullName,
+			PhoneNumber:    user.PhoneNumber,
+			TelegramName:   user.TelegramName,
+			TelegramChatID: user.TelegramChatID,
+
+			PendingPhoneNumber:  user.PendingPhoneNumber,
+			PendingTelegramName: user.PendingTelegramName,
+		},
+		ContactVerifications: []exportedVerification{},
+		AccountConfirmations: []exportedConfirmation{},
+		Sessions:             []exportedSession{},
+		ExternalAuth:         []exportedExternalAuth{},
+		AuditEvents:          []exportedAuditEvent{},
+	}
+
+	verifications, err := a.verifier.ContactVerifications(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, v := range verifications {
+		ev := exportedVerification{Channel: v.Channel, IsVerified: v.IsVerified}
+		if v.IsVerified {
+			verifiedAt := v.VerifiedAt.UTC()
+			ev.VerifiedAt = &verifiedAt
+		}
+		export.ContactVerifications = append(export.ContactVerifications, ev)
+	}
+
+	confirmations, err := a.accountData.AccountConfirmations(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, c := range confirmations {
+		export.AccountConfirmations = append(export.AccountConfirmations, exportedConfirmation{
+			ID:          c.ConfirmationID,
+			IsConfirmed: c.IsConfirmed,
+		})
+	}
+
+	sessions, err := a.sessions.Sessions(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, s := range sessions {
+		export.Sessions = append(export.Sessions, exportedSession{
+			ID:        s.ID,
+			AppID:     s.AppID,
+			CreatedAt: s.CreatedAt.UTC(),
+		})
+	}
+
+	externalAuths, err := a.accountData.ExternalAuths(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, ea := range externalAuths {
+		export.ExternalAuth = append(export.ExternalAuth, exportedExternalAuth{
+			Provider:   ea.Provider,
+			ProviderID: ea.ProviderID,
+		})
+	}
+
+	events, err := a.accountData.UserAuditEvents(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, e := range events {
+		export.AuditEvents = append(export.AuditEvents, exportedAuditEvent{
+			ID:         e.ID,
+			CreatedAt:  e.CreatedAt.UTC(),
+			Event:      e.Event,
+			ActorID:    e.ActorID,
+			TargetID:   e.TargetID,
+			Identifier: e.Identifier,
+			AppID:      e.AppID,
+			IP:         e.IP,
+			UserAgent:  e.UserAgent,
+			Outcome:    e.Outcome,
+			Reason:     e.Reason,
+		})
+	}
+
+	deletion, found, err := a.accountData.AccountDeletion(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if found {
+		export.PendingDeletion = &exportedAccountDeletion{
+			RequestedAt: deletion.RequestedAt.UTC(),
+			PurgeAfter:  deletion.PurgeAfter.UTC(),
+		}
+	}
+
+	archive, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.logger(ctx).Info("user data exported", slog.String("op", op), slog.Int64("user_id", user.ID))
+	a.audit(ctx, models.AuditDataExport, user.ID, models.AuditOutcomeSuccess, "")
+
+	return archive, nil
+}
+
+// DeleteAccount schedules the purge of the account of the token owner after
+// the grace period and logs them out everywhere. Logging in before the purge
+// cancels the deletion. The password is asked again since the token may be stolen.
+func (a *Auth) DeleteAccount(ctx context.Context, token string, password string) (_ time.Time, err error) {
+	const op = "auth.DeleteAccount"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	user, err := a.authenticate(ctx, token)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log := a.logger(ctx).With(slog.String("op", op), slog.Int64("user_id", user.ID))
+
+	if _, err := a.verifyPassword(ctx, user.PassHash, password); err != nil {
+		log.Info("invalid password", slog.String("error", err.Error()))
+		a.audit(ctx, models.AuditAccountDeletion, user.ID, models.AuditOutcomeFailure, "invalid password")
+
+		return time.Time{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	now := time.Now()
+	deletion, err := a.accountData.ScheduleAccountDeletion(ctx, models.AccountDeletion{
+		UserID:      user.ID,
+		RequestedAt: now,
+		PurgeAfter:  now.Add(a.deletionGracePeriod),
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	revoked, err := a.sessions.DeleteSessions(ctx, user.ID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	purgeAfter := deletion.PurgeAfter.UTC()
+
+	log.Info("account deletion scheduled", slog.Time("purge_after", purgeAfter))
+	a.audit(ctx, models.AuditAccountDeletion, user.ID, models.AuditOutcomeSuccess, "scheduled for "+purgeAfter.Format(time.RFC3339))
+	if revoked > 0 {
+		a.publish(ctx, user.ID, models.UserEventSessionRevoked, map[string]string{
+			"reason": "account_deletion",
+			"count":  strconv.FormatInt(revoked, 10),
+		})
+	}
+
+	body := fmt.Sprintf("Hello, your account will be deleted on %s. "+
+		"If you change your mind, log in before then and the deletion will be cancelled.",
+		purgeAfter.Format("2006-01-02 15:04 MST"))
+	if err := a.mailer.Send(ctx, user.Email, "Account deletion scheduled", body); err != nil {
+		log.Error("failed to send the deletion notice", slog.String("error", err.Error()))
+	}
+
+	return purgeAfter, nil
+}
+
+// cancelDeletion drops a pending deletion of the user who just logged in,
+// failures are only logged so the login goes through
+func (a *Auth) cancelDeletion(ctx context.Context, user models.User) {
+	const op = "auth.cancelDeletion"
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	log := a.logger(ctx).With(slog.String("op", op), slog.Int64("user_id", user.ID))
+
+	cancelled, err := a.accountData.CancelAccountDeletion(ctx, user.ID)
+	if err != nil {
+		tracing.RecordError(span, err)
+		log.Error("failed to cancel the account deletion", slog.String("error", err.Error()))
+		return
+	}
+	if !cancelled {
+		return
+	}
+
+	log.Info("account deletion cancelled by login")
+	a.audit(ctx, models.AuditAccountDeletion, user.ID, models.AuditOutcomeSuccess, "cancelled by login")
+
+	body := "Hello, you have logged in, so your account will not be deleted. " +
+		"If you still want to delete it, request the deletion again."
+	if err := a.mailer.Send(ctx, user.Email, "Account deletion cancelled", body); err != nil {
+		tracing.RecordError(span, err)
+		log.Error("failed to send the cancellation notice", slog.String("error", err.Error()))
+	}
+}
+
+// PurgeDeletedAccounts erases the accounts whose grace period is over and
+// returns how many were purged
+func (a *Auth) PurgeDeletedAccounts(ctx context.Context) (_ int, err error) {
+	const op = "auth.PurgeDeletedAccounts"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	log := a.logger(ctx).With(slog.String("op", op))
+
+	deletions, err := a.accountData.DueAccountDeletions(ctx, purgeBatch)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	mode := "delete"
+	if a.pseudonymize {
+		mode = "pseudonymize"
+	}
+
+	purged := 0
+	for _, deletion := range deletions {
+		if err := a.accountData.PurgeUser(ctx, deletion.UserID, a.pseudonymize); err != nil {
+			if ctx.Err() != nil {
+				return purged, fmt.Errorf("%s: %w", op, ctx.Err())
+			}
+			log.Error("failed to purge the account",
+				slog.Int64("user_id", deletion.UserID),
+				slog.String("error", err.Error()),
+			)
+
+			retryAt := time.Now().Add(purgeRetryDelay)
+			if err := a.accountData.PostponeAccountDeletion(ctx, deletion.UserID, retryAt); err != nil {
+				log.Error("failed to postpone the account purge",
+					slog.Int64("user_id", deletion.UserID),
+					slog.String("error", err.Error()),
+				)
+			}
+			continue
+		}
+		purged++
+
+		log.Info("account purged", slog.Int64("user_id", deletion.UserID), slog.String("mode", mode))
+		a.auditor.Record(ctx, models.AuditEvent{
+			Event:    models.AuditAccountPurge,
+			TargetID: deletion.UserID,
+			Outcome:  models.AuditOutcomeSuccess,
+			Reason:   mode,
+		})
+		a.publish(ctx, deletion.UserID, models.UserEventDeleted, map[string]string{"mode": mode})
+	}
+
+	return purged, nil
+}
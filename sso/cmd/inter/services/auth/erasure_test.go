@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/notify"
+	"sso/sso/cmd/inter/storage/sqlite"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingPurge fails the purge of one user
+type failingPurge struct {
+	*sqlite.Storage
+	userID int64
+}
+
+func (s failingPurge) PurgeUser(ctx context.Context, userID int64, pseudonymize bool) error {
+	if userID == s.userID {
+		return errors.New("disk I/O error")
+	}
+	return s.Storage.PurgeUser(ctx, userID, pseudonymize)
+}
+
+func TestPurgeDeletedAccountsPostponesFailures(t *testing.T) {
+	a, st := newTestAuth(t)
+	a.userEvents = st
+	a.eventsHub = notify.NewBroadcaster()
+	ctx := context.Background()
+
+	alice, err := st.User(ctx, testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobID, err := st.SaveUser(ctx, []byte("hash"), bobEmail, "1991-02-03", "Bob", bobPhone, bobTelegram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.accountData = failingPurge{Storage: st, userID: alice.ID}
+
+	past := time.Now().Add(-time.Minute)
+	for _, id := range []int64{alice.ID, bobID} {
+		if _, err := st.ScheduleAccountDeletion(ctx, models.AccountDeletion{UserID: id, RequestedAt: past, PurgeAfter: past}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purged, err := a.PurgeDeletedAccounts(ctx)
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeDeletedAccounts() = %d, %v, want 1, nil", purged, err)
+	}
+
+	if _, err := st.UserByID(ctx, bobID); err == nil {
+		t.Error("bob is not purged")
+	}
+
+	deletion, found, err := st.AccountDeletion(ctx, alice.ID)
+	if err != nil || !found {
+		t.Fatalf("AccountDeletion() = %v, %v, want the deletion of alice kept", found, err)
+	}
+	if retryAt := time.Now().Add(purgeRetryDelay); deletion.PurgeAfter.Before(retryAt.Add(-time.Minute)) || deletion.PurgeAfter.After(retryAt) {
+		t.Errorf("purge after = %v, want about %v", deletion.PurgeAfter, retryAt)
+	}
+
+	// the next run doesn't retry alice before the delay is over
+	if purged, err := a.PurgeDeletedAccounts(ctx); err != nil || purged != 0 {
+		t.Errorf("PurgeDeletedAccounts() again = %d, %v, want 0, nil", purged, err)
+	}
+}
+
+func TestExportMyData(t *testing.T) {
+	a, st := newTestAuth(t)
+	ctx := context.Background()
+
+	token, err := a.Login(ctx, testEmail, testPassword, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, err := st.User(ctx, testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice.PendingPhoneNumber = bobPhone
+	if err := st.UpdateProfile(ctx, alice, nil); err != nil {
+		t.Fatal(err)
+	}
+	err = st.SaveAuditEvent(ctx, models.AuditEvent{
+		Event:      models.AuditLogin,
+		ActorID:    alice.ID,
+		Identifier: testEmail,
+		IP:         "10.0.0.1",
+		Outcome:    models.AuditOutcomeSuccess,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if _, err := st.ScheduleAccountDeletion(ctx, models.AccountDeletion{UserID: alice.ID, RequestedAt: now, PurgeAfter: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := a.ExportMyData(ctx, token)
+	if err != nil {
+		t.Fatalf("ExportMyData() error = %v", err)
+	}
+
+	var export dataExport
+	if err := json.Unmarshal(archive, &export); err != nil {
+		t.Fatal(err)
+	}
+
+	want := exportedUser{
+		ID:                 alice.ID,
+		Email:              testEmail,
+		DateOfBirth:        "1990-01-02",
+		FullName:           "Alice",
+		PhoneNumber:        "+15550100",
+		TelegramName:       "alice_tg",
+		PendingPhoneNumber: bobPhone,
+	}
+	if export.User != want {
+		t.Errorf("user = %+v, want %+v", export.User, want)
+	}
+	if len(export.Sessions) != 1 || export.Sessions[0].AppID != 1 {
+		t.Errorf("sessions = %+v, want the login session", export.Sessions)
+	}
+	if len(export.AuditEvents) != 1 || export.AuditEvents[0].IP != "10.0.0.1" {
+		t.Errorf("audit events = %+v, want the login", export.AuditEvents)
+	}
+	if export.PendingDeletion == nil {
+		t.Error("pending deletion is missing")
+	}
+
+	// the credentials are left out
+	for _, secret := range []string{token, string(alice.PassHash)} {
+		if strings.Contains(string(archive), secret) {
+			t.Errorf("archive contains the credential %q", secret)
+		}
+	}
+}
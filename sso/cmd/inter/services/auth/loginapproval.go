@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/tracing"
+	"sso/sso/cmd/inter/storage"
+	"time"
+)
+
+const (
+	loginApprovalTTL          = 2 * time.Minute
+	loginApprovalPollInterval = time.Second
+)
+
+var (
+	ErrTelegramNotLinked     = errors.New("telegram is not linked to the account")
+	ErrTelegramUnavailable   = errors.New("telegram bot is not available")
+	ErrLoginApprovalNotFound = errors.New("login approval not found")
+	ErrLoginDenied           = errors.New("login denied")
+	ErrLoginApprovalExpired  = errors.New("login approval expired")
+)
+
+// StartLoginApproval checks the password and sends an approve/deny request to
+// the telegram chat of the user, it returns the id the client should await the
+// decision on. The approval is a second factor, without the password anyone
+// knowing the email could flood the chat with prompts.
+func (a *Auth) StartLoginApproval(ctx context.Context, email string, password string, appID int) (_ string, err error) {
+	const op = "auth.StartLoginApproval"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	log := a.logger(ctx).With(slog.String("op", op), slog.String("email", email))
+
+	if a.notifier == nil {
+		return "", fmt.Errorf("%s: %w", op, ErrTelegramUnavailable)
+	}
+
+	user, err := a.checkCredentials(ctx, log, email, password, appID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.TelegramChatID == 0 {
+		return "", fmt.Errorf("%s: %w", op, ErrTelegramNotLinked)
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	approvalID, err := newApprovalID()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	approval := models.LoginApproval{
+		ID:        approvalID,
+		UserID:    user.ID,
+		AppID:     app.ID,
+		Status:    models.LoginApprovalPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(loginApprovalTTL),
+	}
+	if err := a.approvals.SaveLoginApproval(ctx, approval); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.notifier.SendLoginApproval(ctx, user.TelegramChatID, approvalID, app.Name); err != nil {
+		log.Error("failed to send login approval", slog.String("error", err.Error()))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("login approval requested")
+
+	return approvalID, nil
+}
+
+// DecideLogin approves or denies the login request, the chat must be the one bound to the user
+func (a *Auth) DecideLogin(ctx context.Context, chatID int64, approvalID string, approve bool) (err error) {
+	const op = "auth.DecideLogin"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	if chatID == 0 {
+		return fmt.Errorf("%s: %w", op, ErrInvalidTelegramChat)
+	}
+
+	user, err := a.usrProvider.UserByTelegramChat(ctx, chatID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	status := models.LoginApprovalDenied
+	if approve {
+		status = models.LoginApprovalApproved
+	}
+
+	if err := a.approvals.DecideLoginApproval(ctx, approvalID, user.ID, status); err != nil {
+		if errors.Is(err, storage.ErrLoginApprovalNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrLoginApprovalNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.logger(ctx).Info("login decided",
+		slog.String("op", op),
+		slog.Int64("user_id", user.ID),
+		slog.String("status", status),
+	)
+
+	return nil
+}
+
+// ResendLoginApprovals sends the approve/deny request of every pending login of
+// the user to the chat again and returns how many were sent. Each request is
+// answered on its own, nothing is approved here.
+func (a *Auth) ResendLoginApprovals(ctx context.Context, chatID int64) (_ int, err error) {
+	const op = "auth.ResendLoginApprovals"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	if a.notifier == nil {
+		return 0, fmt.Errorf("%s: %w", op, ErrTelegramUnavailable)
+	}
+	if chatID == 0 {
+		return 0, fmt.Errorf("%s: %w", op, ErrInvalidTelegramChat)
+	}
+
+	user, err := a.usrProvider.UserByTelegramChat(ctx, chatID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	approvals, err := a.approvals.PendingLoginApprovals(ctx, user.ID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, approval := range approvals {
+		app, err := a.appProvider.App(ctx, approval.AppID)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := a.notifier.SendLoginApproval(ctx, chatID, approval.ID, app.Name); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return len(approvals), nil
+}
+
+// AwaitLoginApproval blocks until the login is decided, expires or ctx is done.
+// It returns the token once the login is approved.
+func (a *Auth) AwaitLoginApproval(ctx context.Context, approvalID string) (_ string, err error) {
+	const op = "auth.AwaitLoginApproval"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	ticker := time.NewTicker(loginApprovalPollInterval)
+	defer ticker.Stop()
+
+	for {
+		approval, err := a.approvals.LoginApproval(ctx, approvalID)
+		if err != nil {
+			if errors.Is(err, storage.ErrLoginApprovalNotFound) {
+				return "", fmt.Errorf("%s: %w", op, ErrLoginApprovalNotFound)
+			}
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		switch approval.Status {
+		case models.LoginApprovalApproved:
+			return a.completeLoginApproval(ctx, approval)
+		case models.LoginApprovalDenied:
+			a.auditLogin(ctx, approval.UserID, "", approval.AppID, models.AuditOutcomeFailure, "denied in telegram")
+			return "", fmt.Errorf("%s: %w", op, ErrLoginDenied)
+		case models.LoginApprovalConsumed:
+			return "", fmt.Errorf("%s: %w", op, ErrLoginApprovalNotFound)
+		}
+
+		if time.Now().After(approval.ExpiresAt) {
+			return "", fmt.Errorf("%s: %w", op, ErrLoginApprovalExpired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("%s: %w", op, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Auth) completeLoginApproval(ctx context.Context, approval models.LoginApproval) (_ string, err error) {
+	const op = "auth.completeLoginApproval"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	if err := a.approvals.ConsumeLoginApproval(ctx, approval.ID); err != nil {
+		if errors.Is(err, storage.ErrLoginApprovalNotFound) {
+			return "", fmt.Errorf("%s: %w", op, ErrLoginApprovalNotFound)
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, approval.UserID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := a.issueToken(ctx, user, approval.AppID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.logger(ctx).Info("logged in with telegram approval", slog.String("op", op), slog.Int64("user_id", user.ID))
+	a.auditLogin(ctx, user.ID, user.Email, approval.AppID, models.AuditOutcomeSuccess, "telegram approval")
+
+	return token, nil
+}
+
+func newApprovalID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
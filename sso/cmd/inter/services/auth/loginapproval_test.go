@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeNotifier records what would be sent to the telegram chats
+type fakeNotifier struct {
+	approvals []string
+	texts     []string
+}
+
+func (n *fakeNotifier) SendLoginApproval(_ context.Context, _ int64, approvalID string, _ string) error {
+	n.approvals = append(n.approvals, approvalID)
+	return nil
+}
+
+func (n *fakeNotifier) SendText(_ context.Context, _ int64, text string) error {
+	n.texts = append(n.texts, text)
+	return nil
+}
+
+func TestStartLoginApproval(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		linked   bool
+		wantErr  error
+	}{
+		{name: "approval sent", email: testEmail, password: testPassword, linked: true},
+		{name: "wrong password", email: testEmail, password: "Wrong.Blumenfeld", linked: true, wantErr: ErrInvalidCredentials},
+		{name: "unknown user", email: "bob@example.com", password: testPassword, linked: true, wantErr: ErrInvalidCredentials},
+		{name: "telegram not linked", email: testEmail, password: testPassword, wantErr: ErrTelegramNotLinked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, st := newTestAuth(t)
+			notifier := &fakeNotifier{}
+			a.notifier = notifier
+
+			if tt.linked {
+				if _, err := st.ConfirmAccountTG(context.Background(), "alice_tg", 100); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			approvalID, err := a.StartLoginApproval(context.Background(), tt.email, tt.password, 1)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("StartLoginApproval() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// nobody is prompted unless the password was right
+			wantPrompts := 0
+			if tt.wantErr == nil {
+				wantPrompts = 1
+			}
+			if len(notifier.approvals) != wantPrompts {
+				t.Fatalf("sent %d prompts, want %d", len(notifier.approvals), wantPrompts)
+			}
+			if wantPrompts > 0 && notifier.approvals[0] != approvalID {
+				t.Errorf("prompt for %q, want %q", notifier.approvals[0], approvalID)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+)
+
+// codeAttempts is how many wrong guesses the storage lets a code survive
+const codeAttempts = 5
+
+// startPasswordlessLogin mails a login code for the app and returns it
+func startPasswordlessLogin(t *testing.T, a *Auth, mailer *fakeMailer, appID int) string {
+	t.Helper()
+
+	if err := a.StartPasswordlessLogin(context.Background(), testEmail, appID); err != nil {
+		t.Fatalf("StartPasswordlessLogin() error = %v", err)
+	}
+	code := regexp.MustCompile(`\d{6}`).FindString(mailer.body)
+	if code == "" {
+		t.Fatalf("no login code in %q", mailer.body)
+	}
+	return code
+}
+
+func TestStartPasswordlessLoginUnknownEmail(t *testing.T) {
+	a, _ := newTestAuth(t)
+	mailer := &fakeMailer{}
+	a.mailer = mailer
+
+	if err := a.StartPasswordlessLogin(context.Background(), "nobody@example.com", 1); err != nil {
+		t.Fatalf("StartPasswordlessLogin() error = %v, want nil", err)
+	}
+	if len(mailer.to) != 0 {
+		t.Errorf("emailed %v, want nothing", mailer.to)
+	}
+}
+
+func TestCompletePasswordlessLogin(t *testing.T) {
+	tests := []struct {
+		name string
+		// complete uses the mailed code and returns the error of the last call
+		complete func(a *Auth, code string) error
+		wantErr  error
+	}{
+		{
+			name: "ok",
+			complete: func(a *Auth, code string) error {
+				_, err := a.CompletePasswordlessLogin(context.Background(), testEmail, code, 1)
+				return err
+			},
+		},
+		{
+			name: "another app",
+			complete: func(a *Auth, code string) error {
+				_, err := a.CompletePasswordlessLogin(context.Background(), testEmail, code, 2)
+				return err
+			},
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name: "reused",
+			complete: func(a *Auth, code string) error {
+				if _, err := a.CompletePasswordlessLogin(context.Background(), testEmail, code, 1); err != nil {
+					return err
+				}
+				_, err := a.CompletePasswordlessLogin(context.Background(), testEmail, code, 1)
+				return err
+			},
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name: "attempts left",
+			complete: func(a *Auth, code string) error {
+				for range codeAttempts - 1 {
+					_, _ = a.CompletePasswordlessLogin(context.Background(), testEmail, wrongCode(code), 1)
+				}
+				_, err := a.CompletePasswordlessLogin(context.Background(), testEmail, code, 1)
+				return err
+			},
+		},
+		{
+			name: "too many attempts",
+			complete: func(a *Auth, code string) error {
+				for range codeAttempts {
+					_, _ = a.CompletePasswordlessLogin(context.Background(), testEmail, wrongCode(code), 1)
+				}
+				_, err := a.CompletePasswordlessLogin(context.Background(), testEmail, code, 1)
+				return err
+			},
+			wantErr: ErrInvalidCredentials,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newTestAuth(t)
+			mailer := &fakeMailer{}
+			a.mailer = mailer
+
+			code := startPasswordlessLogin(t, a, mailer, 1)
+
+			if err := tt.complete(a, code); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CompletePasswordlessLogin() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// wrongCode returns another code of the same length
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
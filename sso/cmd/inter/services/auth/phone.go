@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/metrics"
+	"sso/sso/cmd/inter/lib/tracing"
+	"sso/sso/cmd/inter/storage"
+)
+
+// ErrPhoneNumberTaken means a verified pending number still belongs to another user,
+// it stays pending and can be verified again once its owner gives it up
+var ErrPhoneNumberTaken = errors.New("phone number is used by another account")
+
+// SendPhoneVerification texts a verification code to the phone number of the owner of the token,
+// a pending number is verified instead of the current one
+func (a *Auth) SendPhoneVerification(ctx context.Context, token string) (err error) {
+	const op = "auth.SendPhoneVerification"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	user, err := a.authenticate(ctx, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log := a.logger(ctx).With(slog.String("op", op), slog.Int64("user_id", user.ID))
+
+	phoneNumber := user.PhoneNumber
+	if user.PendingPhoneNumber != "" {
+		phoneNumber = user.PendingPhoneNumber
+	}
+
+	// the number is kept with the code, so changing it in between invalidates the code
+	code, err := a.newOneTimeCode(ctx, user.ID, models.CodePurposePhone, phoneNumber)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.smsSender.Send(ctx, phoneNumber, fmt.Sprintf("Your verification code is %s", code))
+	metrics.CodeSent(models.CodePurposePhone, models.ChannelPhone, err)
+	if err != nil {
+		log.Error("failed to send phone verification code", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.audit(ctx, models.AuditPhoneVerificationSent, user.ID, models.AuditOutcomeSuccess, "")
+
+	return nil
+}
+
+// VerifyPhone marks the phone number of the owner of the token as verified if the code matches,
+// a verified pending number replaces the current one unless another user still has it
+func (a *Auth) VerifyPhone(ctx context.Context, token string, code string) (err error) {
+	const op = "auth.VerifyPhone"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	user, err := a.authenticate(ctx, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	otc, err := a.consumeOneTimeCode(ctx, user.ID, models.CodePurposePhone, code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			a.audit(ctx, models.AuditPhoneVerification, user.ID, models.AuditOutcomeFailure, "invalid code")
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch {
+	case otc.Payload == user.PhoneNumber:
+	case otc.Payload == user.PendingPhoneNumber:
+		user.PhoneNumber, user.PendingPhoneNumber = user.PendingPhoneNumber, ""
+
+		if err := a.usrUpdater.UpdateProfile(ctx, user, []string{models.ChannelPhone}); err != nil {
+			if errors.Is(err, storage.ErrUserExists) {
+				a.audit(ctx, models.AuditPhoneVerification, user.ID, models.AuditOutcomeFailure, "phone number is taken")
+				return fmt.Errorf("%s: %w", op, ErrPhoneNumberTaken)
+			}
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	default:
+		a.audit(ctx, models.AuditPhoneVerification, user.ID, models.AuditOutcomeFailure, "phone number changed")
+
+		return fmt.Errorf("%s: %w", op, ErrInvalidCode)
+	}
+
+	if err := a.verifier.SetContactVerified(ctx, user.ID, models.ChannelPhone, true); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.audit(ctx, models.AuditPhoneVerification, user.ID, models.AuditOutcomeSuccess, "")
+	a.publish(ctx, user.ID, models.UserEventVerified, map[string]string{"channel": models.ChannelPhone})
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/tracing"
+	"sso/sso/cmd/inter/storage"
+)
+
+// GetProfile returns the profile of the owner of the token
+func (a *Auth) GetProfile(ctx context.Context, token string) (_ models.Profile, err error) {
+	const op = "auth.GetProfile"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	user, err := a.authenticate(ctx, token)
+	if err != nil {
+		return models.Profile{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	profile, err := a.profile(ctx, user)
+	if err != nil {
+		return models.Profile{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return profile, nil
+}
+
+// UpdateProfile changes the profile of the owner of the token. Changed phone
+// number or telegram name have to be verified again.
+func (a *Auth) UpdateProfile(ctx context.Context, token string, update models.ProfileUpdate) (_ models.Profile, err error) {
+	const op = "auth.UpdateProfile"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	user, err := a.authenticate(ctx, token)
+	if err != nil {
+		return models.Profile{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	updated := user
+	var resetChannels []string
+	if update.FullName != nil {
+		updated.FullName = *update.FullName
+	}
+	if update.DateOfBirth != nil {
+		updated.DateOfBirth = *update.DateOfBirth
+	}
+	// a new contact replaces the pending one
+	if update.PhoneNumber != nil {
+		updated.PendingPhoneNumber = ""
+	}
+	if update.TelegramName != nil {
+		updated.PendingTelegramName = ""
+	}
+	if update.PhoneNumber != nil && *update.PhoneNumber != user.PhoneNumber {
+		updated.PhoneNumber = *update.PhoneNumber
+		resetChannels = append(resetChannels, models.ChannelPhone)
+	}
+	if update.TelegramName != nil && *update.TelegramName != user.TelegramName {
+		updated.TelegramName = *update.TelegramName
+		updated.TelegramChatID = 0
+		resetChannels = append(resetChannels, models.ChannelTelegram)
+	}
+
+	if err := a.usrUpdater.UpdateProfile(ctx, updated, resetChannels); err != nil {
+		if !errors.Is(err, storage.ErrUserExists) {
+			return models.Profile{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		a.audit(ctx, models.AuditProfileUpdate, user.ID, models.AuditOutcomeFailure, "phone number or telegram name is taken")
+		if !a.enumerationSafe {
+			return models.Profile{}, fmt.Errorf("%s: %w", op, ErrUserExists)
+		}
+
+		updated, err = a.holdTakenContacts(ctx, user, update)
+		if err != nil {
+			return models.Profile{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	a.audit(ctx, models.AuditProfileUpdate, user.ID, models.AuditOutcomeSuccess, "")
+
+	profile, err := a.profile(ctx, updated)
+	if err != nil {
+		return models.Profile{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return profile, nil
+}
+
+// profile shows pending contacts in place of the current ones, like contacts
+// that were just changed they are not verified
+func (a *Auth) profile(ctx context.Context, user models.User) (models.Profile, error) {
+	verifications, err := a.verifier.ContactVerifications(ctx, user.ID)
+	if err != nil {
+		return models.Profile{}, err
+	}
+
+	pending := make(map[string]bool)
+	if user.PendingPhoneNumber != "" {
+		user.PhoneNumber = user.PendingPhoneNumber
+		pending[models.ChannelPhone] = true
+	}
+	if user.PendingTelegramName != "" {
+		user.TelegramName = user.PendingTelegramName
+		pending[models.ChannelTelegram] = true
+	}
+	for i, v := range verifications {
+		if pending[v.Channel] {
+			verifications[i] = models.ContactVerification{Channel: v.Channel}
+		}
+	}
+
+	return models.Profile{
+		User:          user,
+		Verifications: verifications,
+	}, nil
+}
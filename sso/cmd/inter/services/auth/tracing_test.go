@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/passhash"
+	"sso/sso/cmd/inter/lib/tracing"
+	"sso/sso/cmd/inter/storage/sqlite"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	testEmail    = "alice@example.com"
+	testPassword = "Tarquinius.Blumenfeld"
+)
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(context.Context, models.AuditEvent) {}
+
+// newTestAuth returns the auth service over a migrated database with app 1
+// and the user testEmail, the storage is returned to arrange the tests
+func newTestAuth(t *testing.T) (*Auth, *sqlite.Storage) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sso.db")
+	base, err := os.ReadFile(filepath.Join("..", "..", "storage", "sqlite", "testdata", "base.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(string(base)); err != nil {
+		t.Fatalf("create base schema: %v", err)
+	}
+
+	ctx := context.Background()
+	st, err := sqlite.New(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := st.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	hasher, err := passhash.New(passhash.Params{Algorithm: passhash.AlgorithmBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := hasher.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.SaveUser(ctx, hash, testEmail, "1990-01-02", "Alice", "+15550100", "alice_tg"); err != nil {
+		t.Fatal(err)
+	}
+
+	a := New(slog.New(slog.NewTextHandler(io.Discard, nil)), Deps{
+		UserSaver:    st,
+		UserProvider: st,
+		AppProvider:  st,
+		UserUpdater:  st,
+		Verifier:     st,
+		Sessions:     st,
+		Approvals:    st,
+		Codes:        st,
+		AccountData:  st,
+		Hasher:       hasher,
+		Auditor:      nopAuditor{},
+	}, Params{TokenTTL: time.Hour, CodeTTL: time.Minute})
+
+	return a, st
+}
+
+// recordSpans installs a provider exporting to memory for the test
+func recordSpans(t *testing.T) func() tracetest.SpanStubs {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.NewProvider(exporter, 1)
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+
+	return func() tracetest.SpanStubs {
+		if err := provider.ForceFlush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return exporter.GetSpans()
+	}
+}
+
+func TestLoginSpans(t *testing.T) {
+	a, _ := newTestAuth(t)
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		// parents maps the spans to the name of their parent span
+		parents map[string]string
+		// failed are the spans that must have the error status
+		failed []string
+	}{
+		{
+			name:     "success",
+			email:    testEmail,
+			password: testPassword,
+			parents: map[string]string{
+				"storage.sqlite.User":                  "auth.Login",
+				"auth.issueToken":                      "auth.Login",
+				"storage.sqlite.App":                   "auth.issueToken",
+				"storage.sqlite.SaveSession":           "auth.issueToken",
+				"auth.cancelDeletion":                  "auth.issueToken",
+				"storage.sqlite.CancelAccountDeletion": "auth.cancelDeletion",
+			},
+		},
+		{
+			name:     "wrong password",
+			email:    testEmail,
+			password: "Wrong.Blumenfeld",
+			parents:  map[string]string{"storage.sqlite.User": "auth.Login"},
+			failed:   []string{"auth.Login"},
+		},
+		{
+			name:     "unknown user",
+			email:    "bob@example.com",
+			password: testPassword,
+			parents:  map[string]string{"storage.sqlite.User": "auth.Login"},
+			failed:   []string{"auth.Login", "storage.sqlite.User"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans := recordSpans(t)
+
+			_, err := a.Login(context.Background(), tt.email, tt.password, 1)
+			if (err != nil) != (len(tt.failed) > 0) {
+				t.Fatalf("Login() error = %v", err)
+			}
+
+			byName := make(map[string]tracetest.SpanStub)
+			for _, span := range spans() {
+				byName[span.Name] = span
+			}
+
+			root, ok := byName["auth.Login"]
+			if !ok {
+				t.Fatal("no auth.Login span")
+			}
+			if root.Parent.IsValid() {
+				t.Errorf("auth.Login has parent %v, want a root span", root.Parent.SpanID())
+			}
+
+			for name, parentName := range tt.parents {
+				span, ok := byName[name]
+				if !ok {
+					t.Errorf("no %s span", name)
+					continue
+				}
+				parent := byName[parentName]
+				if span.Parent.SpanID() != parent.SpanContext.SpanID() {
+					t.Errorf("%s is not a child of %s", name, parentName)
+				}
+				if span.SpanContext.TraceID() != root.SpanContext.TraceID() {
+					t.Errorf("%s is in another trace", name)
+				}
+			}
+
+			for _, name := range tt.failed {
+				span := byName[name]
+				if span.Status.Code != codes.Error || len(span.Events) == 0 {
+					t.Errorf("%s status = %+v with %d events, want the recorded error", name, span.Status, len(span.Events))
+				}
+			}
+			if len(tt.failed) == 0 {
+				for name, span := range byName {
+					if span.Status.Code == codes.Error {
+						t.Errorf("%s failed: %s", name, span.Status.Description)
+					}
+				}
+			}
+		})
+	}
+}
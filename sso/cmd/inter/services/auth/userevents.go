@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/tracing"
+	"time"
+)
+
+const (
+	userEventsBatch = 100
+	// userEventsPollInterval picks up events written by other instances,
+	// events of this one wake the watchers right away
+	userEventsPollInterval = 5 * time.Second
+)
+
+// publish records a state change of the user for WatchUserEvents and the webhooks.
+// The change itself is already done, so a failure is only logged.
+func (a *Auth) publish(ctx context.Context, userID int64, eventType string, data map[string]string) {
+	const op = "auth.publish"
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	_, err := a.userEvents.SaveUserEvent(context.WithoutCancel(ctx), models.UserEvent{
+		UserID: userID,
+		Type:   eventType,
+		Data:   data,
+	})
+	if err != nil {
+		tracing.RecordError(span, err)
+		a.logger(ctx).With(slog.String("op", op)).Error("failed to save user event",
+			slog.String("type", eventType),
+			slog.Int64("user_id", userID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	a.eventsHub.Notify()
+}
+
+// WatchUserEvents passes the events after the cursor to send, oldest first,
+// and keeps waiting for new ones until ctx is done or send fails. Admins only.
+func (a *Auth) WatchUserEvents(ctx context.Context, token string, afterID int64, send func(models.UserEvent) error) (err error) {
+	const op = "auth.WatchUserEvents"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	user, err := a.authenticateAdmin(ctx, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log := a.logger(ctx).With(slog.String("op", op), slog.Int64("user_id", user.ID))
+
+	log.Info("watching user events", slog.Int64("after_id", afterID))
+
+	ticker := time.NewTicker(userEventsPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// taken before reading so an event saved in between isn't missed
+		wake := a.eventsHub.Wait()
+
+		events, err := a.userEvents.UserEvents(ctx, afterID, userEventsBatch)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, event := range events {
+			if err := send(event); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			afterID = event.ID
+		}
+
+		if len(events) == userEventsBatch {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info("stopped watching user events", slog.Int64("after_id", afterID))
+			return nil
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/tracing"
+	"strconv"
+)
+
+const (
+	defaultWebhookPageSize = 50
+	maxWebhookPageSize     = 500
+	webhookSecretBytes     = 32
+)
+
+// CreateWebhookEndpoint registers an endpoint of the app for the event types,
+// admins only. The returned endpoint holds the signing secret, it is not
+// shown again by WebhookEndpoints.
+func (a *Auth) CreateWebhookEndpoint(ctx context.Context, token string, appID int, url string, eventTypes []string) (_ models.WebhookEndpoint, err error) {
+	const op = "auth.CreateWebhookEndpoint"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	admin, err := a.authenticateAdmin(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrPermissionDenied) {
+			a.auditWebhook(ctx, admin.ID, appID, models.AuditOutcomeFailure, "not an admin")
+		}
+		return models.WebhookEndpoint{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := a.appProvider.App(ctx, appID); err != nil {
+		return models.WebhookEndpoint{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return models.WebhookEndpoint{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	eventTypes = slices.Clone(eventTypes)
+	slices.Sort(eventTypes)
+
+	endpoint := models.WebhookEndpoint{
+		AppID:      appID,
+		URL:        url,
+		Secret:     secret,
+		EventTypes: slices.Compact(eventTypes),
+	}
+	endpoint.ID, err = a.webhooks.SaveWebhookEndpoint(ctx, endpoint)
+	if err != nil {
+		return models.WebhookEndpoint{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.logger(ctx).Info("webhook endpoint created",
+		slog.String("op", op),
+		slog.Int64("endpoint_id", endpoint.ID),
+		slog.Int("app_id", appID),
+	)
+	a.auditWebhook(ctx, admin.ID, appID, models.AuditOutcomeSuccess, "endpoint "+strconv.FormatInt(endpoint.ID, 10)+" created")
+
+	return endpoint, nil
+}
+
+// WebhookEndpoints returns the endpoints of the app or of all apps if appID
+// is 0, admins only. failingOnly keeps the endpoints whose last delivery failed.
+func (a *Auth) WebhookEndpoints(ctx context.Context, token string, appID int, failingOnly bool) (_ []models.WebhookEndpoint, err error) {
+	const op = "auth.WebhookEndpoints"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	if _, err := a.authenticateAdmin(ctx, token); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	endpoints, err := a.webhooks.WebhookEndpoints(ctx, appID, failingOnly)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range endpoints {
+		endpoints[i].Secret = ""
+	}
+
+	return endpoints, nil
+}
+
+// WebhookDeliveries returns a page of the deliveries of an endpoint to an admin,
+// newest first. The returned cursor is the BeforeID of the next page, 0 on the last one.
+func (a *Auth) WebhookDeliveries(ctx context.Context, token string, filter models.WebhookDeliveryFilter) (_ []models.WebhookDelivery, _ int64, err error) {
+	const op = "auth.WebhookDeliveries"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	if _, err := a.authenticateAdmin(ctx, token); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := a.webhooks.WebhookEndpoint(ctx, filter.EndpointID); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultWebhookPageSize
+	}
+	limit = min(limit, maxWebhookPageSize)
+
+	// one more delivery tells whether there is a next page
+	filter.Limit = limit + 1
+
+	deliveries, err := a.webhooks.WebhookDeliveries(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var next int64
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		next = deliveries[limit-1].ID
+	}
+
+	return deliveries, next, nil
+}
+
+// ReplayWebhookDeliveries queues the delivery again, or every failed delivery
+// of the endpoint when deliveryID is 0, admins only. It returns the number of
+// queued deliveries.
+func (a *Auth) ReplayWebhookDeliveries(ctx context.Context, token string, endpointID int64, deliveryID int64) (_ int64, err error) {
+	const op = "auth.ReplayWebhookDeliveries"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	admin, err := a.authenticateAdmin(ctx, token)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	endpoint, err := a.webhooks.WebhookEndpoint(ctx, endpointID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	replayed, err := a.webhooks.ReplayWebhookDeliveries(ctx, endpointID, deliveryID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.logger(ctx).Info("webhook deliveries replayed",
+		slog.String("op", op),
+		slog.Int64("endpoint_id", endpointID),
+		slog.Int64("count", replayed),
+	)
+	a.auditWebhook(ctx, admin.ID, endpoint.AppID, models.AuditOutcomeSuccess,
+		fmt.Sprintf("endpoint %d: %d deliveries replayed", endpointID, replayed))
+
+	// wakes up the dispatcher
+	a.eventsHub.Notify()
+
+	return replayed, nil
+}
+
+// SetWebhookEndpointDisabled stops or resumes the deliveries to the endpoint,
+// admins only. Events are not queued for a disabled endpoint.
+func (a *Auth) SetWebhookEndpointDisabled(ctx context.Context, token string, endpointID int64, disabled bool) (err error) {
+	const op = "auth.SetWebhookEndpointDisabled"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	admin, err := a.authenticateAdmin(ctx, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	endpoint, err := a.webhooks.WebhookEndpoint(ctx, endpointID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.webhooks.SetWebhookEndpointDisabled(ctx, endpointID, disabled); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	reason := "enabled"
+	if disabled {
+		reason = "disabled"
+	}
+	a.logger(ctx).Info("webhook endpoint "+reason, slog.String("op", op), slog.Int64("endpoint_id", endpointID))
+	a.auditWebhook(ctx, admin.ID, endpoint.AppID, models.AuditOutcomeSuccess,
+		fmt.Sprintf("endpoint %d %s", endpointID, reason))
+
+	if !disabled {
+		a.eventsHub.Notify()
+	}
+
+	return nil
+}
+
+func (a *Auth) auditWebhook(ctx context.Context, actorID int64, appID int, outcome string, reason string) {
+	a.auditor.Record(ctx, models.AuditEvent{
+		Event:   models.AuditWebhookChange,
+		ActorID: actorID,
+		AppID:   appID,
+		Outcome: outcome,
+		Reason:  reason,
+	})
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
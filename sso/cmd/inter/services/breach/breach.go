@@ -0,0 +1,19 @@
+package breach
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+)
+
+// Checker tells whether a password appears in a corpus of breached passwords.
+type Checker interface {
+	IsBreached(ctx context.Context, password string) (bool, error)
+}
+
+// hashPassword returns the upper-case hex SHA-1 of the password the corpora are keyed by
+func hashPassword(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,256 @@
+package breach
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	hashSize = 20
+	// prefixLen is the length of the hash prefix the range api and range files are keyed by
+	prefixLen = 5
+)
+
+var errUnordered = errors.New("corpus must be ordered by hash")
+
+// FileChecker looks passwords up in a local copy of the Pwned Passwords corpus.
+//
+// The corpus is either a directory of range files named by the 5 character
+// hash prefix, each holding "SUFFIX:COUNT" lines like the range api returns,
+// or a single file of "HASH:COUNT" lines ordered by hash as the official
+// downloader writes it. The corpus is compacted into an index of sorted raw
+// 20 byte hashes that is searched on disk, so it is never loaded into memory.
+type FileChecker struct {
+	source    string
+	indexPath string
+	index     *os.File
+	records   int64
+}
+
+// NewFileChecker opens the index of the corpus at source and rebuilds it
+// first if it is missing or older than the corpus.
+func NewFileChecker(source string, indexPath string) (*FileChecker, error) {
+	const op = "services.breach.NewFileChecker"
+
+	if indexPath == "" {
+		indexPath = strings.TrimRight(source, string(os.PathSeparator)) + ".idx"
+	}
+
+	c := &FileChecker{source: source, indexPath: indexPath}
+
+	stale, err := c.indexIsStale()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if stale {
+		if err := c.buildIndex(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	index, err := os.Open(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	info, err := index.Stat()
+	if err != nil {
+		index.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if info.Size()%hashSize != 0 {
+		index.Close()
+		return nil, fmt.Errorf("%s: index %s is corrupted", op, indexPath)
+	}
+
+	c.index = index
+	c.records = info.Size() / hashSize
+
+	return c, nil
+}
+
+func (c *FileChecker) IsBreached(_ context.Context, password string) (bool, error) {
+	const op = "services.breach.FileChecker.IsBreached"
+
+	target, err := hex.DecodeString(hashPassword(password))
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// ReadAt is safe for concurrent use so lookups don't need a lock
+	var readErr error
+	record := make([]byte, hashSize)
+	i := sort.Search(int(c.records), func(i int) bool {
+		if readErr != nil {
+			return true
+		}
+		if _, err := c.index.ReadAt(record, int64(i)*hashSize); err != nil {
+			readErr = err
+			return true
+		}
+		return bytes.Compare(record, target) >= 0
+	})
+	if readErr != nil {
+		return false, fmt.Errorf("%s: %w", op, readErr)
+	}
+	if int64(i) == c.records {
+		return false, nil
+	}
+
+	if _, err := c.index.ReadAt(record, int64(i)*hashSize); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return bytes.Equal(record, target), nil
+}
+
+// Close closes the index file.
+func (c *FileChecker) Close() error {
+	return c.index.Close()
+}
+
+func (c *FileChecker) indexIsStale() (bool, error) {
+	source, err := os.Stat(c.source)
+	if err != nil {
+		return false, err
+	}
+
+	index, err := os.Stat(c.indexPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return index.ModTime().Before(source.ModTime()), nil
+}
+
+// buildIndex writes the index next to its final path and renames it so a
+// half-written index is never opened.
+func (c *FileChecker) buildIndex() error {
+	tmp, err := os.CreateTemp(filepath.Dir(c.indexPath), filepath.Base(c.indexPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := &indexWriter{w: bufio.NewWriter(tmp)}
+
+	info, err := os.Stat(c.source)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		err = c.indexRangeDir(w)
+	} else {
+		err = indexFile(w, c.source, "")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.indexPath)
+}
+
+func (c *FileChecker) indexRangeDir(w *indexWriter) error {
+	entries, err := os.ReadDir(c.source)
+	if err != nil {
+		return err
+	}
+
+	// os.ReadDir sorts by name so the ranges come in hash order
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		prefix := strings.ToUpper(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		if len(prefix) != prefixLen {
+			continue
+		}
+		if _, err := hex.DecodeString(prefix + "0"); err != nil {
+			continue
+		}
+
+		if err := indexFile(w, filepath.Join(c.source, entry.Name()), prefix); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexFile adds the hashes of the file to the index, prefix is prepended to
+// every line of range files
+func indexFile(w *indexWriter, path string, prefix string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		hash, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hash == "" {
+			continue
+		}
+		// padding entries of the range api have a zero count
+		if found && strings.TrimSpace(count) == "0" {
+			continue
+		}
+
+		raw, err := hex.DecodeString(prefix + hash)
+		if err != nil || len(raw) != hashSize {
+			return fmt.Errorf("%s:%d: invalid hash", path, line)
+		}
+
+		if err := w.write(raw); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// indexWriter writes hashes in ascending order and drops duplicates.
+type indexWriter struct {
+	w    *bufio.Writer
+	last []byte
+}
+
+func (w *indexWriter) write(hash []byte) error {
+	if w.last != nil {
+		switch bytes.Compare(hash, w.last) {
+		case 0:
+			return nil
+		case -1:
+			return errUnordered
+		}
+	}
+
+	if _, err := w.w.Write(hash); err != nil {
+		return err
+	}
+	w.last = append(w.last[:0], hash...)
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package breach
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	breached = []string{"password", "123456", "qwerty", "letmein", "dragon"}
+	safe     = []string{"correct-horse-battery-staple-91", "Tarquinius.Blumenfeld", ""}
+)
+
+// hashCountLines returns the "HASH:COUNT" lines of the passwords ordered by hash
+func hashCountLines(passwords []string) []string {
+	lines := make([]string, 0, len(passwords))
+	for i, p := range passwords {
+		lines = append(lines, fmt.Sprintf("%s:%d", hashPassword(p), i+1))
+	}
+	sort.Strings(lines)
+
+	return lines
+}
+
+func writeFile(t *testing.T, path string, lines ...string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeRangeDir writes the passwords as range files named by the hash prefix
+func writeRangeDir(t *testing.T, dir string, passwords []string) {
+	t.Helper()
+
+	ranges := map[string][]string{}
+	for _, line := range hashCountLines(passwords) {
+		ranges[line[:prefixLen]] = append(ranges[line[:prefixLen]], line[prefixLen:])
+	}
+	for prefix, lines := range ranges {
+		// padding lines the range api adds must not end up in the index
+		lines = append(lines, strings.Repeat("F", 2*hashSize-prefixLen)+":0")
+		writeFile(t, filepath.Join(dir, prefix+".txt"), lines...)
+	}
+}
+
+func assertLookups(t *testing.T, c Checker) {
+	t.Helper()
+
+	for _, p := range breached {
+		if got, err := c.IsBreached(context.Background(), p); err != nil || !got {
+			t.Errorf("IsBreached(%q) = %v, %v, want true", p, got, err)
+		}
+	}
+	for _, p := range safe {
+		if got, err := c.IsBreached(context.Background(), p); err != nil || got {
+			t.Errorf("IsBreached(%q) = %v, %v, want false", p, got, err)
+		}
+	}
+}
+
+func TestFileCheckerHashFile(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "pwned.txt")
+	writeFile(t, source, hashCountLines(breached)...)
+
+	c, err := NewFileChecker(source, "")
+	if err != nil {
+		t.Fatalf("NewFileChecker() error = %v", err)
+	}
+	defer c.Close()
+
+	if c.indexPath != source+".idx" {
+		t.Errorf("index path = %q, want it next to the corpus", c.indexPath)
+	}
+	if c.records != int64(len(breached)) {
+		t.Errorf("records = %d, want %d", c.records, len(breached))
+	}
+
+	assertLookups(t, c)
+}
+
+func TestFileCheckerRangeDir(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "ranges")
+	if err := os.Mkdir(source, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeRangeDir(t, source, breached)
+	// files that aren't named by a hash prefix are skipped
+	writeFile(t, filepath.Join(source, "README.txt"), "not a range")
+
+	c, err := NewFileChecker(source, filepath.Join(dir, "ranges.idx"))
+	if err != nil {
+		t.Fatalf("NewFileChecker() error = %v", err)
+	}
+	defer c.Close()
+
+	if c.records != int64(len(breached)) {
+		t.Errorf("records = %d, want %d without the padding", c.records, len(breached))
+	}
+
+	assertLookups(t, c)
+}
+
+func TestFileCheckerDropsDuplicates(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "pwned.txt")
+	lines := hashCountLines(breached)
+	writeFile(t, source, append([]string{lines[0]}, lines...)...)
+
+	c, err := NewFileChecker(source, "")
+	if err != nil {
+		t.Fatalf("NewFileChecker() error = %v", err)
+	}
+	defer c.Close()
+
+	if c.records != int64(len(breached)) {
+		t.Errorf("records = %d, want %d", c.records, len(breached))
+	}
+}
+
+func TestFileCheckerRebuildsStaleIndex(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "pwned.txt")
+	writeFile(t, source, hashCountLines(breached[:1])...)
+
+	c, err := NewFileChecker(source, "")
+	if err != nil {
+		t.Fatalf("NewFileChecker() error = %v", err)
+	}
+	c.Close()
+
+	writeFile(t, source, hashCountLines(breached)...)
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(source, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = NewFileChecker(source, "")
+	if err != nil {
+		t.Fatalf("NewFileChecker() error = %v", err)
+	}
+	defer c.Close()
+
+	assertLookups(t, c)
+}
+
+func TestFileCheckerInvalidCorpus(t *testing.T) {
+	lines := hashCountLines(breached)
+
+	tests := []struct {
+		name    string
+		lines   []string
+		wantErr string
+	}{
+		{name: "unordered", lines: []string{lines[1], lines[0]}, wantErr: errUnordered.Error()},
+		{name: "not hex", lines: []string{"XYZ:1"}, wantErr: "invalid hash"},
+		{name: "short hash", lines: []string{lines[0][:10] + ":1"}, wantErr: "invalid hash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := filepath.Join(t.TempDir(), "pwned.txt")
+			writeFile(t, source, tt.lines...)
+
+			_, err := NewFileChecker(source, "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("NewFileChecker() error = %v, want %q", err, tt.wantErr)
+			}
+			// a failed build must not leave an index behind
+			if _, err := os.Stat(source + ".idx"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("index exists after a failed build: %v", err)
+			}
+		})
+	}
+}
+
+func TestFileCheckerCorruptedIndex(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "pwned.txt")
+	writeFile(t, source, hashCountLines(breached)...)
+
+	index := source + ".idx"
+	if err := os.WriteFile(index, []byte("short"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(index, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileChecker(source, ""); err == nil || !strings.Contains(err.Error(), "corrupted") {
+		t.Fatalf("NewFileChecker() error = %v, want corrupted index", err)
+	}
+}
@@ -0,0 +1,65 @@
+package breach
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPChecker asks a Pwned Passwords compatible range api, only the first 5
+// characters of the hash leave the service.
+type HTTPChecker struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewHTTPChecker returns a checker for the api at baseURL, e.g. https://api.pwnedpasswords.com
+func NewHTTPChecker(baseURL string, timeout time.Duration) *HTTPChecker {
+	return &HTTPChecker{
+		client:  &http.Client{Timeout: timeout},
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+func (c *HTTPChecker) IsBreached(ctx context.Context, password string) (bool, error) {
+	const op = "services.breach.HTTPChecker.IsBreached"
+
+	hash := hashPassword(password)
+	prefix, suffix := hash[:prefixLen], hash[prefixLen:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/range/"+prefix, nil)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	// padding hides the size of the response from the network
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return false, fmt.Errorf("%s: range api responded with %d: %s", op, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lineSuffix, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(lineSuffix, suffix) {
+			return strings.TrimSpace(count) != "0", nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,72 @@
+package breach
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rangeServer serves the range api over the passwords and records the requested prefixes
+func rangeServer(t *testing.T, passwords []string, requested *[]string) *httptest.Server {
+	t.Helper()
+
+	lines := hashCountLines(passwords)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix, ok := strings.CutPrefix(r.URL.Path, "/range/")
+		if !ok || len(prefix) != prefixLen {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Add-Padding") != "true" {
+			t.Errorf("request without padding")
+		}
+		*requested = append(*requested, prefix)
+
+		for _, line := range lines {
+			if strings.HasPrefix(line, prefix) {
+				// the api answers with lower case suffixes in some mirrors
+				w.Write([]byte(strings.ToLower(line[prefixLen:]) + "\r\n"))
+			}
+		}
+		// padding entry for the suffix of every safe password
+		for _, p := range safe {
+			if hash := hashPassword(p); strings.HasPrefix(hash, prefix) {
+				w.Write([]byte(hash[prefixLen:] + ":0\r\n"))
+			}
+		}
+	}))
+}
+
+func TestHTTPChecker(t *testing.T) {
+	var requested []string
+	srv := rangeServer(t, breached, &requested)
+	defer srv.Close()
+
+	assertLookups(t, NewHTTPChecker(srv.URL+"/", time.Second))
+
+	// only the prefix of the hash leaves the service
+	for _, prefix := range requested {
+		if len(prefix) != prefixLen {
+			t.Errorf("requested %q, want a %d character prefix", prefix, prefixLen)
+		}
+	}
+	if len(requested) != len(breached)+len(safe) {
+		t.Errorf("requests = %d, want one per lookup", len(requested))
+	}
+}
+
+func TestHTTPCheckerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	_, err := NewHTTPChecker(srv.URL, time.Second).IsBreached(context.Background(), "password")
+	if err == nil || !strings.Contains(err.Error(), "429") {
+		t.Fatalf("IsBreached() error = %v, want the status of the api", err)
+	}
+}
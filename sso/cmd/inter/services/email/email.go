@@ -0,0 +1,57 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"gopkg.in/gomail.v2"
+)
+
+type Sender struct {
+	dialer *gomail.Dialer
+	from   string
+}
+
+// New returns a new instance of the smtp email sender
+func New(host string, port int, username string, password string, from string) *Sender {
+	return &Sender{
+		dialer: gomail.NewDialer(host, port, username, password),
+		from:   from,
+	}
+}
+
+// Send sends a html email, ctx is only checked before dialing since gomail doesn't support it.
+func (s *Sender) Send(ctx context.Context, to string, subject string, body string) error {
+	const op = "services.email.Send"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", s.from)
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/html", body)
+
+	if err := s.dialer.DialAndSend(m); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Check returns an error if the smtp server can't be reached.
+func (s *Sender) Check(ctx context.Context) error {
+	const op = "services.email.Check"
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(s.dialer.Host, strconv.Itoa(s.dialer.Port)))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return conn.Close()
+}
@@ -0,0 +1,57 @@
+package erasure
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Purger erases the accounts whose deletion grace period is over.
+type Purger interface {
+	PurgeDeletedAccounts(ctx context.Context) (int, error)
+}
+
+// Job runs the purge of deleted accounts periodically.
+type Job struct {
+	log      *slog.Logger
+	purger   Purger
+	interval time.Duration
+}
+
+// New returns a new instance of the purge job
+func New(log *slog.Logger, purger Purger, interval time.Duration) *Job {
+	return &Job{
+		log:      log,
+		purger:   purger,
+		interval: interval,
+	}
+}
+
+// Run purges right away and then every interval until ctx is cancelled.
+func (j *Job) Run(ctx context.Context) error {
+	const op = "erasure.Run"
+
+	log := j.log.With(slog.String("op", op))
+
+	log.Info("account purge job is running", slog.Duration("interval", j.interval))
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := j.purger.PurgeDeletedAccounts(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error("failed to purge deleted accounts", slog.String("error", err.Error()))
+		}
+		if purged > 0 {
+			log.Info("deleted accounts purged", slog.Int("count", purged))
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info("account purge job stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Service names of the dependencies in grpc.health.v1, the overall status is
+// reported under the empty name.
+const (
+	ServiceStorage  = "storage"
+	ServiceNotifier = "notifier"
+	ServiceTelegram = "telegram"
+)
+
+// Check returns an error if the dependency doesn't work.
+type Check func(ctx context.Context) error
+
+type dependency struct {
+	name string
+	// critical dependencies make the whole service NOT_SERVING
+	critical bool
+	check    Check
+}
+
+// Monitor runs the checks of the dependencies and reports their status through
+// the gRPC health server. Everything is NOT_SERVING until the first checks pass.
+type Monitor struct {
+	log          *slog.Logger
+	server       *health.Server
+	interval     time.Duration
+	timeout      time.Duration
+	dependencies []dependency
+}
+
+// New returns a new instance of the monitor, checks are added with Add before it is run.
+func New(log *slog.Logger, interval time.Duration, timeout time.Duration) *Monitor {
+	server := health.NewServer()
+	server.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	return &Monitor{
+		log:      log,
+		server:   server,
+		interval: interval,
+		timeout:  timeout,
+	}
+}
+
+// Add registers the dependency, it is NOT_SERVING until its check passes.
+func (m *Monitor) Add(name string, critical bool, check Check) {
+	m.dependencies = append(m.dependencies, dependency{name: name, critical: critical, check: check})
+	m.server.SetServingStatus(name, healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// Server is the grpc.health.v1 service to register on the gRPC server.
+func (m *Monitor) Server() *health.Server {
+	return m.server
+}
+
+// Run checks the dependencies right away and then every interval until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.checkAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Monitor) checkAll(ctx context.Context) {
+	const op = "health.checkAll"
+
+	log := m.log.With(slog.String("op", op))
+
+	serving := true
+	for _, dep := range m.dependencies {
+		checkCtx, cancel := context.WithTimeout(ctx, m.timeout)
+		err := dep.check(checkCtx)
+		cancel()
+
+		status := healthpb.HealthCheckResponse_SERVING
+		if err != nil {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+			if dep.critical {
+				serving = false
+			}
+		}
+
+		if m.status(dep.name) != status {
+			if err != nil {
+				log.Warn("dependency is not serving", slog.String("dependency", dep.name), slog.String("error", err.Error()))
+			} else {
+				log.Info("dependency is serving", slog.String("dependency", dep.name))
+			}
+		}
+		// ignored once the server is shut down
+		m.server.SetServingStatus(dep.name, status)
+	}
+
+	if serving {
+		m.server.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	} else {
+		m.server.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+func (m *Monitor) status(service string) healthpb.HealthCheckResponse_ServingStatus {
+	resp, err := m.server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+	return resp.GetStatus()
+}
+
+// Shutdown reports NOT_SERVING for everything from now on, it is called
+// before the server stops so callers move away while requests drain.
+func (m *Monitor) Shutdown() {
+	m.server.Shutdown()
+}
+
+// Liveness answers /healthz: the process is up and handling requests.
+func (m *Monitor) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("ok\n"))
+	})
+}
+
+// Readiness answers /readyz with the status of the service and of every
+// dependency, it returns 503 unless the service is SERVING.
+func (m *Monitor) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		resp := struct {
+			Status       string            `json:"status"`
+			Dependencies map[string]string `json:"dependencies"`
+		}{
+			Status:       m.status("").String(),
+			Dependencies: make(map[string]string, len(m.dependencies)),
+		}
+		for _, dep := range m.dependencies {
+			resp.Dependencies[dep.name] = m.status(dep.name).String()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if resp.Status != healthpb.HealthCheckResponse_SERVING.String() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
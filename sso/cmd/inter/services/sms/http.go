@@ -0,0 +1,63 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPSender sends messages through an sms gateway that accepts
+// POST {"to": "+1...", "text": "..."} with a bearer api key.
+type HTTPSender struct {
+	client *http.Client
+	url    string
+	apiKey string
+}
+
+func NewHTTPSender(url string, apiKey string, timeout time.Duration) *HTTPSender {
+	return &HTTPSender{
+		client: &http.Client{Timeout: timeout},
+		url:    url,
+		apiKey: apiKey,
+	}
+}
+
+type message struct {
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+func (s *HTTPSender) Send(ctx context.Context, phone string, text string) error {
+	const op = "services.sms.HTTPSender.Send"
+
+	body, err := json.Marshal(message{To: phone, Text: text})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: gateway responded with %d: %s", op, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
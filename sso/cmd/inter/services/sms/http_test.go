@@ -0,0 +1,83 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPSenderSend(t *testing.T) {
+	var got message
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer key" {
+			t.Errorf("Authorization = %q, want %q", auth, "Bearer key")
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer gateway.Close()
+
+	sender := NewHTTPSender(gateway.URL, "key", time.Second)
+	if err := sender.Send(context.Background(), "+14155552671", "code 123456"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	want := message{To: "+14155552671", Text: "code 123456"}
+	if got != want {
+		t.Errorf("gateway got %+v, want %+v", got, want)
+	}
+}
+
+func TestHTTPSenderNoAPIKey(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Authorization = %q, want none", auth)
+		}
+	}))
+	defer gateway.Close()
+
+	if err := NewHTTPSender(gateway.URL, "", time.Second).Send(context.Background(), "+14155552671", "hi"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+}
+
+func TestHTTPSenderGatewayError(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unknown destination", http.StatusBadRequest)
+	}))
+	defer gateway.Close()
+
+	err := NewHTTPSender(gateway.URL, "key", time.Second).Send(context.Background(), "+14155552671", "hi")
+	if err == nil {
+		t.Fatal("Send() error = nil, want the gateway error")
+	}
+	if !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "unknown destination") {
+		t.Errorf("Send() error = %v, want status and body of the gateway", err)
+	}
+}
+
+func TestHTTPSenderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer gateway.Close()
+	defer close(release)
+
+	err := NewHTTPSender(gateway.URL, "key", 50*time.Millisecond).Send(context.Background(), "+14155552671", "hi")
+	if err == nil {
+		t.Fatal("Send() error = nil, want a timeout")
+	}
+}
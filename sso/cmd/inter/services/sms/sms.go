@@ -0,0 +1,59 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sender delivers text messages to phone numbers in E.164 format.
+type Sender interface {
+	Send(ctx context.Context, phone string, text string) error
+}
+
+// LogSender writes messages to the log instead of sending them, for local development.
+type LogSender struct {
+	log *slog.Logger
+}
+
+func NewLogSender(log *slog.Logger) *LogSender {
+	return &LogSender{log: log}
+}
+
+func (s *LogSender) Send(_ context.Context, phone string, text string) error {
+	s.log.Info("sms", slog.String("to", phone), slog.String("text", text))
+
+	return nil
+}
+
+// FileSender appends messages to a file instead of sending them, for local development and tests.
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+func (s *FileSender) Send(_ context.Context, phone string, text string) error {
+	const op = "services.sms.FileSender.Send"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(f, "%s\t%s\t%s\n", time.Now().UTC().Format(time.RFC3339), phone, text); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -2,26 +2,125 @@ package telegram
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
-func SendTokenViaTelegram(ctx context.Context, telegramname string) (bool, error) {
-	bot, err := tgbotapi.NewBotAPI("")
-	if err != nil {
-		log.Panic(err)
+// Client is the part of the telegram bot api used by the service,
+// *tgbotapi.BotAPI satisfies it.
+type Client interface {
+	GetUpdatesChan(config tgbotapi.UpdateConfig) (tgbotapi.UpdatesChannel, error)
+	StopReceivingUpdates()
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error)
+}
+
+type Sender struct {
+	log        *slog.Logger
+	client     Client
+	retries    int
+	retryDelay time.Duration
+}
+
+// New returns a new instance of the telegram sender
+func New(log *slog.Logger, client Client, retries int, retryDelay time.Duration) *Sender {
+	if retries < 1 {
+		retries = 1
+	}
+
+	return &Sender{
+		log:        log,
+		client:     client,
+		retries:    retries,
+		retryDelay: retryDelay,
+	}
+}
+
+// Send sends the message and retries it if telegram returns an error.
+func (s *Sender) Send(ctx context.Context, c tgbotapi.Chattable) error {
+	const op = "services.telegram.Send"
+
+	return s.retry(ctx, op, func() error {
+		_, err := s.client.Send(c)
+		return err
+	})
+}
+
+// AnswerCallback answers the callback query and retries it if telegram returns an error.
+func (s *Sender) AnswerCallback(ctx context.Context, c tgbotapi.CallbackConfig) error {
+	const op = "services.telegram.AnswerCallback"
+
+	return s.retry(ctx, op, func() error {
+		_, err := s.client.AnswerCallbackQuery(c)
+		return err
+	})
+}
+
+func (s *Sender) retry(ctx context.Context, op string, fn func() error) error {
+	log := s.log.With(slog.String("op", op))
+
+	var err error
+	for attempt := 1; attempt <= s.retries; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		log.Warn("telegram request failed",
+			slog.Int("attempt", attempt),
+			slog.String("error", err.Error()),
+		)
+
+		if attempt == s.retries {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", op, ctx.Err())
+		case <-time.After(s.retryDelay * time.Duration(attempt)):
+		}
 	}
 
-	bot.Debug = true
+	log.Error("giving up on telegram request", slog.Int("attempts", s.retries))
 
-	// Replace '@non' with the actual chat ID of the user
-	msg := tgbotapi.NewMessageToChannel("@username", "Your message here")
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// SendText sends a plain text message to the chat.
+func (s *Sender) SendText(ctx context.Context, chatID int64, text string) error {
+	const op = "services.telegram.SendText"
 
-	// Send the message
-	_, err = bot.Send(msg)
-	if err != nil {
-		log.Panic(err)
+	if err := s.Send(ctx, tgbotapi.NewMessage(chatID, text)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
-	return true, nil
+
+	return nil
+}
+
+// Callback data prefixes of the login approval buttons, the approval id follows the prefix.
+const (
+	LoginApproveCallback = "login_approve:"
+	LoginDenyCallback    = "login_deny:"
+)
+
+// SendLoginApproval asks the chat to approve or deny a login into the app.
+func (s *Sender) SendLoginApproval(ctx context.Context, chatID int64, approvalID string, appName string) error {
+	const op = "services.telegram.SendLoginApproval"
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Someone is trying to log in to %s with your account. Is it you?", appName))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Approve ✅", LoginApproveCallback+approvalID),
+			tgbotapi.NewInlineKeyboardButtonData("Deny ❌", LoginDenyCallback+approvalID),
+		),
+	)
+
+	if err := s.Send(ctx, msg); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
 }
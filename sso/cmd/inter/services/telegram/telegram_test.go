@@ -0,0 +1,119 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// fakeClient fails the first failures requests and records the rest
+type fakeClient struct {
+	failures int
+	calls    int
+	sent     []tgbotapi.Chattable
+}
+
+func (c *fakeClient) GetUpdatesChan(tgbotapi.UpdateConfig) (tgbotapi.UpdatesChannel, error) {
+	return make(chan tgbotapi.Update), nil
+}
+
+func (c *fakeClient) StopReceivingUpdates() {}
+
+func (c *fakeClient) Send(msg tgbotapi.Chattable) (tgbotapi.Message, error) {
+	c.calls++
+	if c.calls <= c.failures {
+		return tgbotapi.Message{}, errors.New("telegram is down")
+	}
+
+	c.sent = append(c.sent, msg)
+	return tgbotapi.Message{}, nil
+}
+
+func (c *fakeClient) AnswerCallbackQuery(tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error) {
+	c.calls++
+	if c.calls <= c.failures {
+		return tgbotapi.APIResponse{}, errors.New("telegram is down")
+	}
+	return tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func TestSendRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		retries   int
+		failures  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "first attempt", retries: 3, failures: 0, wantCalls: 1},
+		{name: "succeeds on retry", retries: 3, failures: 2, wantCalls: 3},
+		{name: "gives up", retries: 3, failures: 5, wantCalls: 3, wantErr: true},
+		{name: "no retries configured", retries: 0, failures: 1, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{failures: tt.failures}
+			sender := New(slog.New(slog.NewTextHandler(io.Discard, nil)), client, tt.retries, time.Millisecond)
+
+			err := sender.Send(context.Background(), tgbotapi.NewMessage(1, "hi"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if client.calls != tt.wantCalls {
+				t.Errorf("made %d calls, want %d", client.calls, tt.wantCalls)
+			}
+
+			wantSent := 1
+			if tt.wantErr {
+				wantSent = 0
+			}
+			if len(client.sent) != wantSent {
+				t.Errorf("sent %d messages, want %d", len(client.sent), wantSent)
+			}
+		})
+	}
+}
+
+func TestSendStopsWhenContextIsDone(t *testing.T) {
+	client := &fakeClient{failures: 5}
+	sender := New(slog.New(slog.NewTextHandler(io.Discard, nil)), client, 3, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := sender.Send(ctx, tgbotapi.NewMessage(1, "hi"))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Send() error = %v, want context.Canceled", err)
+	}
+	if client.calls != 1 {
+		t.Errorf("made %d calls, want 1", client.calls)
+	}
+}
+
+func TestSendLoginApproval(t *testing.T) {
+	client := &fakeClient{}
+	sender := New(slog.New(slog.NewTextHandler(io.Discard, nil)), client, 1, 0)
+
+	if err := sender.SendLoginApproval(context.Background(), 42, "abc", "shop"); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := client.sent[0].(tgbotapi.MessageConfig)
+	if msg.ChatID != 42 {
+		t.Errorf("sent to chat %d, want 42", msg.ChatID)
+	}
+
+	markup := msg.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+	var data []string
+	for _, button := range markup.InlineKeyboard[0] {
+		data = append(data, *button.CallbackData)
+	}
+	if len(data) != 2 || data[0] != LoginApproveCallback+"abc" || data[1] != LoginDenyCallback+"abc" {
+		t.Errorf("buttons carry %q, want the approve and deny callbacks of abc", data)
+	}
+}
@@ -0,0 +1,325 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/notify"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// cursorName is the key of the fan out position in the webhook cursors
+	cursorName = "deliveries"
+	batchSize  = 100
+	// workers is the number of deliveries posted at once
+	workers       = 8
+	maxRetryDelay = time.Hour
+	// maxLastErrorBytes caps the error kept on the delivery
+	maxLastErrorBytes = 512
+
+	SignatureHeader  = "X-SSO-Signature"
+	EventIDHeader    = "X-SSO-Event-ID"
+	EventTypeHeader  = "X-SSO-Event"
+	DeliveryIDHeader = "X-SSO-Delivery-ID"
+)
+
+type EventStorage interface {
+	UserEvent(ctx context.Context, eventID int64) (models.UserEvent, error)
+	UserEvents(ctx context.Context, afterID int64, limit int) ([]models.UserEvent, error)
+	WebhookCursor(ctx context.Context, name string) (int64, error)
+	SaveWebhookCursor(ctx context.Context, name string, eventID int64) error
+}
+
+type DeliveryStorage interface {
+	WebhookEndpoint(ctx context.Context, endpointID int64) (models.WebhookEndpoint, error)
+	QueueWebhookDeliveries(ctx context.Context, event models.UserEvent) (int64, error)
+	ClaimWebhookDeliveries(ctx context.Context, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	SaveWebhookAttempt(ctx context.Context, delivery models.WebhookDelivery) error
+}
+
+// Dispatcher queues every user event for the endpoints subscribed to its type
+// and posts the due deliveries. A failed delivery is retried with exponential
+// backoff and marked failed after maxAttempts, until an admin replays it.
+// Deliveries of an endpoint are not ordered, receivers can order them by the event id.
+type Dispatcher struct {
+	log          *slog.Logger
+	events       EventStorage
+	deliveries   DeliveryStorage
+	hub          *notify.Broadcaster
+	client       *http.Client
+	timeout      time.Duration
+	maxAttempts  int
+	retryDelay   time.Duration
+	pollInterval time.Duration
+}
+
+// New returns a new instance of the webhook dispatcher
+func New(
+	log *slog.Logger,
+	events EventStorage,
+	deliveries DeliveryStorage,
+	hub *notify.Broadcaster,
+	timeout time.Duration,
+	maxAttempts int,
+	retryDelay time.Duration,
+	pollInterval time.Duration,
+	allowPrivateTargets bool,
+) *Dispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	return &Dispatcher{
+		log:          log,
+		events:       events,
+		deliveries:   deliveries,
+		hub:          hub,
+		client:       newClient(timeout, allowPrivateTargets),
+		timeout:      timeout,
+		maxAttempts:  maxAttempts,
+		retryDelay:   retryDelay,
+		pollInterval: pollInterval,
+	}
+}
+
+// Run queues and delivers events until ctx is cancelled, it resumes after the
+// last queued event.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	const op = "webhook.Run"
+
+	log := d.log.With(slog.String("op", op))
+
+	cursor, err := d.events.WebhookCursor(ctx, cursorName)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("webhook dispatcher is running", slog.Int64("cursor", cursor))
+
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// taken before reading so an event saved in between isn't missed
+		wake := d.hub.Wait()
+
+		more := d.fanOut(ctx, &cursor)
+		delivered := d.deliverDue(ctx)
+
+		if ctx.Err() == nil && (more || delivered == batchSize) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info("webhook dispatcher stopped")
+			return nil
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// fanOut queues the events after the cursor and reports whether there may be more
+func (d *Dispatcher) fanOut(ctx context.Context, cursor *int64) bool {
+	const op = "webhook.fanOut"
+
+	log := d.log.With(slog.String("op", op))
+
+	events, err := d.events.UserEvents(ctx, *cursor, batchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Error("failed to read user events", slog.String("error", err.Error()))
+		}
+		return false
+	}
+
+	for _, event := range events {
+		if _, err := d.deliveries.QueueWebhookDeliveries(ctx, event); err != nil {
+			if ctx.Err() == nil {
+				log.Error("failed to queue webhook deliveries",
+					slog.Int64("event_id", event.ID),
+					slog.String("error", err.Error()),
+				)
+			}
+			// the event is queued again on the next run
+			return false
+		}
+
+		*cursor = event.ID
+		if err := d.events.SaveWebhookCursor(context.WithoutCancel(ctx), cursorName, *cursor); err != nil {
+			log.Error("failed to save webhook cursor", slog.String("error", err.Error()))
+		}
+	}
+
+	return len(events) == batchSize
+}
+
+// deliverDue posts the due deliveries and returns how many were claimed
+func (d *Dispatcher) deliverDue(ctx context.Context) int {
+	const op = "webhook.deliverDue"
+
+	// a delivery is claimed for longer than its attempt can take
+	deliveries, err := d.deliveries.ClaimWebhookDeliveries(ctx, 2*d.timeout+time.Minute, batchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.log.Error("failed to claim webhook deliveries", slog.String("op", op), slog.String("error", err.Error()))
+		}
+		return 0
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, workers)
+	)
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			d.attempt(ctx, delivery)
+		}()
+	}
+	wg.Wait()
+
+	return len(deliveries)
+}
+
+// attempt posts the delivery once and saves the outcome
+func (d *Dispatcher) attempt(ctx context.Context, delivery models.WebhookDelivery) {
+	const op = "webhook.attempt"
+
+	log := d.log.With(
+		slog.String("op", op),
+		slog.Int64("delivery_id", delivery.ID),
+		slog.Int64("endpoint_id", delivery.EndpointID),
+		slog.Int64("event_id", delivery.EventID),
+	)
+
+	err := d.post(ctx, delivery)
+	if ctx.Err() != nil {
+		// shutting down, the claim runs out and the attempt is made again
+		return
+	}
+
+	delivery.Attempts++
+	switch {
+	case err == nil:
+		delivery.Status = models.WebhookDeliveryDelivered
+		delivery.LastError = ""
+	case delivery.Attempts >= d.maxAttempts:
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.LastError = truncate(err.Error(), maxLastErrorBytes)
+		log.Error("giving up on webhook delivery", slog.Int("attempts", delivery.Attempts), slog.String("error", err.Error()))
+	default:
+		delivery.NextAttemptAt = time.Now().Add(d.backoff(delivery.Attempts))
+		delivery.LastError = truncate(err.Error(), maxLastErrorBytes)
+		log.Warn("webhook delivery failed",
+			slog.Int("attempt", delivery.Attempts),
+			slog.Time("next_attempt_at", delivery.NextAttemptAt),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	if err := d.deliveries.SaveWebhookAttempt(context.WithoutCancel(ctx), delivery); err != nil {
+		log.Error("failed to save webhook attempt", slog.String("error", err.Error()))
+	}
+}
+
+// backoff doubles the retry delay after every failed attempt
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxRetryDelay)
+}
+
+type payload struct {
+	ID        int64             `json:"id"`
+	Type      string            `json:"type"`
+	UserID    int64             `json:"user_id"`
+	CreatedAt time.Time         `json:"created_at"`
+	Data      map[string]string `json:"data"`
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery models.WebhookDelivery) error {
+	endpoint, err := d.deliveries.WebhookEndpoint(ctx, delivery.EndpointID)
+	if err != nil {
+		return err
+	}
+
+	event, err := d.events.UserEvent(ctx, delivery.EventID)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(payload{
+		ID:        event.ID,
+		Type:      event.Type,
+		UserID:    event.UserID,
+		CreatedAt: event.CreatedAt.UTC(),
+		Data:      event.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, strconv.FormatInt(event.ID, 10))
+	req.Header.Set(EventTypeHeader, event.Type)
+	req.Header.Set(DeliveryIDHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(endpoint.Secret, time.Now().Unix(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode <= 399 {
+		return fmt.Errorf("%w %d to %s", ErrRedirect, resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("endpoint responded with %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// Sign returns the signature header value "t=<unix time>,v1=<hex hmac>".
+// The HMAC-SHA256 covers "<unix time>.<body>" so receivers can reject replays
+// of old payloads.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
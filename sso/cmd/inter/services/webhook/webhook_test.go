@@ -0,0 +1,378 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/notify"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testSecret     = "whsec_test"
+	testTimeout    = 2 * time.Second
+	testRetryDelay = 30 * time.Second
+)
+
+// fakeStorage keeps one endpoint and its deliveries in memory, claims work
+// like the sqlite storage
+type fakeStorage struct {
+	mu         sync.Mutex
+	endpoint   models.WebhookEndpoint
+	events     map[int64]models.UserEvent
+	deliveries map[int64]*models.WebhookDelivery
+	leases     []time.Duration
+}
+
+func newFakeStorage(url string) *fakeStorage {
+	return &fakeStorage{
+		endpoint:   models.WebhookEndpoint{ID: 1, AppID: 1, URL: url, Secret: testSecret},
+		events:     make(map[int64]models.UserEvent),
+		deliveries: make(map[int64]*models.WebhookDelivery),
+	}
+}
+
+// queue adds an event and its pending delivery with the same id
+func (s *fakeStorage) queue(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events[id] = models.UserEvent{
+		ID:        id,
+		Type:      models.UserEventRegistered,
+		UserID:    42,
+		CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Data:      map[string]string{"email": "alice@example.com"},
+	}
+	s.deliveries[id] = &models.WebhookDelivery{
+		ID:         id,
+		EndpointID: s.endpoint.ID,
+		EventID:    id,
+		Status:     models.WebhookDeliveryPending,
+	}
+}
+
+func (s *fakeStorage) delivery(id int64) models.WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return *s.deliveries[id]
+}
+
+// makeDue moves the next attempt of the delivery to now
+func (s *fakeStorage) makeDue(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deliveries[id].NextAttemptAt = time.Time{}
+}
+
+// replay does what ReplayWebhookDeliveries does for a single delivery
+func (s *fakeStorage) replay(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.deliveries[id]
+	d.Status = models.WebhookDeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = time.Time{}
+	d.LastError = ""
+}
+
+func (s *fakeStorage) UserEvent(_ context.Context, eventID int64) (models.UserEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.events[eventID], nil
+}
+
+func (s *fakeStorage) UserEvents(context.Context, int64, int) ([]models.UserEvent, error) {
+	return nil, nil
+}
+
+func (s *fakeStorage) WebhookCursor(context.Context, string) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStorage) SaveWebhookCursor(context.Context, string, int64) error {
+	return nil
+}
+
+func (s *fakeStorage) WebhookEndpoint(context.Context, int64) (models.WebhookEndpoint, error) {
+	return s.endpoint, nil
+}
+
+func (s *fakeStorage) QueueWebhookDeliveries(context.Context, models.UserEvent) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStorage) ClaimWebhookDeliveries(_ context.Context, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.leases = append(s.leases, lease)
+
+	now := time.Now()
+	var claimed []models.WebhookDelivery
+	for _, d := range s.deliveries {
+		if len(claimed) == limit || d.Status != models.WebhookDeliveryPending || d.NextAttemptAt.After(now) {
+			continue
+		}
+		d.NextAttemptAt = now.Add(lease)
+		claimed = append(claimed, *d)
+	}
+
+	return claimed, nil
+}
+
+func (s *fakeStorage) SaveWebhookAttempt(_ context.Context, delivery models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	*s.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+// newTestDispatcher returns a dispatcher that trusts the certificate of srv,
+// the test server listens on loopback so private targets are allowed
+func newTestDispatcher(t *testing.T, st *fakeStorage, srv *httptest.Server, maxAttempts int, allowPrivate bool) *Dispatcher {
+	t.Helper()
+
+	d := New(slog.New(slog.NewTextHandler(io.Discard, nil)), st, st, notify.NewBroadcaster(),
+		testTimeout, maxAttempts, testRetryDelay, time.Second, allowPrivate)
+	d.client.Transport.(*http.Transport).TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+
+	return d
+}
+
+func TestDeliverySignature(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 1)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header.Clone(), body: body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	st := newFakeStorage(srv.URL)
+	st.queue(7)
+	d := newTestDispatcher(t, st, srv, 3, true)
+
+	if n := d.deliverDue(context.Background()); n != 1 {
+		t.Fatalf("delivered %d, want 1", n)
+	}
+	req := <-requests
+
+	// the signature covers the timestamp it carries and the exact body
+	signature := req.header.Get(SignatureHeader)
+	ts, _, _ := strings.Cut(strings.TrimPrefix(signature, "t="), ",")
+	timestamp, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		t.Fatalf("signature %q has no timestamp", signature)
+	}
+	if want := Sign(testSecret, timestamp, req.body); signature != want {
+		t.Errorf("signature = %q, want %q", signature, want)
+	}
+	if Sign("other secret", timestamp, req.body) == signature {
+		t.Error("signature doesn't depend on the secret")
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age < 0 || age > time.Minute {
+		t.Errorf("signature timestamp is %v old", age)
+	}
+
+	for header, want := range map[string]string{
+		"Content-Type":   "application/json",
+		EventIDHeader:    "7",
+		EventTypeHeader:  models.UserEventRegistered,
+		DeliveryIDHeader: "7",
+	} {
+		if got := req.header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	var p payload
+	if err := json.Unmarshal(req.body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != 7 || p.UserID != 42 || p.Type != models.UserEventRegistered || p.Data["email"] != "alice@example.com" {
+		t.Errorf("payload = %+v", p)
+	}
+
+	got := st.delivery(7)
+	if got.Status != models.WebhookDeliveryDelivered || got.Attempts != 1 || got.LastError != "" {
+		t.Errorf("delivery = %+v, want delivered after 1 attempt", got)
+	}
+
+	// the delivery is claimed for longer than an attempt can take
+	if want := 2*testTimeout + time.Minute; len(st.leases) != 1 || st.leases[0] != want {
+		t.Errorf("leases = %v, want [%v]", st.leases, want)
+	}
+}
+
+func TestRetriesUntilMaxAttempts(t *testing.T) {
+	var (
+		calls atomic.Int32
+		fail  atomic.Bool
+	)
+	fail.Store(true)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if fail.Load() {
+			http.Error(w, "receiver is down", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	const maxAttempts = 3
+	st := newFakeStorage(srv.URL)
+	st.queue(1)
+	d := newTestDispatcher(t, st, srv, maxAttempts, true)
+	ctx := context.Background()
+
+	for attempt := 1; attempt < maxAttempts; attempt++ {
+		before := time.Now()
+		d.deliverDue(ctx)
+
+		got := st.delivery(1)
+		if got.Status != models.WebhookDeliveryPending || got.Attempts != attempt {
+			t.Fatalf("after attempt %d delivery = %+v, want pending", attempt, got)
+		}
+		if !strings.Contains(got.LastError, "500") {
+			t.Errorf("last error = %q, want the status", got.LastError)
+		}
+		wantNext := before.Add(d.backoff(attempt))
+		if got.NextAttemptAt.Before(wantNext) || got.NextAttemptAt.After(wantNext.Add(time.Minute)) {
+			t.Errorf("after attempt %d next attempt at %v, want about %v", attempt, got.NextAttemptAt, wantNext)
+		}
+
+		// the retry isn't due yet
+		if n := d.deliverDue(ctx); n != 0 {
+			t.Errorf("claimed %d deliveries before the retry is due", n)
+		}
+		st.makeDue(1)
+	}
+
+	d.deliverDue(ctx)
+	if got := st.delivery(1); got.Status != models.WebhookDeliveryFailed || got.Attempts != maxAttempts {
+		t.Fatalf("delivery = %+v, want failed after %d attempts", got, maxAttempts)
+	}
+	if n := d.deliverDue(ctx); n != 0 {
+		t.Errorf("claimed %d failed deliveries", n)
+	}
+	if got := calls.Load(); got != maxAttempts {
+		t.Errorf("endpoint called %d times, want %d", got, maxAttempts)
+	}
+
+	// a replayed delivery gets fresh attempts
+	fail.Store(false)
+	st.replay(1)
+	d.deliverDue(ctx)
+	if got := st.delivery(1); got.Status != models.WebhookDeliveryDelivered || got.Attempts != 1 {
+		t.Errorf("replayed delivery = %+v, want delivered after 1 attempt", got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{retryDelay: testRetryDelay}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, maxRetryDelay},
+		{100, maxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := d.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRefusedTargets(t *testing.T) {
+	var redirectedTo atomic.Bool
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirectedTo.Store(true)
+	}))
+	defer target.Close()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		allowPrivate bool
+		wantErr      error
+	}{
+		{name: "redirect", allowPrivate: true, wantErr: ErrRedirect},
+		{name: "loopback", allowPrivate: false, wantErr: ErrPrivateAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newFakeStorage(srv.URL)
+			st.queue(1)
+			d := newTestDispatcher(t, st, srv, 3, tt.allowPrivate)
+
+			err := d.post(context.Background(), st.delivery(1))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("post error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if redirectedTo.Load() {
+		t.Error("the redirect was followed")
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublic(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublic(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
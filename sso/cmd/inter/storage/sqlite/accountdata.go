@@ -0,0 +1,278 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/sso/cmd/inter/domain/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// userTables hold rows of the user that are deleted when the account is purged
+var userTables = []string{
+	"Sessions",
+	"ExternalAuth",
+	"AccountConfirmations",
+	"LoginApprovals",
+	"OneTimeCodes",
+	"ContactVerifications",
+}
+
+func (s *Storage) AccountConfirmations(ctx context.Context, userID int64) (_ []models.AccountConfirmation, err error) {
+	const op = "storage.sqlite.AccountConfirmations"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	rows, err := s.db.QueryContext(ctx, "SELECT ConfirmationID, UserID, COALESCE(ConfirmationToken, ''), IsConfirmed FROM AccountConfirmations WHERE UserID = ? ORDER BY ConfirmationID", userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var confirmations []models.AccountConfirmation
+	for rows.Next() {
+		var c models.AccountConfirmation
+		if err := rows.Scan(&c.ConfirmationID, &c.UserID, &c.ConfirmationToken, &c.IsConfirmed); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		confirmations = append(confirmations, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return confirmations, nil
+}
+
+func (s *Storage) ExternalAuths(ctx context.Context, userID int64) (_ []models.ExternalAuth, err error) {
+	const op = "storage.sqlite.ExternalAuths"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	rows, err := s.db.QueryContext(ctx, "SELECT ExternalAuthID, UserID, Provider, ProviderID FROM ExternalAuth WHERE UserID = ? ORDER BY ExternalAuthID", userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var auths []models.ExternalAuth
+	for rows.Next() {
+		var ea models.ExternalAuth
+		if err := rows.Scan(&ea.ID, &ea.UserID, &ea.Provider, &ea.ProviderID); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		auths = append(auths, ea)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return auths, nil
+}
+
+// UserAuditEvents returns the audit events the user did or was the target of, oldest first
+func (s *Storage) UserAuditEvents(ctx context.Context, userID int64) (_ []models.AuditEvent, err error) {
+	const op = "storage.sqlite.UserAuditEvents"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT EventID, CreatedAt, Event, ActorID, TargetID, Identifier, AppID, IP, UserAgent, Outcome, Reason
+		FROM AuditLog WHERE ActorID = ? OR TargetID = ? ORDER BY EventID`, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var e models.AuditEvent
+		err := rows.Scan(&e.ID, &e.CreatedAt, &e.Event, &e.ActorID, &e.TargetID, &e.Identifier,
+			&e.AppID, &e.IP, &e.UserAgent, &e.Outcome, &e.Reason)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
+
+// ScheduleAccountDeletion saves the deletion request, a pending request is kept
+// as it is and returned instead
+func (s *Storage) ScheduleAccountDeletion(ctx context.Context, deletion models.AccountDeletion) (_ models.AccountDeletion, err error) {
+	const op = "storage.sqlite.ScheduleAccountDeletion"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	_, err = s.db.ExecContext(ctx, "INSERT INTO AccountDeletions (UserID, RequestedAt, PurgeAfter) VALUES (?, ?, ?) ON CONFLICT (UserID) DO NOTHING",
+		deletion.UserID, deletion.RequestedAt.UTC(), deletion.PurgeAfter.UTC())
+	if err != nil {
+		return models.AccountDeletion{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var saved models.AccountDeletion
+	err = s.db.QueryRowContext(ctx, "SELECT UserID, RequestedAt, PurgeAfter FROM AccountDeletions WHERE UserID = ?", deletion.UserID).
+		Scan(&saved.UserID, &saved.RequestedAt, &saved.PurgeAfter)
+	if err != nil {
+		return models.AccountDeletion{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return saved, nil
+}
+
+// CancelAccountDeletion drops the pending deletion of the user and reports whether there was one
+func (s *Storage) CancelAccountDeletion(ctx context.Context, userID int64) (_ bool, err error) {
+	const op = "storage.sqlite.CancelAccountDeletion"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM AccountDeletions WHERE UserID = ?", userID)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return affected > 0, nil
+}
+
+// PostponeAccountDeletion moves the purge of the user to purgeAfter
+func (s *Storage) PostponeAccountDeletion(ctx context.Context, userID int64, purgeAfter time.Time) (err error) {
+	const op = "storage.sqlite.PostponeAccountDeletion"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	_, err = s.db.ExecContext(ctx, "UPDATE AccountDeletions SET PurgeAfter = ? WHERE UserID = ?", purgeAfter.UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DueAccountDeletions returns up to limit deletions whose grace period is over
+func (s *Storage) DueAccountDeletions(ctx context.Context, limit int) (_ []models.AccountDeletion, err error) {
+	const op = "storage.sqlite.DueAccountDeletions"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	rows, err := s.db.QueryContext(ctx, "SELECT UserID, RequestedAt, PurgeAfter FROM AccountDeletions WHERE PurgeAfter <= ? ORDER BY PurgeAfter LIMIT ?",
+		time.Now().UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var deletions []models.AccountDeletion
+	for rows.Next() {
+		var d models.AccountDeletion
+		if err := rows.Scan(&d.UserID, &d.RequestedAt, &d.PurgeAfter); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		deletions = append(deletions, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deletions, nil
+}
+
+// PurgeUser erases the personal data of the user: their rows are deleted,
+// the user is deleted or, with pseudonymize, kept under placeholder values so
+// its id stays valid, and their identifiers are erased from the audit log.
+func (s *Storage) PurgeUser(ctx context.Context, userID int64, pseudonymize bool) (err error) {
+	const op = "storage.sqlite.PurgeUser"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	fields, err := s.loadPII(ctx, tx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var telegramName string
+	if err := tx.QueryRowContext(ctx, "SELECT TelegramName FROM Users WHERE ID = ?", userID).Scan(&telegramName); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// failed logins with an unknown email are matched by the identifier only
+	where := []string{"ActorID = ?", "TargetID = ?"}
+	args := []any{userID, userID}
+	for _, identifier := range []string{fields.Email, fields.PhoneNumber, telegramName} {
+		if identifier != "" {
+			where = append(where, "Identifier = ?")
+			args = append(args, identifier)
+		}
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE AuditLog SET Identifier = '', IP = '', UserAgent = '' WHERE "+
+		strings.Join(where, " OR "), args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, table := range userTables {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE UserID = ?", userID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if pseudonymize {
+		placeholder := "deleted-" + strconv.FormatInt(userID, 10)
+		err = s.updatePII(ctx, tx, userID, func(fields *piiFields) {
+			*fields = piiFields{Email: placeholder + "@deleted.invalid", PhoneNumber: placeholder}
+		})
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `UPDATE Users SET PasswordHash = X'', TelegramName = ?, PendingTelegramName = '',
+				TelegramChatID = NULL, is_admin = FALSE WHERE ID = ?`, placeholder, userID)
+		}
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM Users WHERE ID = ?", userID)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM AccountDeletions WHERE UserID = ?", userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// AccountDeletion returns the pending deletion of the user, found is false if there is none
+func (s *Storage) AccountDeletion(ctx context.Context, userID int64) (deletion models.AccountDeletion, found bool, err error) {
+	const op = "storage.sqlite.AccountDeletion"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	err = s.db.QueryRowContext(ctx, "SELECT UserID, RequestedAt, PurgeAfter FROM AccountDeletions WHERE UserID = ?", userID).
+		Scan(&deletion.UserID, &deletion.RequestedAt, &deletion.PurgeAfter)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.AccountDeletion{}, false, nil
+	}
+	if err != nil {
+		return models.AccountDeletion{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deletion, true, nil
+}
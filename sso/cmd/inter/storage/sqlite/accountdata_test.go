@@ -0,0 +1,177 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/storage"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// userRows are the statements adding a row of the user to each of userTables
+var userRows = map[string]string{
+	"Sessions":             "INSERT INTO Sessions (UserID, AppID, AccessToken) VALUES (?, 1, 'token')",
+	"ExternalAuth":         "INSERT INTO ExternalAuth (UserID, Provider, ProviderID) VALUES (?, 'github', '42')",
+	"AccountConfirmations": "INSERT INTO AccountConfirmations (UserID, ConfirmationToken) VALUES (?, 'token')",
+	"LoginApprovals": `INSERT INTO LoginApprovals (ApprovalID, UserID, AppID, CreatedAt, ExpiresAt)
+		VALUES (hex(randomblob(16)), ?, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+	"OneTimeCodes":         "INSERT INTO OneTimeCodes (UserID, Purpose, CodeHash, ExpiresAt) VALUES (?, 'login', 'hash', CURRENT_TIMESTAMP)",
+	"ContactVerifications": "INSERT INTO ContactVerifications (UserID, Channel) VALUES (?, 'email')",
+}
+
+// addUserRows adds a row of the user to every table purged with it
+func addUserRows(t *testing.T, s *Storage, userID int64) {
+	t.Helper()
+
+	for _, table := range userTables {
+		query, ok := userRows[table]
+		if !ok {
+			t.Fatalf("no test row for %s", table)
+		}
+		if _, err := s.db.Exec(query, userID); err != nil {
+			t.Fatalf("insert into %s: %v", table, err)
+		}
+	}
+}
+
+func countUserRows(t *testing.T, s *Storage, table string, userID int64) int {
+	t.Helper()
+
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE UserID = ?", userID).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestPurgeUser(t *testing.T) {
+	for _, pseudonymize := range []bool{false, true} {
+		t.Run("pseudonymize "+strconv.FormatBool(pseudonymize), func(t *testing.T) {
+			s := newTestStorage(t, testKeyring(t, "k1"), true)
+			ctx := context.Background()
+
+			aliceID := saveUser(t, s, alice)
+			bobID := saveUser(t, s, bob)
+			addUserRows(t, s, aliceID)
+			addUserRows(t, s, bobID)
+
+			events := []models.AuditEvent{
+				{Event: models.AuditLogin, ActorID: aliceID, Identifier: alice.email, IP: "10.0.0.1", UserAgent: "curl"},
+				{Event: models.AuditRoleChange, ActorID: bobID, TargetID: aliceID, Identifier: alice.phone, IP: "10.0.0.2", UserAgent: "curl"},
+				// a failed login names alice by the telegram name only
+				{Event: models.AuditLogin, Identifier: alice.telegram, IP: "10.0.0.3", UserAgent: "curl"},
+				{Event: models.AuditLogin, ActorID: bobID, Identifier: bob.email, IP: "10.0.0.4", UserAgent: "curl"},
+			}
+			for _, e := range events {
+				e.Outcome = models.AuditOutcomeSuccess
+				if err := s.SaveAuditEvent(ctx, e); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			now := time.Now()
+			if _, err := s.ScheduleAccountDeletion(ctx, models.AccountDeletion{UserID: aliceID, RequestedAt: now, PurgeAfter: now}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.PurgeUser(ctx, aliceID, pseudonymize); err != nil {
+				t.Fatalf("PurgeUser() error = %v", err)
+			}
+
+			for _, table := range userTables {
+				if n := countUserRows(t, s, table, aliceID); n != 0 {
+					t.Errorf("%s has %d rows of alice, want none", table, n)
+				}
+				if n := countUserRows(t, s, table, bobID); n != 1 {
+					t.Errorf("%s has %d rows of bob, want 1", table, n)
+				}
+			}
+
+			if _, found, err := s.AccountDeletion(ctx, aliceID); err != nil || found {
+				t.Errorf("AccountDeletion() = %v, %v, want the deletion dropped", found, err)
+			}
+
+			// the events stay, only the identifiers of alice are erased
+			rows, err := s.db.Query("SELECT Identifier, IP, UserAgent FROM AuditLog ORDER BY EventID")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			var i int
+			for ; rows.Next(); i++ {
+				var identifier, ip, userAgent string
+				if err := rows.Scan(&identifier, &ip, &userAgent); err != nil {
+					t.Fatal(err)
+				}
+				want := events[i]
+				if i < 3 {
+					want.Identifier, want.IP, want.UserAgent = "", "", ""
+				}
+				if identifier != want.Identifier || ip != want.IP || userAgent != want.UserAgent {
+					t.Errorf("event %d = %q, %q, %q, want %q, %q, %q", i, identifier, ip, userAgent, want.Identifier, want.IP, want.UserAgent)
+				}
+			}
+			if i != len(events) {
+				t.Errorf("%d audit events, want %d", i, len(events))
+			}
+			logged, err := s.UserAuditEvents(ctx, bobID)
+			if err != nil || len(logged) != 2 {
+				t.Errorf("UserAuditEvents(bob) = %d events, %v, want 2", len(logged), err)
+			}
+
+			if _, err := s.User(ctx, alice.email); !errors.Is(err, storage.ErrUserNotFound) {
+				t.Errorf("User(%s) error = %v, want %v", alice.email, err, storage.ErrUserNotFound)
+			}
+			assertUser(t, s, bobID, bob)
+
+			user, err := s.UserByID(ctx, aliceID)
+			if !pseudonymize {
+				if !errors.Is(err, storage.ErrUserNotFound) {
+					t.Errorf("UserByID() error = %v, want %v", err, storage.ErrUserNotFound)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UserByID() error = %v, want the row kept", err)
+			}
+			placeholder := "deleted-" + strconv.FormatInt(aliceID, 10)
+			want := models.User{
+				ID:           aliceID,
+				Email:        placeholder + "@deleted.invalid",
+				PhoneNumber:  placeholder,
+				TelegramName: placeholder,
+			}
+			if user.Email != want.Email || user.PhoneNumber != want.PhoneNumber || user.TelegramName != want.TelegramName ||
+				user.FullName != "" || user.DateOfBirth != "" || len(user.PassHash) != 0 {
+				t.Errorf("pseudonymized user = %+v, want %+v", user, want)
+			}
+		})
+	}
+}
+
+func TestPostponeAccountDeletion(t *testing.T) {
+	s := newTestStorage(t, nil, true)
+	ctx := context.Background()
+
+	id := saveUser(t, s, alice)
+	now := time.Now()
+	if _, err := s.ScheduleAccountDeletion(ctx, models.AccountDeletion{UserID: id, RequestedAt: now, PurgeAfter: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := s.DueAccountDeletions(ctx, 10)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("DueAccountDeletions() = %v, %v, want the deletion", due, err)
+	}
+
+	if err := s.PostponeAccountDeletion(ctx, id, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err = s.DueAccountDeletions(ctx, 10)
+	if err != nil || len(due) != 0 {
+		t.Fatalf("DueAccountDeletions() = %v, %v, want none after the postponement", due, err)
+	}
+}
@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"sso/sso/cmd/inter/domain/models"
+	"strings"
+	"time"
+)
+
+// SaveAuditEvent appends the event to the audit log
+func (s *Storage) SaveAuditEvent(ctx context.Context, event models.AuditEvent) (err error) {
+	const op = "storage.sqlite.SaveAuditEvent"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	createdAt := event.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO AuditLog
+		(CreatedAt, Event, ActorID, TargetID, Identifier, AppID, IP, UserAgent, Outcome, Reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		createdAt.UTC(), event.Event, event.ActorID, event.TargetID, event.Identifier,
+		event.AppID, event.IP, event.UserAgent, event.Outcome, event.Reason)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// AuditEvents returns the events matching the filter, newest first
+func (s *Storage) AuditEvents(ctx context.Context, filter models.AuditFilter) (_ []models.AuditEvent, err error) {
+	const op = "storage.sqlite.AuditEvents"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	var (
+		where []string
+		args  []any
+	)
+	if filter.Event != "" {
+		where = append(where, "Event = ?")
+		args = append(args, filter.Event)
+	}
+	if filter.ActorID != 0 {
+		where = append(where, "ActorID = ?")
+		args = append(args, filter.ActorID)
+	}
+	if filter.TargetID != 0 {
+		where = append(where, "TargetID = ?")
+		args = append(args, filter.TargetID)
+	}
+	if filter.AppID != 0 {
+		where = append(where, "AppID = ?")
+		args = append(args, filter.AppID)
+	}
+	if filter.Outcome != "" {
+		where = append(where, "Outcome = ?")
+		args = append(args, filter.Outcome)
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "CreatedAt >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "CreatedAt < ?")
+		args = append(args, filter.Until.UTC())
+	}
+	if filter.BeforeID != 0 {
+		where = append(where, "EventID < ?")
+		args = append(args, filter.BeforeID)
+	}
+
+	query := "SELECT EventID, CreatedAt, Event, ActorID, TargetID, Identifier, AppID, IP, UserAgent, Outcome, Reason FROM AuditLog"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY EventID DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var e models.AuditEvent
+		err := rows.Scan(&e.ID, &e.CreatedAt, &e.Event, &e.ActorID, &e.TargetID, &e.Identifier,
+			&e.AppID, &e.IP, &e.UserAgent, &e.Outcome, &e.Reason)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
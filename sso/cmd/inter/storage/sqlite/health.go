@@ -0,0 +1,53 @@
+package sqlite
+
+import (
+	"context"
+	"embed"
+	"fmt"
+)
+
+//go:embed migrations/*.up.sql
+var migrations embed.FS
+
+// Ready returns an error until the database is reachable and every migration
+// of this build is applied.
+func (s *Storage) Ready(ctx context.Context) error {
+	const op = "storage.sqlite.Ready"
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	latest, err := latestMigration()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the table of golang-migrate
+	var (
+		version uint64
+		dirty   bool
+	)
+	err = s.db.QueryRowContext(ctx, "SELECT version, dirty FROM migrations").Scan(&version, &dirty)
+	if err != nil {
+		return fmt.Errorf("%s: migrations are not applied: %w", op, err)
+	}
+	if dirty {
+		return fmt.Errorf("%s: migration %d failed halfway", op, version)
+	}
+	if version < latest {
+		return fmt.Errorf("%s: database is at migration %d, %d is required, run the migrator", op, version, latest)
+	}
+
+	return nil
+}
+
+// latestMigration is the highest version of the embedded migrations
+func latestMigration() (uint64, error) {
+	list, err := embeddedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	return list[len(list)-1].version, nil
+}
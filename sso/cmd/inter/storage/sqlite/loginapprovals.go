@@ -0,0 +1,119 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/storage"
+	"time"
+)
+
+// PendingLoginApprovals returns the pending, not expired approvals of the user, oldest first
+func (s *Storage) PendingLoginApprovals(ctx context.Context, userID int64) (_ []models.LoginApproval, err error) {
+	const op = "storage.sqlite.PendingLoginApprovals"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT ApprovalID, UserID, AppID, Status, CreatedAt, ExpiresAt FROM LoginApprovals
+		WHERE UserID = ? AND Status = ? AND ExpiresAt > ? ORDER BY CreatedAt`,
+		userID, models.LoginApprovalPending, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var approvals []models.LoginApproval
+	for rows.Next() {
+		var approval models.LoginApproval
+		if err := rows.Scan(&approval.ID, &approval.UserID, &approval.AppID, &approval.Status, &approval.CreatedAt, &approval.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		approvals = append(approvals, approval)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return approvals, nil
+}
+
+func (s *Storage) SaveLoginApproval(ctx context.Context, approval models.LoginApproval) (err error) {
+	const op = "storage.sqlite.SaveLoginApproval"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	_, err = s.db.ExecContext(ctx, "INSERT INTO LoginApprovals (ApprovalID, UserID, AppID, Status, CreatedAt, ExpiresAt) VALUES (?, ?, ?, ?, ?, ?)",
+		approval.ID, approval.UserID, approval.AppID, approval.Status, approval.CreatedAt.UTC(), approval.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) LoginApproval(ctx context.Context, approvalID string) (_ models.LoginApproval, err error) {
+	const op = "storage.sqlite.LoginApproval"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	var approval models.LoginApproval
+	err = s.db.QueryRowContext(ctx, "SELECT ApprovalID, UserID, AppID, Status, CreatedAt, ExpiresAt FROM LoginApprovals WHERE ApprovalID = ?", approvalID).
+		Scan(&approval.ID, &approval.UserID, &approval.AppID, &approval.Status, &approval.CreatedAt, &approval.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.LoginApproval{}, fmt.Errorf("%s: %w", op, storage.ErrLoginApprovalNotFound)
+		}
+
+		return models.LoginApproval{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return approval, nil
+}
+
+// DecideLoginApproval sets the status of a pending, not expired approval that belongs to the user
+func (s *Storage) DecideLoginApproval(ctx context.Context, approvalID string, userID int64, status string) (err error) {
+	const op = "storage.sqlite.DecideLoginApproval"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	res, err := s.db.ExecContext(ctx, "UPDATE LoginApprovals SET Status = ? WHERE ApprovalID = ? AND UserID = ? AND Status = ? AND ExpiresAt > ?",
+		status, approvalID, userID, models.LoginApprovalPending, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrLoginApprovalNotFound)
+	}
+
+	return nil
+}
+
+// ConsumeLoginApproval marks an approved login as consumed, so only one token is issued for it
+func (s *Storage) ConsumeLoginApproval(ctx context.Context, approvalID string) (err error) {
+	const op = "storage.sqlite.ConsumeLoginApproval"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	res, err := s.db.ExecContext(ctx, "UPDATE LoginApprovals SET Status = ? WHERE ApprovalID = ? AND Status = ?",
+		models.LoginApprovalConsumed, approvalID, models.LoginApprovalApproved)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrLoginApprovalNotFound)
+	}
+
+	return nil
+}
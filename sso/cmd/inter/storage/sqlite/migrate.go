@@ -0,0 +1,115 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// baseVersion is the version of the schema sso.db ships with, the embedded
+// migrations start after it
+const baseVersion = 2
+
+type migration struct {
+	version uint64
+	file    string
+}
+
+// Migrate applies the embedded migrations the database is missing, each in
+// its own transaction, and returns the version before and after. It keeps
+// the migrations table of golang-migrate so both can be used.
+func (s *Storage) Migrate(ctx context.Context) (uint64, uint64, error) {
+	const op = "storage.sqlite.Migrate"
+
+	pending, err := embeddedMigrations()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var (
+		version uint64
+		dirty   bool
+	)
+	err = s.db.QueryRowContext(ctx, "SELECT version, dirty FROM migrations").Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || strings.Contains(err.Error(), "no such table") {
+			return 0, 0, fmt.Errorf("%s: the database has no schema, create it from sso.db (migration %d)", op, baseVersion)
+		}
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if dirty {
+		return version, version, fmt.Errorf("%s: migration %d failed halfway, fix it by hand first", op, version)
+	}
+	if version < baseVersion {
+		return version, version, fmt.Errorf("%s: migration %d is older than the schema of sso.db", op, version)
+	}
+
+	from := version
+	for _, m := range pending {
+		if m.version <= version {
+			continue
+		}
+
+		if err := s.applyMigration(ctx, m); err != nil {
+			return from, version, fmt.Errorf("%s: %s: %w", op, m.file, err)
+		}
+		version = m.version
+	}
+
+	return from, version, nil
+}
+
+func (s *Storage) applyMigration(ctx context.Context, m migration) error {
+	query, err := fs.ReadFile(migrations, m.file)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, string(query)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE migrations SET version = ?, dirty = FALSE", m.version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// embeddedMigrations returns the up migrations of this build ordered by version
+func embeddedMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrations, "migrations/*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var list []migration
+	for _, file := range files {
+		prefix, _, found := strings.Cut(strings.TrimPrefix(file, "migrations/"), "_")
+		if !found {
+			continue
+		}
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+		list = append(list, migration{version: version, file: file})
+	}
+	if len(list) == 0 {
+		return nil, errors.New("no migrations are embedded")
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].version < list[j].version })
+
+	return list, nil
+}
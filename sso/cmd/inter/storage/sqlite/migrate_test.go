@@ -0,0 +1,62 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, nil, false)
+
+	if err := s.Ready(ctx); err == nil {
+		t.Fatal("Ready() = nil before the migrations")
+	}
+
+	latest, err := latestMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from, to, err := s.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if from != baseVersion || to != latest {
+		t.Errorf("Migrate() = %d, %d, want %d, %d", from, to, baseVersion, latest)
+	}
+	if err := s.Ready(ctx); err != nil {
+		t.Errorf("Ready() error = %v after the migrations", err)
+	}
+
+	// running again is a no-op
+	from, to, err = s.Migrate(ctx)
+	if err != nil || from != latest || to != latest {
+		t.Errorf("second Migrate() = %d, %d, %v, want %d, %d", from, to, err, latest, latest)
+	}
+}
+
+func TestMigrateDirty(t *testing.T) {
+	s := newTestStorage(t, nil, false)
+	if _, err := s.db.Exec("UPDATE migrations SET version = 5, dirty = TRUE"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.Migrate(context.Background()); err == nil || !strings.Contains(err.Error(), "halfway") {
+		t.Fatalf("Migrate() error = %v, want the dirty migration", err)
+	}
+}
+
+func TestMigrateEmptyDatabase(t *testing.T) {
+	s, err := New(filepath.Join(t.TempDir(), "empty.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.db.Close()
+
+	if _, _, err := s.Migrate(context.Background()); err == nil || !strings.Contains(err.Error(), "sso.db") {
+		t.Fatalf("Migrate() error = %v, want a hint to start from sso.db", err)
+	}
+}
@@ -0,0 +1,9 @@
+-- encrypted rows can't be read after this, decrypt them with rotatekeys -decrypt first
+DROP INDEX users_key_id;
+DROP INDEX users_phone_index;
+DROP INDEX users_email_index;
+
+ALTER TABLE Users DROP COLUMN KeyID;
+ALTER TABLE Users DROP COLUMN DataKey;
+ALTER TABLE Users DROP COLUMN PhoneIndex;
+ALTER TABLE Users DROP COLUMN EmailIndex;
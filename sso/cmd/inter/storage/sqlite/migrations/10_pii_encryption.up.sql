@@ -0,0 +1,12 @@
+-- Email, PhoneNumber, DateOfBirth and Fullname hold ciphertext once a row is
+-- encrypted, so their lookups and uniqueness move to the blind indexes.
+-- Rows written before keep their plaintext until they are rotated.
+ALTER TABLE Users ADD COLUMN EmailIndex TEXT;
+ALTER TABLE Users ADD COLUMN PhoneIndex TEXT;
+-- DataKey is the data key of the row wrapped by the master key KeyID
+ALTER TABLE Users ADD COLUMN DataKey BLOB;
+ALTER TABLE Users ADD COLUMN KeyID TEXT;
+
+CREATE UNIQUE INDEX users_email_index ON Users (EmailIndex);
+CREATE UNIQUE INDEX users_phone_index ON Users (PhoneIndex);
+CREATE INDEX users_key_id ON Users (KeyID);
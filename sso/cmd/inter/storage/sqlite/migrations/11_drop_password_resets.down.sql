@@ -0,0 +1 @@
+CREATE TABLE PasswordResets (ResetID INTEGER PRIMARY KEY AUTOINCREMENT, UserID INTEGER NOT NULL, ResetToken TEXT NOT NULL, ExpiresAt DATETIME NOT NULL, FOREIGN KEY (UserID) REFERENCES Users (ID));
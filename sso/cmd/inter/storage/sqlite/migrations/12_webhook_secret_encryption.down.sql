@@ -0,0 +1,2 @@
+ALTER TABLE WebhookEndpoints DROP COLUMN KeyID;
+ALTER TABLE WebhookEndpoints DROP COLUMN DataKey;
@@ -0,0 +1,4 @@
+-- Secret holds ciphertext once the endpoint is encrypted, DataKey is its
+-- data key wrapped by the master key KeyID like the one of Users
+ALTER TABLE WebhookEndpoints ADD COLUMN DataKey BLOB;
+ALTER TABLE WebhookEndpoints ADD COLUMN KeyID TEXT;
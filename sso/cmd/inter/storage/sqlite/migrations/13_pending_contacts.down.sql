@@ -0,0 +1,3 @@
+DROP INDEX users_pending_telegram_name;
+ALTER TABLE Users DROP COLUMN PendingTelegramName;
+ALTER TABLE Users DROP COLUMN PendingPhoneNumber;
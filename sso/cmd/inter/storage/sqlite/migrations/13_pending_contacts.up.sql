@@ -0,0 +1,8 @@
+-- PendingPhoneNumber and PendingTelegramName hold contacts that belonged to
+-- another user when they were set, they replace PhoneNumber and TelegramName
+-- once verified. PendingPhoneNumber is encrypted like PhoneNumber, neither
+-- is unique.
+ALTER TABLE Users ADD COLUMN PendingPhoneNumber TEXT NOT NULL DEFAULT '';
+ALTER TABLE Users ADD COLUMN PendingTelegramName TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX users_pending_telegram_name ON Users (PendingTelegramName);
@@ -0,0 +1,14 @@
+DROP TABLE LoginApprovals;
+
+CREATE TABLE Sessions_old (
+    SessionID INTEGER PRIMARY KEY AUTOINCREMENT,
+    UserID INTEGER NOT NULL,
+    AccessToken TEXT NOT NULL,
+    FOREIGN KEY (UserID) REFERENCES Users (ID)
+);
+INSERT INTO Sessions_old (SessionID, UserID, AccessToken) SELECT SessionID, UserID, AccessToken FROM Sessions;
+DROP TABLE Sessions;
+ALTER TABLE Sessions_old RENAME TO Sessions;
+
+DROP INDEX users_telegram_chat_id;
+ALTER TABLE Users DROP COLUMN TelegramChatID;
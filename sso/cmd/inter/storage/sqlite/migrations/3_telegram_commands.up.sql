@@ -0,0 +1,25 @@
+ALTER TABLE Users ADD COLUMN TelegramChatID INTEGER;
+CREATE UNIQUE INDEX users_telegram_chat_id ON Users (TelegramChatID);
+
+CREATE TABLE Sessions_new (
+    SessionID INTEGER PRIMARY KEY AUTOINCREMENT,
+    UserID INTEGER NOT NULL,
+    AppID INTEGER NOT NULL DEFAULT 0,
+    AccessToken TEXT NOT NULL,
+    CreatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (UserID) REFERENCES Users (ID)
+);
+INSERT INTO Sessions_new (SessionID, UserID, AccessToken) SELECT SessionID, UserID, AccessToken FROM Sessions;
+DROP TABLE Sessions;
+ALTER TABLE Sessions_new RENAME TO Sessions;
+CREATE INDEX sessions_user_id ON Sessions (UserID);
+
+CREATE TABLE LoginApprovals (
+    ApprovalID TEXT PRIMARY KEY,
+    UserID INTEGER NOT NULL,
+    AppID INTEGER NOT NULL,
+    Status TEXT NOT NULL DEFAULT 'pending',
+    CreatedAt DATETIME NOT NULL,
+    ExpiresAt DATETIME NOT NULL,
+    FOREIGN KEY (UserID) REFERENCES Users (ID)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE OneTimeCodes (
+    CodeID INTEGER PRIMARY KEY AUTOINCREMENT,
+    UserID INTEGER NOT NULL,
+    Purpose TEXT NOT NULL,
+    CodeHash TEXT NOT NULL,
+    Payload TEXT NOT NULL DEFAULT '',
+    Attempts INTEGER NOT NULL DEFAULT 0,
+    CreatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ExpiresAt DATETIME NOT NULL,
+    UsedAt DATETIME,
+    FOREIGN KEY (UserID) REFERENCES Users (ID)
+);
+CREATE INDEX one_time_codes_user_purpose ON OneTimeCodes (UserID, Purpose);
@@ -0,0 +1,18 @@
+CREATE TABLE ContactVerifications (
+    UserID INTEGER NOT NULL,
+    Channel TEXT NOT NULL,
+    IsVerified BOOLEAN NOT NULL DEFAULT FALSE,
+    VerifiedAt DATETIME,
+    PRIMARY KEY (UserID, Channel),
+    FOREIGN KEY (UserID) REFERENCES Users (ID)
+);
+
+-- AccountConfirmations doesn't know which channel confirmed the account,
+-- treat it as the email and, if the bot knows the chat, telegram
+INSERT INTO ContactVerifications (UserID, Channel, IsVerified, VerifiedAt)
+SELECT DISTINCT UserID, 'email', TRUE, CURRENT_TIMESTAMP FROM AccountConfirmations WHERE IsConfirmed = TRUE;
+
+INSERT INTO ContactVerifications (UserID, Channel, IsVerified, VerifiedAt)
+SELECT DISTINCT ac.UserID, 'telegram', TRUE, CURRENT_TIMESTAMP FROM AccountConfirmations ac
+JOIN Users u ON u.ID = ac.UserID
+WHERE ac.IsConfirmed = TRUE AND u.TelegramChatID IS NOT NULL;
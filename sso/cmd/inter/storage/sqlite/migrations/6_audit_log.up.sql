@@ -0,0 +1,26 @@
+CREATE TABLE AuditLog (
+    EventID INTEGER PRIMARY KEY AUTOINCREMENT,
+    CreatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    Event TEXT NOT NULL,
+    ActorID INTEGER NOT NULL DEFAULT 0,
+    TargetID INTEGER NOT NULL DEFAULT 0,
+    Identifier TEXT NOT NULL DEFAULT '',
+    AppID INTEGER NOT NULL DEFAULT 0,
+    IP TEXT NOT NULL DEFAULT '',
+    UserAgent TEXT NOT NULL DEFAULT '',
+    Outcome TEXT NOT NULL,
+    Reason TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX audit_log_event ON AuditLog (Event, EventID);
+CREATE INDEX audit_log_actor ON AuditLog (ActorID, EventID);
+CREATE INDEX audit_log_target ON AuditLog (TargetID, EventID);
+
+-- the log is append only
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON AuditLog
+BEGIN
+    SELECT RAISE(ABORT, 'audit log is append only');
+END;
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON AuditLog
+BEGIN
+    SELECT RAISE(ABORT, 'audit log is append only');
+END;
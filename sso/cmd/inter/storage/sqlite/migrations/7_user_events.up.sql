@@ -0,0 +1,13 @@
+CREATE TABLE UserEvents (
+    EventID INTEGER PRIMARY KEY AUTOINCREMENT,
+    CreatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UserID INTEGER NOT NULL,
+    Type TEXT NOT NULL,
+    Data TEXT NOT NULL DEFAULT '{}'
+);
+
+-- how far each webhook consumer has got in UserEvents
+CREATE TABLE WebhookCursors (
+    Name TEXT PRIMARY KEY,
+    EventID INTEGER NOT NULL DEFAULT 0
+);
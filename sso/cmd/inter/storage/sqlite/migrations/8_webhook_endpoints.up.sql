@@ -0,0 +1,33 @@
+CREATE TABLE WebhookEndpoints (
+    EndpointID INTEGER PRIMARY KEY AUTOINCREMENT,
+    AppID INTEGER NOT NULL,
+    URL TEXT NOT NULL,
+    Secret TEXT NOT NULL,
+    -- comma separated user event types
+    EventTypes TEXT NOT NULL,
+    Disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    ConsecutiveFailures INTEGER NOT NULL DEFAULT 0,
+    CreatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (AppID) REFERENCES Apps (Id)
+);
+CREATE INDEX webhook_endpoints_app ON WebhookEndpoints (AppID);
+
+CREATE TABLE WebhookDeliveries (
+    DeliveryID INTEGER PRIMARY KEY AUTOINCREMENT,
+    EndpointID INTEGER NOT NULL,
+    EventID INTEGER NOT NULL,
+    Status TEXT NOT NULL,
+    Attempts INTEGER NOT NULL DEFAULT 0,
+    NextAttemptAt DATETIME NOT NULL,
+    LastError TEXT NOT NULL DEFAULT '',
+    CreatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UpdatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (EndpointID) REFERENCES WebhookEndpoints (EndpointID),
+    FOREIGN KEY (EventID) REFERENCES UserEvents (EventID),
+    -- every instance may fan out the same event, it is queued once
+    UNIQUE (EndpointID, EventID)
+);
+CREATE INDEX webhook_deliveries_due ON WebhookDeliveries (Status, NextAttemptAt);
+
+-- the single webhook url of the config is replaced by the endpoints
+DELETE FROM WebhookCursors WHERE Name = 'default';
@@ -0,0 +1,7 @@
+DROP TRIGGER audit_log_no_update;
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON AuditLog
+BEGIN
+    SELECT RAISE(ABORT, 'audit log is append only');
+END;
+
+DROP TABLE AccountDeletions;
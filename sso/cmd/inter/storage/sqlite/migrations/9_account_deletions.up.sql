@@ -0,0 +1,26 @@
+CREATE TABLE AccountDeletions (
+    UserID INTEGER PRIMARY KEY,
+    RequestedAt DATETIME NOT NULL,
+    PurgeAfter DATETIME NOT NULL,
+    FOREIGN KEY (UserID) REFERENCES Users (ID)
+);
+CREATE INDEX account_deletions_purge_after ON AccountDeletions (PurgeAfter);
+
+-- the personal data of purged users is erased from the audit log,
+-- any other change is still rejected
+DROP TRIGGER audit_log_no_update;
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON AuditLog
+WHEN NEW.EventID IS NOT OLD.EventID
+    OR NEW.CreatedAt IS NOT OLD.CreatedAt
+    OR NEW.Event IS NOT OLD.Event
+    OR NEW.ActorID IS NOT OLD.ActorID
+    OR NEW.TargetID IS NOT OLD.TargetID
+    OR NEW.AppID IS NOT OLD.AppID
+    OR NEW.Outcome IS NOT OLD.Outcome
+    OR NEW.Reason IS NOT OLD.Reason
+    OR (NEW.Identifier IS NOT OLD.Identifier AND NEW.Identifier <> '')
+    OR (NEW.IP IS NOT OLD.IP AND NEW.IP <> '')
+    OR (NEW.UserAgent IS NOT OLD.UserAgent AND NEW.UserAgent <> '')
+BEGIN
+    SELECT RAISE(ABORT, 'audit log is append only');
+END;
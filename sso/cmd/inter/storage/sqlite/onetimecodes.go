@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/storage"
+	"time"
+)
+
+// maxCodeAttempts is how many wrong guesses an unused code survives
+const maxCodeAttempts = 5
+
+// SaveOneTimeCode saves the code and invalidates unused codes of the user with the same purpose
+func (s *Storage) SaveOneTimeCode(ctx context.Context, code models.OneTimeCode) (err error) {
+	const op = "storage.sqlite.SaveOneTimeCode"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	_, err = tx.ExecContext(ctx, "UPDATE OneTimeCodes SET UsedAt = ? WHERE UserID = ? AND Purpose = ? AND UsedAt IS NULL",
+		now, code.UserID, code.Purpose)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO OneTimeCodes (UserID, Purpose, CodeHash, Payload, CreatedAt, ExpiresAt) VALUES (?, ?, ?, ?, ?, ?)",
+		code.UserID, code.Purpose, code.CodeHash, code.Payload, now, code.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeOneTimeCode marks the matching code as used and returns it. Expired, used
+// or too often guessed codes are reported as storage.ErrCodeNotFound.
+func (s *Storage) ConsumeOneTimeCode(ctx context.Context, userID int64, purpose string, codeHash string) (_ models.OneTimeCode, err error) {
+	const op = "storage.sqlite.ConsumeOneTimeCode"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	now := time.Now().UTC()
+
+	code := models.OneTimeCode{UserID: userID, Purpose: purpose, CodeHash: codeHash}
+	err = s.db.QueryRowContext(ctx, `UPDATE OneTimeCodes SET UsedAt = ?
+		WHERE UserID = ? AND Purpose = ? AND CodeHash = ? AND UsedAt IS NULL AND ExpiresAt > ? AND Attempts < ?
+		RETURNING CodeID, Payload`,
+		now, userID, purpose, codeHash, now, maxCodeAttempts).
+		Scan(&code.ID, &code.Payload)
+	if err == nil {
+		return code, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.OneTimeCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// count the wrong guess against the active code
+	_, err = s.db.ExecContext(ctx, "UPDATE OneTimeCodes SET Attempts = Attempts + 1 WHERE UserID = ? AND Purpose = ? AND UsedAt IS NULL",
+		userID, purpose)
+	if err != nil {
+		return models.OneTimeCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return models.OneTimeCode{}, fmt.Errorf("%s: %w", op, storage.ErrCodeNotFound)
+}
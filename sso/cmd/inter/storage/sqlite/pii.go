@@ -0,0 +1,320 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/fieldcrypt"
+	"sso/sso/cmd/inter/storage"
+	"strconv"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Field names bound to the ciphertexts and the blind indexes
+const (
+	fieldEmail              = "email"
+	fieldDateOfBirth        = "date_of_birth"
+	fieldFullName           = "full_name"
+	fieldPhoneNumber        = "phone_number"
+	fieldPendingPhoneNumber = "pending_phone_number"
+)
+
+// emailLookup matches the user by the blind index or, for rows that are not
+// encrypted yet, by the plaintext. It takes the emailLookupArgs.
+const emailLookup = "(EmailIndex = ? OR (EmailIndex IS NULL AND Email = ?))"
+
+// phoneLookup is emailLookup for the phone number, it takes the phoneLookupArgs
+const phoneLookup = "(PhoneIndex = ? OR (PhoneIndex IS NULL AND PhoneNumber = ?))"
+
+// piiFields are the encrypted columns of Users, the telegram name stays in
+// plaintext since it is a public handle the bot looks users up by
+type piiFields struct {
+	Email       string
+	DateOfBirth string
+	FullName    string
+	PhoneNumber string
+	// PendingPhoneNumber is not indexed, it is only looked up through its user
+	PendingPhoneNumber string
+}
+
+// sealedPII are the column values of piiFields, nil values are stored as NULL
+type sealedPII struct {
+	piiFields
+	EmailIndex any
+	PhoneIndex any
+	DataKey    any
+	KeyID      any
+}
+
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// userOwner binds the data key and the fields of the user to its row
+func userOwner(userID int64) string {
+	return "user:" + strconv.FormatInt(userID, 10)
+}
+
+// seal encrypts the fields of the user with a new data key, they are kept in
+// plaintext when there is no keyring
+func seal(keys *fieldcrypt.Keyring, userID int64, fields piiFields) (sealedPII, error) {
+	if keys == nil {
+		return sealedPII{piiFields: fields}, nil
+	}
+
+	owner := userOwner(userID)
+	dataKey, wrapped, keyID, err := keys.NewDataKey(owner)
+	if err != nil {
+		return sealedPII{}, err
+	}
+
+	sealed := sealedPII{
+		EmailIndex: keys.BlindIndex(fieldEmail, fields.Email),
+		PhoneIndex: keys.BlindIndex(fieldPhoneNumber, fields.PhoneNumber),
+		DataKey:    wrapped,
+		KeyID:      keyID,
+	}
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   *string
+	}{
+		{fieldEmail, fields.Email, &sealed.Email},
+		{fieldDateOfBirth, fields.DateOfBirth, &sealed.DateOfBirth},
+		{fieldFullName, fields.FullName, &sealed.FullName},
+		{fieldPhoneNumber, fields.PhoneNumber, &sealed.PhoneNumber},
+		{fieldPendingPhoneNumber, fields.PendingPhoneNumber, &sealed.PendingPhoneNumber},
+	} {
+		if *f.dst, err = fieldcrypt.Encrypt(dataKey, owner, f.name, f.value); err != nil {
+			return sealedPII{}, err
+		}
+	}
+
+	return sealed, nil
+}
+
+// open decrypts the fields of the user in place, plaintext values are left as they are
+func (s *Storage) open(user *models.User, wrapped []byte, keyID string) error {
+	if keyID == "" {
+		return nil
+	}
+	if s.keys == nil {
+		return errors.New("user data is encrypted but no keys are configured")
+	}
+
+	owner := userOwner(user.ID)
+	dataKey, err := s.keys.UnwrapDataKey(keyID, owner, wrapped)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range []struct {
+		name  string
+		value *string
+	}{
+		{fieldEmail, &user.Email},
+		{fieldDateOfBirth, &user.DateOfBirth},
+		{fieldFullName, &user.FullName},
+		{fieldPhoneNumber, &user.PhoneNumber},
+		{fieldPendingPhoneNumber, &user.PendingPhoneNumber},
+	} {
+		if *f.value, err = fieldcrypt.Decrypt(dataKey, owner, f.name, *f.value); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) emailLookupArgs(email string) []any {
+	var index any
+	if s.keys != nil {
+		index = s.keys.BlindIndex(fieldEmail, email)
+	}
+
+	return []any{index, email}
+}
+
+func (s *Storage) phoneLookupArgs(phoneNumber string) []any {
+	var index any
+	if s.keys != nil {
+		index = s.keys.BlindIndex(fieldPhoneNumber, phoneNumber)
+	}
+
+	return []any{index, phoneNumber}
+}
+
+// plaintextConflict reports whether a row that is not encrypted yet has the
+// email or the phone number, the blind indexes can't catch those duplicates
+func (s *Storage) plaintextConflict(ctx context.Context, q querier, userID int64, email string, phoneNumber string) (bool, error) {
+	if s.keys == nil {
+		// the unique constraints of the plaintext columns apply
+		return false, nil
+	}
+
+	var found bool
+	err := q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM Users
+		WHERE ID <> ? AND KeyID IS NULL AND (Email = ? OR PhoneNumber = ?))`,
+		userID, email, phoneNumber).Scan(&found)
+
+	return found, err
+}
+
+// loadPII returns the decrypted fields of the user
+func (s *Storage) loadPII(ctx context.Context, q querier, userID int64) (piiFields, error) {
+	var (
+		user    = models.User{ID: userID}
+		dataKey []byte
+		keyID   string
+	)
+	err := q.QueryRowContext(ctx, `SELECT Email, COALESCE(DateOfBirth, ''), COALESCE(Fullname, ''), PhoneNumber,
+		PendingPhoneNumber, DataKey, COALESCE(KeyID, '') FROM Users WHERE ID = ?`, userID).
+		Scan(&user.Email, &user.DateOfBirth, &user.FullName, &user.PhoneNumber, &user.PendingPhoneNumber, &dataKey, &keyID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return piiFields{}, storage.ErrUserNotFound
+		}
+		return piiFields{}, err
+	}
+
+	if err := s.open(&user, dataKey, keyID); err != nil {
+		return piiFields{}, err
+	}
+
+	return piiFields{
+		Email:              user.Email,
+		DateOfBirth:        user.DateOfBirth,
+		FullName:           user.FullName,
+		PhoneNumber:        user.PhoneNumber,
+		PendingPhoneNumber: user.PendingPhoneNumber,
+	}, nil
+}
+
+// updatePII applies update to the fields of the user and stores them under a new data key
+func (s *Storage) updatePII(ctx context.Context, q querier, userID int64, update func(*piiFields)) error {
+	fields, err := s.loadPII(ctx, q, userID)
+	if err != nil {
+		return err
+	}
+	update(&fields)
+
+	conflict, err := s.plaintextConflict(ctx, q, userID, fields.Email, fields.PhoneNumber)
+	if err != nil {
+		return err
+	}
+	if conflict {
+		return storage.ErrUserExists
+	}
+
+	sealed, err := seal(s.keys, userID, fields)
+	if err != nil {
+		return err
+	}
+
+	if err := writePII(ctx, q, userID, sealed); err != nil {
+		var sqliteErr sqlite3.Error
+
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return storage.ErrUserExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+func writePII(ctx context.Context, q querier, userID int64, sealed sealedPII) error {
+	_, err := q.ExecContext(ctx, `UPDATE Users SET Email = ?, DateOfBirth = ?, Fullname = ?, PhoneNumber = ?,
+		PendingPhoneNumber = ?, EmailIndex = ?, PhoneIndex = ?, DataKey = ?, KeyID = ? WHERE ID = ?`,
+		sealed.Email, sealed.DateOfBirth, sealed.FullName, sealed.PhoneNumber, sealed.PendingPhoneNumber,
+		sealed.EmailIndex, sealed.PhoneIndex, sealed.DataKey, sealed.KeyID, userID)
+
+	return err
+}
+
+// RotateUsers stores the users after afterID under new data keys wrapped by
+// the primary master key, up to limit rows in one transaction. Only rows of
+// other master keys and plaintext rows are rotated unless all is set, which
+// also rebuilds the blind indexes after the index key changed. With decrypt
+// the rows are written back in plaintext instead. It returns the last
+// visited id, 0 when there are no more rows, and the number of rotated rows.
+func (s *Storage) RotateUsers(ctx context.Context, afterID int64, limit int, all bool, decrypt bool) (_ int64, _ int, err error) {
+	const op = "storage.sqlite.RotateUsers"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	if s.keys == nil {
+		return 0, 0, fmt.Errorf("%s: no keys are configured", op)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query := "SELECT ID FROM Users WHERE ID > ?"
+	args := []any{afterID}
+	switch {
+	case decrypt:
+		query += " AND KeyID IS NOT NULL"
+	case !all:
+		query += " AND (KeyID IS NULL OR KeyID <> ?)"
+		args = append(args, s.keys.PrimaryKeyID())
+	}
+	query += " ORDER BY ID LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("%s: %w", op, err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(ids) == 0 {
+		return 0, 0, nil
+	}
+
+	keys := s.keys
+	if decrypt {
+		// seal keeps the fields in plaintext without a keyring
+		keys = nil
+	}
+
+	for _, id := range ids {
+		fields, err := s.loadPII(ctx, tx, id)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s: user %d: %w", op, id, err)
+		}
+
+		sealed, err := seal(keys, id, fields)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s: user %d: %w", op, id, err)
+		}
+
+		if err := writePII(ctx, tx, id, sealed); err != nil {
+			return 0, 0, fmt.Errorf("%s: user %d: %w", op, id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ids[len(ids)-1], len(ids), nil
+}
@@ -0,0 +1,226 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sso/sso/cmd/inter/lib/fieldcrypt"
+	"sso/sso/cmd/inter/storage"
+	"strings"
+	"testing"
+)
+
+func testKeyring(t *testing.T, ids ...string) *fieldcrypt.Keyring {
+	t.Helper()
+
+	keys := make([]fieldcrypt.MasterKey, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, fieldcrypt.MasterKey{ID: id, Key: bytes.Repeat([]byte(id[len(id)-1:]), 32)})
+	}
+
+	k, err := fieldcrypt.NewKeyring(keys, bytes.Repeat([]byte{0xee}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return k
+}
+
+type testUser struct {
+	email, dateOfBirth, fullName, phone, telegram string
+}
+
+var (
+	alice = testUser{"alice@example.com", "1990-01-31", "Alice Smith", "+14155550001", "alice_tg"}
+	bob   = testUser{"bob@example.com", "1985-05-05", "Bob Jones", "+14155550002", "bob_tg"}
+)
+
+func saveUser(t *testing.T, s *Storage, u testUser) int64 {
+	t.Helper()
+
+	id, err := s.SaveUser(context.Background(), []byte("hash"), u.email, u.dateOfBirth, u.fullName, u.phone, u.telegram)
+	if err != nil {
+		t.Fatalf("SaveUser(%s) error = %v", u.email, err)
+	}
+
+	return id
+}
+
+// assertUser looks the user up by email and by id and compares the decrypted fields
+func assertUser(t *testing.T, s *Storage, id int64, u testUser) {
+	t.Helper()
+
+	byEmail, err := s.User(context.Background(), u.email)
+	if err != nil {
+		t.Fatalf("User(%s) error = %v", u.email, err)
+	}
+	byID, err := s.UserByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("UserByID(%d) error = %v", id, err)
+	}
+
+	for _, got := range []struct {
+		id                                  int64
+		email, dateOfBirth, fullName, phone string
+	}{
+		{byEmail.ID, byEmail.Email, byEmail.DateOfBirth, byEmail.FullName, byEmail.PhoneNumber},
+		{byID.ID, byID.Email, byID.DateOfBirth, byID.FullName, byID.PhoneNumber},
+	} {
+		if got.id != id || got.email != u.email || got.dateOfBirth != u.dateOfBirth || got.fullName != u.fullName || got.phone != u.phone {
+			t.Errorf("user %d = %+v, want %+v", id, got, u)
+		}
+	}
+}
+
+type rawUser struct {
+	email, phone, fullName string
+	keyID                  string
+}
+
+func readRaw(t *testing.T, s *Storage, id int64) rawUser {
+	t.Helper()
+
+	var r rawUser
+	err := s.db.QueryRow("SELECT Email, PhoneNumber, COALESCE(Fullname, ''), COALESCE(KeyID, '') FROM Users WHERE ID = ?", id).
+		Scan(&r.email, &r.phone, &r.fullName, &r.keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestEncryptedUser(t *testing.T) {
+	s := newTestStorage(t, testKeyring(t, "k1"), true)
+
+	id := saveUser(t, s, alice)
+	assertUser(t, s, id, alice)
+
+	raw := readRaw(t, s, id)
+	if raw.keyID != "k1" {
+		t.Errorf("KeyID = %q, want k1", raw.keyID)
+	}
+	for _, value := range []string{raw.email, raw.phone, raw.fullName} {
+		if !fieldcrypt.IsEncrypted(value) {
+			t.Errorf("column value %q is not encrypted", value)
+		}
+	}
+
+	// uniqueness holds through the blind indexes
+	dup := bob
+	dup.email = alice.email
+	if _, err := s.SaveUser(context.Background(), []byte("hash"), dup.email, dup.dateOfBirth, dup.fullName, dup.phone, dup.telegram); !errors.Is(err, storage.ErrUserExists) {
+		t.Errorf("SaveUser(duplicate email) error = %v, want ErrUserExists", err)
+	}
+}
+
+func TestMixedPlaintextAndEncryptedUsers(t *testing.T) {
+	plain := newTestStorage(t, nil, true)
+	aliceID := saveUser(t, plain, alice)
+
+	// the same database once encryption is turned on
+	encrypted := &Storage{db: plain.db, keys: testKeyring(t, "k1")}
+	bobID := saveUser(t, encrypted, bob)
+
+	if raw := readRaw(t, encrypted, aliceID); raw.email != alice.email || raw.keyID != "" {
+		t.Fatalf("plaintext row changed: %+v", raw)
+	}
+
+	assertUser(t, encrypted, aliceID, alice)
+	assertUser(t, encrypted, bobID, bob)
+
+	// a plaintext row still blocks its email and phone for encrypted rows
+	dup := testUser{alice.email, "2000-01-01", "Mallory", "+14155550003", "mallory_tg"}
+	if _, err := encrypted.SaveUser(context.Background(), []byte("hash"), dup.email, dup.dateOfBirth, dup.fullName, dup.phone, dup.telegram); !errors.Is(err, storage.ErrUserExists) {
+		t.Errorf("SaveUser(plaintext duplicate) error = %v, want ErrUserExists", err)
+	}
+
+	// without the keys the encrypted rows can't be read
+	if _, err := plain.UserByID(context.Background(), bobID); err == nil {
+		t.Error("UserByID(encrypted) without keys error = nil")
+	}
+}
+
+func TestRotateUsers(t *testing.T) {
+	ctx := context.Background()
+
+	plain := newTestStorage(t, nil, true)
+	aliceID := saveUser(t, plain, alice)
+
+	old := &Storage{db: plain.db, keys: testKeyring(t, "k1")}
+	bobID := saveUser(t, old, bob)
+
+	// k2 becomes the primary key, k1 is kept until the rows are rotated
+	rotated := &Storage{db: plain.db, keys: testKeyring(t, "k2", "k1")}
+
+	total := 0
+	var lastID int64
+	for {
+		next, n, err := rotated.RotateUsers(ctx, lastID, 1, false, false)
+		if err != nil {
+			t.Fatalf("RotateUsers() error = %v", err)
+		}
+		if n == 0 {
+			break
+		}
+		lastID, total = next, total+n
+	}
+	if total != 2 {
+		t.Errorf("rotated %d users, want 2", total)
+	}
+
+	for _, id := range []int64{aliceID, bobID} {
+		if raw := readRaw(t, rotated, id); raw.keyID != "k2" || !fieldcrypt.IsEncrypted(raw.email) {
+			t.Errorf("user %d after rotation: %+v, want encrypted under k2", id, raw)
+		}
+	}
+
+	// k1 can be dropped now
+	current := &Storage{db: plain.db, keys: testKeyring(t, "k2")}
+	assertUser(t, current, aliceID, alice)
+	assertUser(t, current, bobID, bob)
+
+	// rows of the primary key are skipped unless all is set
+	if _, n, err := current.RotateUsers(ctx, 0, 10, false, false); err != nil || n != 0 {
+		t.Errorf("RotateUsers() again = %d, %v, want nothing to rotate", n, err)
+	}
+	if _, n, err := current.RotateUsers(ctx, 0, 10, true, false); err != nil || n != 2 {
+		t.Errorf("RotateUsers(all) = %d, %v, want 2", n, err)
+	}
+
+	// decrypt writes the rows back in plaintext
+	if _, n, err := current.RotateUsers(ctx, 0, 10, false, true); err != nil || n != 2 {
+		t.Fatalf("RotateUsers(decrypt) = %d, %v, want 2", n, err)
+	}
+	if raw := readRaw(t, current, bobID); raw.email != bob.email || raw.keyID != "" {
+		t.Errorf("user after decrypt: %+v, want plaintext", raw)
+	}
+	assertUser(t, plain, bobID, bob)
+}
+
+func TestMovedCiphertextsAreRejected(t *testing.T) {
+	s := newTestStorage(t, testKeyring(t, "k1"), true)
+	aliceID := saveUser(t, s, alice)
+	bobID := saveUser(t, s, bob)
+
+	// copy the data key and the fields of alice over bob, like someone with
+	// write access to the database could, the unique columns stay
+	_, err := s.db.Exec(`UPDATE Users SET (DateOfBirth, Fullname, DataKey, KeyID) =
+		(SELECT DateOfBirth, Fullname, DataKey, KeyID FROM Users WHERE ID = ?) WHERE ID = ?`, aliceID, bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.UserByID(context.Background(), bobID); err == nil || !strings.Contains(err.Error(), "decrypt") {
+		t.Errorf("UserByID(moved row) error = %v, want a decryption failure", err)
+	}
+
+	// swapping the fields within a row is caught as well
+	_, err = s.db.Exec("UPDATE Users SET Fullname = Email WHERE ID = ?", aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UserByID(context.Background(), aliceID); err == nil {
+		t.Error("UserByID(swapped fields) error = nil")
+	}
+}
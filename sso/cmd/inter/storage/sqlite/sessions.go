@@ -0,0 +1,125 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/storage"
+	"time"
+)
+
+func (s *Storage) SaveSession(ctx context.Context, userID int64, appID int, accessToken string) (_ int64, err error) {
+	const op = "storage.sqlite.SaveSession"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	stmt, err := s.db.PrepareContext(ctx, "INSERT INTO Sessions (UserID, AppID, AccessToken, CreatedAt) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, userID, appID, accessToken, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// Sessions returns active sessions of the user, newest first
+func (s *Storage) Sessions(ctx context.Context, userID int64) (_ []models.Session, err error) {
+	const op = "storage.sqlite.Sessions"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	stmt, err := s.db.PrepareContext(ctx, "SELECT SessionID, UserID, AppID, AccessToken, CreatedAt FROM Sessions WHERE UserID = ? ORDER BY SessionID DESC")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.AppID, &session.AccessToken, &session.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// DeleteSessions removes all sessions of the user and returns how many were removed
+func (s *Storage) DeleteSessions(ctx context.Context, userID int64) (_ int64, err error) {
+	const op = "storage.sqlite.DeleteSessions"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM Sessions WHERE UserID = ?", userID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
+
+func (s *Storage) SessionByToken(ctx context.Context, accessToken string) (_ models.Session, err error) {
+	const op = "storage.sqlite.SessionByToken"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	var session models.Session
+	err = s.db.QueryRowContext(ctx, "SELECT SessionID, UserID, AppID, AccessToken, CreatedAt FROM Sessions WHERE AccessToken = ?", accessToken).
+		Scan(&session.ID, &session.UserID, &session.AppID, &session.AccessToken, &session.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Session{}, fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+		}
+
+		return models.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+// DeleteOtherSessions removes all sessions of the user except the one with keepToken
+func (s *Storage) DeleteOtherSessions(ctx context.Context, userID int64, keepToken string) (_ int64, err error) {
+	const op = "storage.sqlite.DeleteOtherSessions"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM Sessions WHERE UserID = ? AND AccessToken != ?", userID, keepToken)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
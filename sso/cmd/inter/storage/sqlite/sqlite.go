@@ -6,36 +6,69 @@ import (
 	"errors"
 	"fmt"
 	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/fieldcrypt"
+	"sso/sso/cmd/inter/lib/metrics"
+	"sso/sso/cmd/inter/lib/tracing"
 	"sso/sso/cmd/inter/storage"
+	"time"
 
 	"github.com/mattn/go-sqlite3"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type Storage struct {
-	db *sql.DB
+	db   *sql.DB
+	keys *fieldcrypt.Keyring
 }
 
-// New creates a new instance of sqlite storage
-func New(storagePath string) (*Storage, error) {
+// New creates a new instance of sqlite storage, the personal data of users is
+// encrypted with keys and kept in plaintext when keys is nil
+func New(storagePath string, keys *fieldcrypt.Keyring) (*Storage, error) {
 	const op = "storage.sqlite.New"
 
 	db, err := sql.Open("sqlite3", storagePath)
 	if err != nil {
 		return nil, fmt.Errorf("%s : %w", op, err)
 	}
-	return &Storage{db: db}, nil
+	return &Storage{db: db, keys: keys}, nil
 }
 
-func (s *Storage) SaveUser(ctx context.Context, passHash []byte, email string, dateOfBirth string, fullName string, phoneNumber string, telegramName string) (int64, error) {
+func (s *Storage) SaveUser(ctx context.Context, passHash []byte, email string, dateOfBirth string, fullName string, phoneNumber string, telegramName string) (_ int64, err error) {
 	const op = "storage.sqlite.SaveUser"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
 
-	stmt, err := s.db.Prepare("INSERT INTO Users (passwordHash, email, dateofbirth, fullName, phoneNumber, telegramname)  VALUES (?, ?, ?, ?, ?, ?)")
+	conflict, err := s.plaintextConflict(ctx, s.db, 0, email, phoneNumber)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
+	if conflict {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// the ciphertexts are bound to the user id, so an encrypted user is
+	// inserted with the blind indexes in place of the fields and sealed after
+	fields := piiFields{Email: email, DateOfBirth: dateOfBirth, FullName: fullName, PhoneNumber: phoneNumber}
+	row := sealedPII{piiFields: fields}
+	if s.keys != nil {
+		emailIndex := s.keys.BlindIndex(fieldEmail, email)
+		phoneIndex := s.keys.BlindIndex(fieldPhoneNumber, phoneNumber)
+		row = sealedPII{
+			piiFields:  piiFields{Email: emailIndex, PhoneNumber: phoneIndex},
+			EmailIndex: emailIndex,
+			PhoneIndex: phoneIndex,
+		}
+	}
 
-	res, err := stmt.ExecContext(ctx, passHash, email, dateOfBirth, fullName, phoneNumber, telegramName)
+	res, err := tx.ExecContext(ctx, `INSERT INTO Users (passwordHash, email, dateofbirth, fullName, phoneNumber, telegramname,
+		EmailIndex, PhoneIndex)  VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		passHash, row.Email, row.DateOfBirth, row.FullName, row.PhoneNumber, telegramName, row.EmailIndex, row.PhoneIndex)
 	if err != nil {
 		var sqliteErr sqlite3.Error
 
@@ -51,39 +84,70 @@ func (s *Storage) SaveUser(ctx context.Context, passHash []byte, email string, d
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
+	if s.keys != nil {
+		sealed, err := seal(s.keys, id, fields)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if err := writePII(ctx, tx, id, sealed); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
 	return id, nil
 }
 
 // User returns user by email
 
-func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
+func (s *Storage) User(ctx context.Context, email string) (_ models.User, err error) {
 	const op = "storage.sqlite.User"
-	stmt, err := s.db.Prepare("SELECT id, passwordHash, email, dateofbirth, fullname, phonenumber, telegramname from users where email = ?")
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+	stmt, err := s.db.PrepareContext(ctx, "SELECT "+userColumns+" from users where "+emailLookup)
 	if err != nil {
 		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
+	defer stmt.Close()
 
-	row := stmt.QueryRowContext(ctx, email)
+	user, err := s.scanUser(stmt.QueryRowContext(ctx, s.emailLookupArgs(email)...))
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return user, nil
+}
 
-	var user models.User
-	err = row.Scan(&user.ID, &user.PassHash, &user.Email, &user.DateOfBirth, &user.FullName, &user.PhoneNumber, &user.TelegramName)
+// UserByID returns user by id
+func (s *Storage) UserByID(ctx context.Context, userID int64) (_ models.User, err error) {
+	const op = "storage.sqlite.UserByID"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+	stmt, err := s.db.PrepareContext(ctx, "SELECT "+userColumns+" from users where id = ?")
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
-		}
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
 
+	user, err := s.scanUser(stmt.QueryRowContext(ctx, userID))
+	if err != nil {
 		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 	return user, nil
 }
 
-func (s *Storage) App(ctx context.Context, id int) (models.App, error) {
+func (s *Storage) App(ctx context.Context, id int) (_ models.App, err error) {
 	const op = "storage.sqlite.App"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
 
-	stmt, err := s.db.Prepare("SELECT id, name, secret FROM apps WHERE id = ?")
+	stmt, err := s.db.PrepareContext(ctx, "SELECT id, name, secret FROM apps WHERE id = ?")
 	if err != nil {
 		return models.App{}, fmt.Errorf("%s: %w", op, err)
 	}
+	defer stmt.Close()
 
 	row := stmt.QueryRowContext(ctx, id)
 
@@ -100,13 +164,16 @@ func (s *Storage) App(ctx context.Context, id int) (models.App, error) {
 	return app, nil
 }
 
-func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+func (s *Storage) IsAdmin(ctx context.Context, userID int64) (_ bool, err error) {
 	const op = "storage.sqlite.IsAdmin"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
 
-	stmt, err := s.db.Prepare("SELECT is_admin FROM users WHERE id = ?")
+	stmt, err := s.db.PrepareContext(ctx, "SELECT is_admin FROM users WHERE id = ?")
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
 	}
+	defer stmt.Close()
 
 	row := stmt.QueryRowContext(ctx, userID)
 
@@ -125,10 +192,11 @@ func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 }
 
 func (s *Storage) IsCodeSent(ctx context.Context, userid int) (bool, error) {
-	stmt, err := s.db.Prepare("SELECT ConfirmationToken from AccountConfirmations where userid = ?")
+	stmt, err := s.db.PrepareContext(ctx, "SELECT ConfirmationToken from AccountConfirmations where userid = ?")
 	if err != nil {
 		return false, nil
 	}
+	defer stmt.Close()
 
 	var confirmationToken string
 	err = stmt.QueryRowContext(ctx, userid).Scan(&confirmationToken)
@@ -140,9 +208,11 @@ func (s *Storage) IsCodeSent(ctx context.Context, userid int) (bool, error) {
 	return true, nil
 }
 
-func (s *Storage) VerifyConfirmationCode(ctx context.Context, userid int, code string) (bool, error) {
+func (s *Storage) VerifyConfirmationCode(ctx context.Context, userid int, code string) (_ bool, err error) {
 	const op = "storage.VerifyConfirmationCode"
-	stmt, err := s.db.Prepare("SELECT ConfirmationToken FROM AccountConfirmations WHERE userid = ?")
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+	stmt, err := s.db.PrepareContext(ctx, "SELECT ConfirmationToken FROM AccountConfirmations WHERE userid = ?")
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
 	}
@@ -164,13 +234,16 @@ func (s *Storage) VerifyConfirmationCode(ctx context.Context, userid int, code s
 	}
 }
 
-func (s *Storage) SaveEmailCode(ctx context.Context, userid int64, confirmationToken string) (int64, error) {
+func (s *Storage) SaveEmailCode(ctx context.Context, userid int64, confirmationToken string) (_ int64, err error) {
 	const op = "storage.sqlite.SaveUser"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
 
-	stmt, err := s.db.Prepare("INSERT INTO AccountConfirmations(userid, confirmationToken, isconfirmed)  VALUES (?, ?, FALSE)")
+	stmt, err := s.db.PrepareContext(ctx, "INSERT INTO AccountConfirmations(userid, confirmationToken, isconfirmed)  VALUES (?, ?, FALSE)")
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
+	defer stmt.Close()
 
 	res, err := stmt.ExecContext(ctx, userid, confirmationToken)
 	if err != nil {
@@ -191,14 +264,17 @@ func (s *Storage) SaveEmailCode(ctx context.Context, userid int64, confirmationT
 	return id, nil
 }
 
-func (s *Storage) SaveEmailConfirmation(ctx context.Context, userID int, confirmationToken string) error {
+func (s *Storage) SaveEmailConfirmation(ctx context.Context, userID int, confirmationToken string) (err error) {
 	const op = "storage.SaveEmailConfirmation"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
 
 	// First, retrieve the existing token from the database
-	stmt, err := s.db.Prepare("SELECT ConfirmationToken FROM AccountConfirmation WHERE userid = ?")
+	stmt, err := s.db.PrepareContext(ctx, "SELECT ConfirmationToken FROM AccountConfirmation WHERE userid = ?")
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
+	defer stmt.Close()
 
 	var existingToken string
 	err = stmt.QueryRowContext(ctx, userID).Scan(&existingToken)
@@ -217,11 +293,13 @@ func (s *Storage) SaveEmailConfirmation(ctx context.Context, userID int, confirm
 	}
 }
 
-func (s *Storage) UpdateAccountStatus(ctx context.Context, userid int64, token string) error {
+func (s *Storage) UpdateAccountStatus(ctx context.Context, userid int64, token string) (err error) {
 	const op = "storage.sqlite.UpdateAccountStatus"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
 
 	// Update the account confirmation status to true
-	stmt, err := s.db.Prepare("UPDATE AccountConfirmation SET isconfirmed = True WHERE userid = ? AND ConfirmationToken = ?")
+	stmt, err := s.db.PrepareContext(ctx, "UPDATE AccountConfirmation SET isconfirmed = True WHERE userid = ? AND ConfirmationToken = ?")
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -245,8 +323,10 @@ func (s *Storage) UpdateAccountStatus(ctx context.Context, userid int64, token s
 	return nil
 }
 
-func (s *Storage) ConfirmAccount(ctx context.Context, email, token string) error {
+func (s *Storage) ConfirmAccount(ctx context.Context, email, token string) (err error) {
 	const op = "storage.sqlite.ConfirmAccount"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
 
 	// Begin a transaction
 	tx, err := s.db.BeginTx(ctx, nil)
@@ -259,7 +339,7 @@ func (s *Storage) ConfirmAccount(ctx context.Context, email, token string) error
 
 	// Get the userID from the Users table
 	var userID int64
-	err = tx.QueryRowContext(ctx, "SELECT id FROM Users WHERE email = ?", email).Scan(&userID)
+	err = tx.QueryRowContext(ctx, "SELECT id FROM Users WHERE "+emailLookup, s.emailLookupArgs(email)...).Scan(&userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return fmt.Errorf("%s: no user found with the provided email", op)
@@ -268,7 +348,7 @@ func (s *Storage) ConfirmAccount(ctx context.Context, email, token string) error
 	}
 
 	// Update the AccountConfirmations table
-	stmt, err := tx.Prepare("UPDATE AccountConfirmations SET isConfirmed = 1 WHERE userID = ? AND ConfirmationToken = ?")
+	stmt, err := tx.PrepareContext(ctx, "UPDATE AccountConfirmations SET isConfirmed = 1 WHERE userID = ? AND ConfirmationToken = ?")
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -289,6 +369,10 @@ func (s *Storage) ConfirmAccount(ctx context.Context, email, token string) error
 		return fmt.Errorf("%s: no rows updated, token may not match", op)
 	}
 
+	if err := setContactVerified(ctx, tx, userID, models.ChannelEmail, true); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
@@ -297,65 +381,230 @@ func (s *Storage) ConfirmAccount(ctx context.Context, email, token string) error
 	return nil
 }
 
-func (s *Storage) ConfirmAccountTG(ctx context.Context, telegramName string) int {
-	const op = "storage.sqlite.ConfirmAccount"
+// ConfirmAccountTG binds chatID to the user with the telegram name and confirms
+// the account, it returns false if the account already was confirmed. A name
+// nobody has is given to the single user holding it as pending.
+func (s *Storage) ConfirmAccountTG(ctx context.Context, telegramName string, chatID int64) (_ bool, err error) {
+	const op = "storage.sqlite.ConfirmAccountTG"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
 
 	// Begin a transaction
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		fmt.Printf("%s: %v\n", op, err)
-		return 0
+		return false, fmt.Errorf("%s: %w", op, err)
 	}
 
 	// Rollback the transaction in case of any error
 	defer tx.Rollback()
 
 	// Get the userID from the Users table
-	var userID int64
-	err = tx.QueryRowContext(ctx, "SELECT id FROM Users WHERE telegramName = ?", telegramName).Scan(&userID)
+	var userID, boundChatID int64
+	err = tx.QueryRowContext(ctx, "SELECT id, COALESCE(TelegramChatID, 0) FROM Users WHERE telegramName = ?", telegramName).
+		Scan(&userID, &boundChatID)
+	if errors.Is(err, sql.ErrNoRows) {
+		userID, err = claimPendingTelegramName(ctx, tx, telegramName)
+	}
 	if err != nil {
-		if err == sql.ErrNoRows {
-			fmt.Printf("%s: no user found with the provided telegram name\n", op)
-			return 0
-		}
-		fmt.Printf("%s: %v\n", op, err)
-		return 0
+		return false, fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Check if the account is already confirmed
-	var isConfirmed bool
-	err = tx.QueryRowContext(ctx, "SELECT isConfirmed FROM AccountConfirmations WHERE userID = ?", userID).Scan(&isConfirmed)
-	if err != nil {
-		fmt.Printf("%s: %v\n", op, err)
-		return 0
+	// The telegram name alone doesn't prove the account is yours, moving it
+	// to another chat goes through BindTelegramChat
+	if boundChatID != 0 && boundChatID != chatID {
+		return false, fmt.Errorf("%s: %w", op, storage.ErrTelegramChatBound)
 	}
-	if isConfirmed {
-		return -1
+
+	// Bind the chat so the bot can recognize the user by it
+	if err := bindTelegramChat(ctx, tx, userID, chatID); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Update the isConfirmed status to true
-	result, err := tx.ExecContext(ctx, "UPDATE AccountConfirmations SET isConfirmed = 1 WHERE userID = ?", userID)
+	// Confirm the account unless it already is
+	result, err := tx.ExecContext(ctx, "UPDATE AccountConfirmations SET isConfirmed = 1 WHERE userID = ? AND isConfirmed = 0", userID)
 	if err != nil {
-		fmt.Printf("%s: %v\n", op, err)
-		return 0
+		return false, fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Check if the update was successful
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		fmt.Printf("%s: %v\n", op, err)
-		return 0
-	}
-	if rowsAffected == 0 {
-		fmt.Printf("%s: no rows updated, user may not exist\n", op)
-		return 0
+		return false, fmt.Errorf("%s: %w", op, err)
 	}
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		fmt.Printf("%s: %v\n", op, err)
-		return 0
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// claimPendingTelegramName makes the pending telegram name the name of its
+// user, the chat of the previous name is unbound. The name is not claimed
+// when several users hold it.
+func claimPendingTelegramName(ctx context.Context, tx *sql.Tx, telegramName string) (int64, error) {
+	if telegramName == "" {
+		// users without a pending name hold the empty one
+		return 0, storage.ErrUserNotFound
+	}
+
+	var (
+		userID  int64
+		holders int
+	)
+	err := tx.QueryRowContext(ctx, "SELECT COALESCE(MIN(ID), 0), COUNT(*) FROM Users WHERE PendingTelegramName = ?", telegramName).
+		Scan(&userID, &holders)
+	if err != nil {
+		return 0, err
+	}
+	if holders != 1 {
+		return 0, storage.ErrUserNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE Users SET TelegramName = ?, PendingTelegramName = '', TelegramChatID = NULL WHERE ID = ?",
+		telegramName, userID)
+	if err != nil {
+		return 0, err
 	}
 
-	return 1
+	return userID, nil
+}
+
+// BindTelegramChat moves the user to the chat and verifies the telegram channel
+func (s *Storage) BindTelegramChat(ctx context.Context, userID int64, chatID int64) (err error) {
+	const op = "storage.sqlite.BindTelegramChat"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := bindTelegramChat(ctx, tx, userID, chatID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func bindTelegramChat(ctx context.Context, tx *sql.Tx, userID int64, chatID int64) error {
+	res, err := tx.ExecContext(ctx, "UPDATE Users SET TelegramChatID = ? WHERE id = ?", chatID, userID)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return storage.ErrTelegramChatTaken
+		}
+
+		return err
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return storage.ErrUserNotFound
+	}
+
+	return setContactVerified(ctx, tx, userID, models.ChannelTelegram, true)
+}
+
+// UserByTelegramName returns user with the telegram name
+func (s *Storage) UserByTelegramName(ctx context.Context, telegramName string) (_ models.User, err error) {
+	const op = "storage.sqlite.UserByTelegramName"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+	stmt, err := s.db.PrepareContext(ctx, "SELECT "+userColumns+" from users where telegramname = ?")
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	user, err := s.scanUser(stmt.QueryRowContext(ctx, telegramName))
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return user, nil
+}
+
+// UserByPhone returns user with the phone number
+func (s *Storage) UserByPhone(ctx context.Context, phoneNumber string) (_ models.User, err error) {
+	const op = "storage.sqlite.UserByPhone"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+	stmt, err := s.db.PrepareContext(ctx, "SELECT "+userColumns+" from users where "+phoneLookup)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	user, err := s.scanUser(stmt.QueryRowContext(ctx, s.phoneLookupArgs(phoneNumber)...))
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return user, nil
+}
+
+// UserByTelegramChat returns user bound to the telegram chat
+func (s *Storage) UserByTelegramChat(ctx context.Context, chatID int64) (_ models.User, err error) {
+	const op = "storage.sqlite.UserByTelegramChat"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+	stmt, err := s.db.PrepareContext(ctx, "SELECT "+userColumns+" from users where telegramchatid = ?")
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	user, err := s.scanUser(stmt.QueryRowContext(ctx, chatID))
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return user, nil
+}
+
+const userColumns = "id, passwordHash, email, dateofbirth, fullname, phonenumber, telegramname, COALESCE(telegramchatid, 0), " +
+	"PendingPhoneNumber, PendingTelegramName, DataKey, COALESCE(KeyID, '')"
+
+// scanUser scans a row of userColumns and decrypts the personal data
+func (s *Storage) scanUser(row *sql.Row) (models.User, error) {
+	var (
+		user    models.User
+		dataKey []byte
+		keyID   string
+	)
+	err := row.Scan(&user.ID, &user.PassHash, &user.Email, &user.DateOfBirth, &user.FullName, &user.PhoneNumber, &user.TelegramName, &user.TelegramChatID,
+		&user.PendingPhoneNumber, &user.PendingTelegramName, &dataKey, &keyID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, storage.ErrUserNotFound
+		}
+
+		return models.User{}, err
+	}
+
+	if err := s.open(&user, dataKey, keyID); err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// observe starts the span of the storage operation op, the returned func ends
+// it with the error the operation returns and records the duration
+func observe(ctx context.Context, op string) (context.Context, func(err *error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, op)
+
+	return ctx, func(err *error) {
+		tracing.End(span, err)
+		metrics.ObserveQuery(op, start)
+	}
 }
@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sso/sso/cmd/inter/lib/fieldcrypt"
+	"sso/sso/cmd/inter/storage"
+	"testing"
+)
+
+// newTestStorage returns a storage over a new database with the schema of
+// sso.db, migrated unless migrate is false
+func newTestStorage(t *testing.T, keys *fieldcrypt.Keyring, migrate bool) *Storage {
+	t.Helper()
+
+	base, err := os.ReadFile(filepath.Join("testdata", "base.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(filepath.Join(t.TempDir(), "sso.db"), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+
+	if _, err := s.db.Exec(string(base)); err != nil {
+		t.Fatalf("create base schema: %v", err)
+	}
+
+	if migrate {
+		if _, _, err := s.Migrate(context.Background()); err != nil {
+			t.Fatalf("Migrate() error = %v", err)
+		}
+	}
+
+	return s
+}
+
+func TestConfirmAccountTG(t *testing.T) {
+	s := newTestStorage(t, nil, true)
+	ctx := context.Background()
+
+	alice, err := s.SaveUser(ctx, []byte("hash"), "alice@example.com", "1990-01-02", "Alice", "+15550100", "alice_tg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveUser(ctx, []byte("hash"), "bob@example.com", "1990-01-02", "Bob", "+15550101", "bob_tg"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cases run in order, each one sees the bindings of the previous ones
+	tests := []struct {
+		name         string
+		telegramName string
+		chatID       int64
+		wantErr      error
+	}{
+		{name: "first bind", telegramName: "alice_tg", chatID: 100},
+		{name: "same chat again", telegramName: "alice_tg", chatID: 100},
+		{name: "another chat", telegramName: "alice_tg", chatID: 200, wantErr: storage.ErrTelegramChatBound},
+		{name: "chat of another user", telegramName: "bob_tg", chatID: 100, wantErr: storage.ErrTelegramChatTaken},
+		{name: "unknown user", telegramName: "carol_tg", chatID: 300, wantErr: storage.ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.ConfirmAccountTG(ctx, tt.telegramName, tt.chatID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ConfirmAccountTG() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	user, err := s.UserByTelegramChat(ctx, 100)
+	if err != nil || user.ID != alice {
+		t.Fatalf("UserByTelegramChat(100) = %d, %v, want %d", user.ID, err, alice)
+	}
+
+	if err := s.BindTelegramChat(ctx, alice, 200); err != nil {
+		t.Fatalf("BindTelegramChat() error = %v", err)
+	}
+	if _, err := s.UserByTelegramChat(ctx, 100); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("old chat still bound, UserByTelegramChat(100) error = %v", err)
+	}
+	if user, err := s.UserByTelegramChat(ctx, 200); err != nil || user.ID != alice {
+		t.Errorf("UserByTelegramChat(200) = %d, %v, want %d", user.ID, err, alice)
+	}
+}
@@ -0,0 +1,11 @@
+-- schema of sso.db, migration 2, the embedded migrations start after it
+CREATE TABLE migrations (version uint64,dirty bool);
+CREATE UNIQUE INDEX version_unique ON migrations (version);
+CREATE TABLE Users (ID INTEGER PRIMARY KEY AUTOINCREMENT, PasswordHash BLOB NOT NULL, Email TEXT NOT NULL UNIQUE, DateOfBirth TEXT, Fullname TEXT, PhoneNumber TEXT NOT NULL UNIQUE, TelegramName TEXT NOT NULL UNIQUE, is_admin BOOLEAN NOT NULL DEFAULT FALSE);
+CREATE TABLE PasswordResets (ResetID INTEGER PRIMARY KEY AUTOINCREMENT, UserID INTEGER NOT NULL, ResetToken TEXT NOT NULL, ExpiresAt DATETIME NOT NULL, FOREIGN KEY (UserID) REFERENCES Users (ID));
+CREATE TABLE ExternalAuth (ExternalAuthID INTEGER PRIMARY KEY AUTOINCREMENT, UserID INTEGER NOT NULL, Provider TEXT NOT NULL, ProviderID TEXT NOT NULL, FOREIGN KEY (UserID) REFERENCES Users (ID));
+CREATE TABLE Sessions (SessionID INTEGER PRIMARY KEY AUTOINCREMENT, UserID INTEGER NOT NULL, AccessToken TEXT NOT NULL, FOREIGN KEY (UserID) REFERENCES Users (ID));
+CREATE TABLE Apps (Id INTEGER PRIMARY KEY AUTOINCREMENT, Name TEXT NOT NULL, Secret TEXT NOT NULL);
+CREATE TABLE AccountConfirmations (ConfirmationID INTEGER PRIMARY KEY AUTOINCREMENT, UserID INTEGER NOT NULL, ConfirmationToken TEXT, IsConfirmed BOOLEAN NOT NULL DEFAULT (FALSE), FOREIGN KEY (UserID) REFERENCES Users (ID));
+INSERT INTO migrations (version, dirty) VALUES (2, FALSE);
+INSERT INTO Apps (Id, Name, Secret) VALUES (1, 'test', 'test-secret');
@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sso/sso/cmd/inter/domain/models"
+	"time"
+)
+
+// SaveUserEvent appends the event and returns its id
+func (s *Storage) SaveUserEvent(ctx context.Context, event models.UserEvent) (_ int64, err error) {
+	const op = "storage.sqlite.SaveUserEvent"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if event.Data == nil {
+		data = []byte("{}")
+	}
+
+	res, err := s.db.ExecContext(ctx, "INSERT INTO UserEvents (CreatedAt, UserID, Type, Data) VALUES (?, ?, ?, ?)",
+		time.Now().UTC(), event.UserID, event.Type, string(data))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// UserEvents returns up to limit events after the cursor, oldest first
+func (s *Storage) UserEvents(ctx context.Context, afterID int64, limit int) (_ []models.UserEvent, err error) {
+	const op = "storage.sqlite.UserEvents"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	rows, err := s.db.QueryContext(ctx, "SELECT EventID, CreatedAt, UserID, Type, Data FROM UserEvents WHERE EventID > ? ORDER BY EventID LIMIT ?",
+		afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var events []models.UserEvent
+	for rows.Next() {
+		var (
+			event models.UserEvent
+			data  string
+		)
+		if err := rows.Scan(&event.ID, &event.CreatedAt, &event.UserID, &event.Type, &data); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if err := json.Unmarshal([]byte(data), &event.Data); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
+
+// WebhookCursor returns the id of the last event the consumer has handled, 0 if none
+func (s *Storage) WebhookCursor(ctx context.Context, name string) (_ int64, err error) {
+	const op = "storage.sqlite.WebhookCursor"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	var eventID int64
+	err = s.db.QueryRowContext(ctx, "SELECT EventID FROM WebhookCursors WHERE Name = ?", name).Scan(&eventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return eventID, nil
+}
+
+func (s *Storage) SaveWebhookCursor(ctx context.Context, name string, eventID int64) (err error) {
+	const op = "storage.sqlite.SaveWebhookCursor"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO WebhookCursors (Name, EventID) VALUES (?, ?)
+		ON CONFLICT (Name) DO UPDATE SET EventID = excluded.EventID`, name, eventID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) UserEvent(ctx context.Context, eventID int64) (_ models.UserEvent, err error) {
+	const op = "storage.sqlite.UserEvent"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	var (
+		event models.UserEvent
+		data  string
+	)
+	err = s.db.QueryRowContext(ctx, "SELECT EventID, CreatedAt, UserID, Type, Data FROM UserEvents WHERE EventID = ?", eventID).
+		Scan(&event.ID, &event.CreatedAt, &event.UserID, &event.Type, &data)
+	if err != nil {
+		return models.UserEvent{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := json.Unmarshal([]byte(data), &event.Data); err != nil {
+		return models.UserEvent{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return event, nil
+}
@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/storage"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func (s *Storage) UpdatePassword(ctx context.Context, userID int64, passHash []byte) (err error) {
+	const op = "storage.sqlite.UpdatePassword"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	res, err := s.db.ExecContext(ctx, "UPDATE Users SET PasswordHash = ? WHERE ID = ?", passHash, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) UpdateEmail(ctx context.Context, userID int64, email string) (err error) {
+	const op = "storage.sqlite.UpdateEmail"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := s.updatePII(ctx, tx, userID, func(fields *piiFields) { fields.Email = email }); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UpdateProfile saves the profile fields and the pending contacts of the user and marks
+// resetChannels as not verified, changing the telegram name also unbinds the telegram chat
+func (s *Storage) UpdateProfile(ctx context.Context, user models.User, resetChannels []string) (err error) {
+	const op = "storage.sqlite.UpdateProfile"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	err = s.updatePII(ctx, tx, user.ID, func(fields *piiFields) {
+		fields.FullName = user.FullName
+		fields.DateOfBirth = user.DateOfBirth
+		fields.PhoneNumber = user.PhoneNumber
+		fields.PendingPhoneNumber = user.PendingPhoneNumber
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE Users SET TelegramName = ?, PendingTelegramName = ? WHERE ID = ?",
+		user.TelegramName, user.PendingTelegramName, user.ID)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, channel := range resetChannels {
+		if channel == models.ChannelTelegram {
+			if _, err := tx.ExecContext(ctx, "UPDATE Users SET TelegramChatID = NULL WHERE ID = ?", user.ID); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		if err := setContactVerified(ctx, tx, user.ID, channel, false); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetAdmin grants or revokes admin rights of the user
+func (s *Storage) SetAdmin(ctx context.Context, userID int64, isAdmin bool) (err error) {
+	const op = "storage.sqlite.SetAdmin"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	res, err := s.db.ExecContext(ctx, "UPDATE Users SET is_admin = ? WHERE ID = ?", isAdmin, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sso/sso/cmd/inter/domain/models"
+	"time"
+)
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func setContactVerified(ctx context.Context, db execer, userID int64, channel string, verified bool) error {
+	var verifiedAt any
+	if verified {
+		verifiedAt = time.Now().UTC()
+	}
+
+	_, err := db.ExecContext(ctx, `INSERT INTO ContactVerifications (UserID, Channel, IsVerified, VerifiedAt) VALUES (?, ?, ?, ?)
+		ON CONFLICT (UserID, Channel) DO UPDATE SET IsVerified = excluded.IsVerified, VerifiedAt = excluded.VerifiedAt`,
+		userID, channel, verified, verifiedAt)
+
+	return err
+}
+
+func (s *Storage) SetContactVerified(ctx context.Context, userID int64, channel string, verified bool) (err error) {
+	const op = "storage.sqlite.SetContactVerified"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	if err := setContactVerified(ctx, s.db, userID, channel, verified); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ContactVerifications returns the verification state of every channel, channels
+// that were never verified are reported as not verified
+func (s *Storage) ContactVerifications(ctx context.Context, userID int64) (_ []models.ContactVerification, err error) {
+	const op = "storage.sqlite.ContactVerifications"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	rows, err := s.db.QueryContext(ctx, "SELECT Channel, IsVerified, VerifiedAt FROM ContactVerifications WHERE UserID = ?", userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	stored := make(map[string]models.ContactVerification)
+	for rows.Next() {
+		var (
+			v          models.ContactVerification
+			verifiedAt sql.NullTime
+		)
+		if err := rows.Scan(&v.Channel, &v.IsVerified, &verifiedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		v.VerifiedAt = verifiedAt.Time
+		stored[v.Channel] = v
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	verifications := make([]models.ContactVerification, 0, len(models.Channels))
+	for _, channel := range models.Channels {
+		v, ok := stored[channel]
+		if !ok {
+			v = models.ContactVerification{Channel: channel}
+		}
+		verifications = append(verifications, v)
+	}
+
+	return verifications, nil
+}
@@ -0,0 +1,483 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/fieldcrypt"
+	"sso/sso/cmd/inter/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const webhookEndpointColumns = "EndpointID, AppID, URL, Secret, EventTypes, Disabled, ConsecutiveFailures, CreatedAt, DataKey, COALESCE(KeyID, '')"
+
+// fieldWebhookSecret is the field name the secret ciphertext is bound to
+const fieldWebhookSecret = "secret"
+
+const webhookDeliveryColumns = "DeliveryID, EndpointID, EventID, Status, Attempts, NextAttemptAt, LastError, CreatedAt, UpdatedAt"
+
+// SaveWebhookEndpoint registers the endpoint and returns its id, the secret
+// is encrypted when there is a keyring
+func (s *Storage) SaveWebhookEndpoint(ctx context.Context, endpoint models.WebhookEndpoint) (_ int64, err error) {
+	const op = "storage.sqlite.SaveWebhookEndpoint"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// the ciphertext is bound to the endpoint id, so the secret is sealed after the insert
+	secret := endpoint.Secret
+	if s.keys != nil {
+		secret = ""
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO WebhookEndpoints (AppID, URL, Secret, EventTypes, CreatedAt) VALUES (?, ?, ?, ?, ?)",
+		endpoint.AppID, endpoint.URL, secret, strings.Join(endpoint.EventTypes, ","), time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if s.keys != nil {
+		if err := writeWebhookSecret(ctx, tx, s.keys, id, endpoint.Secret); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) WebhookEndpoint(ctx context.Context, endpointID int64) (_ models.WebhookEndpoint, err error) {
+	const op = "storage.sqlite.WebhookEndpoint"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+webhookEndpointColumns+" FROM WebhookEndpoints WHERE EndpointID = ?", endpointID)
+
+	endpoint, err := s.scanWebhookEndpoint(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.WebhookEndpoint{}, fmt.Errorf("%s: %w", op, storage.ErrWebhookEndpointNotFound)
+		}
+		return models.WebhookEndpoint{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return endpoint, nil
+}
+
+// WebhookEndpoints returns the endpoints of the app, of all apps when appID is 0.
+// failingOnly keeps the endpoints whose last delivery failed.
+func (s *Storage) WebhookEndpoints(ctx context.Context, appID int, failingOnly bool) (_ []models.WebhookEndpoint, err error) {
+	const op = "storage.sqlite.WebhookEndpoints"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	var (
+		where []string
+		args  []any
+	)
+	if appID != 0 {
+		where = append(where, "AppID = ?")
+		args = append(args, appID)
+	}
+	if failingOnly {
+		where = append(where, "ConsecutiveFailures > 0")
+	}
+
+	query := "SELECT " + webhookEndpointColumns + " FROM WebhookEndpoints"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY EndpointID"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var endpoints []models.WebhookEndpoint
+	for rows.Next() {
+		endpoint, err := s.scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return endpoints, nil
+}
+
+func (s *Storage) SetWebhookEndpointDisabled(ctx context.Context, endpointID int64, disabled bool) (err error) {
+	const op = "storage.sqlite.SetWebhookEndpointDisabled"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	res, err := s.db.ExecContext(ctx, "UPDATE WebhookEndpoints SET Disabled = ? WHERE EndpointID = ?", disabled, endpointID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrWebhookEndpointNotFound)
+	}
+
+	return nil
+}
+
+// QueueWebhookDeliveries queues the event for every enabled endpoint subscribed
+// to its type that existed when it happened and returns the number of new deliveries
+func (s *Storage) QueueWebhookDeliveries(ctx context.Context, event models.UserEvent) (_ int64, err error) {
+	const op = "storage.sqlite.QueueWebhookDeliveries"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	now := time.Now().UTC()
+
+	res, err := s.db.ExecContext(ctx, `INSERT OR IGNORE INTO WebhookDeliveries
+		(EndpointID, EventID, Status, NextAttemptAt, CreatedAt, UpdatedAt)
+		SELECT EndpointID, ?, ?, ?, ?, ? FROM WebhookEndpoints
+		WHERE Disabled = FALSE AND CreatedAt <= ? AND instr(',' || EventTypes || ',', ',' || ? || ',') > 0`,
+		event.ID, models.WebhookDeliveryPending, now, now, now, event.CreatedAt.UTC(), event.Type)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	queued, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return queued, nil
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries of enabled
+// endpoints that are due, their next attempt is moved by lease so other
+// instances don't pick them up while they are being delivered
+func (s *Storage) ClaimWebhookDeliveries(ctx context.Context, lease time.Duration, limit int) (_ []models.WebhookDelivery, err error) {
+	const op = "storage.sqlite.ClaimWebhookDeliveries"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	rows, err := tx.QueryContext(ctx, `SELECT d.DeliveryID, d.EndpointID, d.EventID, d.Status, d.Attempts,
+		d.NextAttemptAt, d.LastError, d.CreatedAt, d.UpdatedAt
+		FROM WebhookDeliveries d JOIN WebhookEndpoints e ON e.EndpointID = d.EndpointID
+		WHERE d.Status = ? AND d.NextAttemptAt <= ? AND e.Disabled = FALSE
+		ORDER BY d.DeliveryID LIMIT ?`,
+		models.WebhookDeliveryPending, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	leasedUntil := now.Add(lease)
+	for i := range deliveries {
+		_, err := tx.ExecContext(ctx, "UPDATE WebhookDeliveries SET NextAttemptAt = ? WHERE DeliveryID = ?",
+			leasedUntil, deliveries[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		deliveries[i].NextAttemptAt = leasedUntil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+// SaveWebhookAttempt stores the outcome of a delivery attempt and counts
+// the consecutive failures of its endpoint
+func (s *Storage) SaveWebhookAttempt(ctx context.Context, delivery models.WebhookDelivery) (err error) {
+	const op = "storage.sqlite.SaveWebhookAttempt"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE WebhookDeliveries
+		SET Status = ?, Attempts = ?, NextAttemptAt = ?, LastError = ?, UpdatedAt = ?
+		WHERE DeliveryID = ?`,
+		delivery.Status, delivery.Attempts, delivery.NextAttemptAt.UTC(), delivery.LastError, time.Now().UTC(), delivery.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	failures := "ConsecutiveFailures + 1"
+	if delivery.Status == models.WebhookDeliveryDelivered {
+		failures = "0"
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE WebhookEndpoints SET ConsecutiveFailures = "+failures+" WHERE EndpointID = ?", delivery.EndpointID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// WebhookDeliveries returns the deliveries matching the filter, newest first
+func (s *Storage) WebhookDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) (_ []models.WebhookDelivery, err error) {
+	const op = "storage.sqlite.WebhookDeliveries"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	where := []string{"EndpointID = ?"}
+	args := []any{filter.EndpointID}
+	if filter.Status != "" {
+		where = append(where, "Status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.BeforeID != 0 {
+		where = append(where, "DeliveryID < ?")
+		args = append(args, filter.BeforeID)
+	}
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+webhookDeliveryColumns+" FROM WebhookDeliveries WHERE "+
+		strings.Join(where, " AND ")+" ORDER BY DeliveryID DESC LIMIT ?", args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+// ReplayWebhookDeliveries queues deliveries of the endpoint again with fresh
+// attempts, a single one if deliveryID is set, otherwise all failed ones.
+// It returns the number of queued deliveries.
+func (s *Storage) ReplayWebhookDeliveries(ctx context.Context, endpointID int64, deliveryID int64) (_ int64, err error) {
+	const op = "storage.sqlite.ReplayWebhookDeliveries"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	now := time.Now().UTC()
+	query := "UPDATE WebhookDeliveries SET Status = ?, Attempts = 0, NextAttemptAt = ?, LastError = '', UpdatedAt = ? WHERE EndpointID = ?"
+	args := []any{models.WebhookDeliveryPending, now, now, endpointID}
+	if deliveryID != 0 {
+		query += " AND DeliveryID = ?"
+		args = append(args, deliveryID)
+	} else {
+		query += " AND Status = ?"
+		args = append(args, models.WebhookDeliveryFailed)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	replayed, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if deliveryID != 0 && replayed == 0 {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrWebhookDeliveryNotFound)
+	}
+
+	return replayed, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanWebhookEndpoint scans a row of webhookEndpointColumns and decrypts the secret
+func (s *Storage) scanWebhookEndpoint(row rowScanner) (models.WebhookEndpoint, error) {
+	var (
+		endpoint   models.WebhookEndpoint
+		eventTypes string
+		dataKey    []byte
+		keyID      string
+	)
+	err := row.Scan(&endpoint.ID, &endpoint.AppID, &endpoint.URL, &endpoint.Secret, &eventTypes,
+		&endpoint.Disabled, &endpoint.ConsecutiveFailures, &endpoint.CreatedAt, &dataKey, &keyID)
+	if err != nil {
+		return models.WebhookEndpoint{}, err
+	}
+	endpoint.EventTypes = strings.Split(eventTypes, ",")
+
+	if keyID != "" {
+		if s.keys == nil {
+			return models.WebhookEndpoint{}, errors.New("webhook secret is encrypted but no keys are configured")
+		}
+
+		owner := webhookOwner(endpoint.ID)
+		key, err := s.keys.UnwrapDataKey(keyID, owner, dataKey)
+		if err != nil {
+			return models.WebhookEndpoint{}, err
+		}
+		if endpoint.Secret, err = fieldcrypt.Decrypt(key, owner, fieldWebhookSecret, endpoint.Secret); err != nil {
+			return models.WebhookEndpoint{}, err
+		}
+	}
+
+	return endpoint, nil
+}
+
+// webhookOwner binds the data key and the secret of the endpoint to its row
+func webhookOwner(endpointID int64) string {
+	return "webhook_endpoint:" + strconv.FormatInt(endpointID, 10)
+}
+
+// writeWebhookSecret stores the secret of the endpoint under a new data key,
+// in plaintext when keys is nil
+func writeWebhookSecret(ctx context.Context, q querier, keys *fieldcrypt.Keyring, endpointID int64, secret string) error {
+	if keys == nil {
+		_, err := q.ExecContext(ctx, "UPDATE WebhookEndpoints SET Secret = ?, DataKey = NULL, KeyID = NULL WHERE EndpointID = ?",
+			secret, endpointID)
+		return err
+	}
+
+	owner := webhookOwner(endpointID)
+	dataKey, wrapped, keyID, err := keys.NewDataKey(owner)
+	if err != nil {
+		return err
+	}
+	sealed, err := fieldcrypt.Encrypt(dataKey, owner, fieldWebhookSecret, secret)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, "UPDATE WebhookEndpoints SET Secret = ?, DataKey = ?, KeyID = ? WHERE EndpointID = ?",
+		sealed, wrapped, keyID, endpointID)
+
+	return err
+}
+
+// RotateWebhookSecrets stores the secrets of the endpoints under new data
+// keys wrapped by the primary master key, see RotateUsers for all and decrypt.
+// It returns the number of rotated endpoints.
+func (s *Storage) RotateWebhookSecrets(ctx context.Context, all bool, decrypt bool) (_ int, err error) {
+	const op = "storage.sqlite.RotateWebhookSecrets"
+	ctx, done := observe(ctx, op)
+	defer done(&err)
+
+	if s.keys == nil {
+		return 0, fmt.Errorf("%s: no keys are configured", op)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query := "SELECT " + webhookEndpointColumns + " FROM WebhookEndpoints"
+	var args []any
+	switch {
+	case decrypt:
+		query += " WHERE KeyID IS NOT NULL"
+	case !all:
+		query += " WHERE KeyID IS NULL OR KeyID <> ?"
+		args = append(args, s.keys.PrimaryKeyID())
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	var endpoints []models.WebhookEndpoint
+	for rows.Next() {
+		endpoint, err := s.scanWebhookEndpoint(rows)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	keys := s.keys
+	if decrypt {
+		keys = nil
+	}
+
+	for _, endpoint := range endpoints {
+		if err := writeWebhookSecret(ctx, tx, keys, endpoint.ID, endpoint.Secret); err != nil {
+			return 0, fmt.Errorf("%s: endpoint %d: %w", op, endpoint.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return len(endpoints), nil
+}
+
+func scanWebhookDelivery(row rowScanner) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	err := row.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastError, &d.CreatedAt, &d.UpdatedAt)
+
+	return d, err
+}
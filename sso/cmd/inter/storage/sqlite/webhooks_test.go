@@ -0,0 +1,219 @@
+package sqlite
+
+import (
+	"context"
+	"sso/sso/cmd/inter/domain/models"
+	"sso/sso/cmd/inter/lib/fieldcrypt"
+	"testing"
+	"time"
+)
+
+const testSecret = "whsec_0123456789abcdef"
+
+func saveEndpoint(t *testing.T, s *Storage) int64 {
+	t.Helper()
+
+	id, err := s.SaveWebhookEndpoint(context.Background(), models.WebhookEndpoint{
+		AppID:      1,
+		URL:        "https://hooks.example.com/sso",
+		Secret:     testSecret,
+		EventTypes: []string{models.UserEventRegistered},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func assertSecret(t *testing.T, s *Storage, id int64) {
+	t.Helper()
+
+	endpoint, err := s.WebhookEndpoint(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint.Secret != testSecret {
+		t.Errorf("secret = %q, want %q", endpoint.Secret, testSecret)
+	}
+}
+
+func rawSecret(t *testing.T, s *Storage, id int64) (secret string, keyID string) {
+	t.Helper()
+
+	err := s.db.QueryRow("SELECT Secret, COALESCE(KeyID, '') FROM WebhookEndpoints WHERE EndpointID = ?", id).
+		Scan(&secret, &keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return secret, keyID
+}
+
+func TestEncryptedWebhookSecret(t *testing.T) {
+	s := newTestStorage(t, testKeyring(t, "k1"), true)
+	id := saveEndpoint(t, s)
+
+	secret, keyID := rawSecret(t, s, id)
+	if !fieldcrypt.IsEncrypted(secret) || keyID != "k1" {
+		t.Errorf("stored secret = %q under %q, want a ciphertext under k1", secret, keyID)
+	}
+	assertSecret(t, s, id)
+
+	endpoints, err := s.WebhookEndpoints(context.Background(), 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].Secret != testSecret {
+		t.Errorf("WebhookEndpoints = %+v, want the decrypted endpoint", endpoints)
+	}
+
+	plain := &Storage{db: s.db}
+	if _, err := plain.WebhookEndpoint(context.Background(), id); err == nil {
+		t.Error("reading an encrypted secret without keys succeeded")
+	}
+}
+
+func TestRotateWebhookSecrets(t *testing.T) {
+	plain := newTestStorage(t, nil, true)
+	id := saveEndpoint(t, plain)
+	if secret, keyID := rawSecret(t, plain, id); secret != testSecret || keyID != "" {
+		t.Fatalf("stored secret = %q under %q, want the plaintext", secret, keyID)
+	}
+
+	steps := []struct {
+		name      string
+		keys      []string
+		all       bool
+		decrypt   bool
+		wantCount int
+		wantKeyID string
+	}{
+		{name: "plaintext to k1", keys: []string{"k1"}, wantCount: 1, wantKeyID: "k1"},
+		{name: "nothing to rotate", keys: []string{"k1"}, wantCount: 0, wantKeyID: "k1"},
+		{name: "k1 to k2", keys: []string{"k2", "k1"}, wantCount: 1, wantKeyID: "k2"},
+		{name: "all", keys: []string{"k2"}, all: true, wantCount: 1, wantKeyID: "k2"},
+		{name: "decrypt", keys: []string{"k2"}, decrypt: true, wantCount: 1, wantKeyID: ""},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			s := &Storage{db: plain.db, keys: testKeyring(t, step.keys...)}
+
+			n, err := s.RotateWebhookSecrets(context.Background(), step.all, step.decrypt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != step.wantCount {
+				t.Errorf("rotated %d endpoints, want %d", n, step.wantCount)
+			}
+
+			if _, keyID := rawSecret(t, s, id); keyID != step.wantKeyID {
+				t.Errorf("key id = %q, want %q", keyID, step.wantKeyID)
+			}
+			assertSecret(t, s, id)
+		})
+	}
+}
+
+// queueEvent saves an event of the endpoint type and queues its delivery
+func queueEvent(t *testing.T, s *Storage) {
+	t.Helper()
+
+	ctx := context.Background()
+	id, err := s.SaveUserEvent(ctx, models.UserEvent{UserID: 1, Type: models.UserEventRegistered})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := s.UserEvent(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := s.QueueWebhookDeliveries(ctx, event); err != nil || n != 1 {
+		t.Fatalf("QueueWebhookDeliveries = %d, %v, want 1 delivery", n, err)
+	}
+}
+
+func claim(t *testing.T, s *Storage, lease time.Duration) []models.WebhookDelivery {
+	t.Helper()
+
+	deliveries, err := s.ClaimWebhookDeliveries(context.Background(), lease, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return deliveries
+}
+
+func TestClaimWebhookDeliveries(t *testing.T) {
+	s := newTestStorage(t, nil, true)
+	saveEndpoint(t, s)
+	queueEvent(t, s)
+
+	const lease = time.Hour
+	before := time.Now()
+	deliveries := claim(t, s, lease)
+	if len(deliveries) != 1 {
+		t.Fatalf("claimed %d deliveries, want 1", len(deliveries))
+	}
+	if got := deliveries[0].NextAttemptAt; got.Before(before.Add(lease)) {
+		t.Errorf("leased until %v, want after %v", got, before.Add(lease))
+	}
+
+	// a claimed delivery is not handed out again until the lease runs out
+	if again := claim(t, s, lease); len(again) != 0 {
+		t.Errorf("claimed %d leased deliveries again", len(again))
+	}
+
+	delivery := deliveries[0]
+	delivery.Attempts = 1
+	delivery.NextAttemptAt = time.Now().Add(-time.Second)
+	if err := s.SaveWebhookAttempt(context.Background(), delivery); err != nil {
+		t.Fatal(err)
+	}
+	if due := claim(t, s, lease); len(due) != 1 || due[0].Attempts != 1 {
+		t.Errorf("claimed %+v after the retry is due, want the delivery with 1 attempt", due)
+	}
+}
+
+func TestReplayWebhookDeliveries(t *testing.T) {
+	s := newTestStorage(t, nil, true)
+	endpointID := saveEndpoint(t, s)
+	queueEvent(t, s)
+	queueEvent(t, s)
+
+	ctx := context.Background()
+	deliveries := claim(t, s, time.Hour)
+	if len(deliveries) != 2 {
+		t.Fatalf("claimed %d deliveries, want 2", len(deliveries))
+	}
+	for _, delivery := range deliveries {
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.Attempts = 8
+		delivery.LastError = "endpoint responded with 500"
+		if err := s.SaveWebhookAttempt(ctx, delivery); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := s.ReplayWebhookDeliveries(ctx, endpointID, deliveries[0].ID); err != nil || n != 1 {
+		t.Fatalf("replaying one delivery = %d, %v, want 1", n, err)
+	}
+	if n, err := s.ReplayWebhookDeliveries(ctx, endpointID, 0); err != nil || n != 1 {
+		t.Fatalf("replaying the failed deliveries = %d, %v, want the remaining 1", n, err)
+	}
+
+	replayed := claim(t, s, time.Hour)
+	if len(replayed) != 2 {
+		t.Fatalf("claimed %d replayed deliveries, want 2", len(replayed))
+	}
+	for _, delivery := range replayed {
+		if delivery.Attempts != 0 || delivery.LastError != "" {
+			t.Errorf("replayed delivery %+v kept its attempts", delivery)
+		}
+	}
+
+	if _, err := s.ReplayWebhookDeliveries(ctx, endpointID, 404); err == nil {
+		t.Error("replaying an unknown delivery succeeded")
+	}
+}
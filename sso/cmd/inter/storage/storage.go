@@ -3,8 +3,18 @@ package storage
 import "errors"
 
 var (
-	ErrUserExists    = errors.New("user already exists")
-	ErrUserNotFound  = errors.New("user not found")
-	ErrAppNotFound   = errors.New("app not found")
-	ErrTokenNotFound = errors.New("token not found")
+	ErrUserExists   = errors.New("user already exists")
+	ErrUserNotFound = errors.New("user not found")
+
+	ErrTelegramChatBound = errors.New("account is bound to another telegram chat")
+	ErrTelegramChatTaken = errors.New("telegram chat is bound to another account")
+	ErrAppNotFound       = errors.New("app not found")
+	ErrTokenNotFound     = errors.New("token not found")
+
+	ErrLoginApprovalNotFound = errors.New("login approval not found")
+	ErrCodeNotFound          = errors.New("code not found")
+	ErrSessionNotFound       = errors.New("session not found")
+
+	ErrWebhookEndpointNotFound = errors.New("webhook endpoint not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
 )
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sso/sso/cmd/inter/config"
+	"sso/sso/cmd/inter/lib/fieldcrypt"
+	"sso/sso/cmd/inter/storage/sqlite"
+	"syscall"
+)
+
+// migrator applies the migrations of this build to the database of the
+// config. Run it before starting a new version, the service reports
+// NOT_SERVING until the database is migrated.
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	keys, err := fieldcrypt.Load(cfg.Encryption.MasterKeys, cfg.Encryption.KeyFile, cfg.Encryption.IndexKey)
+	if err != nil {
+		log.Error("failed to load the encryption keys", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	storage, err := sqlite.New(cfg.StoragePath, keys)
+	if err != nil {
+		log.Error("failed to open the storage", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	from, to, err := storage.Migrate(ctx)
+	if err != nil {
+		log.Error("failed to migrate", slog.Uint64("version", to), slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	if from == to {
+		log.Info("database is up to date", slog.Uint64("version", to))
+		return
+	}
+
+	log.Info("database migrated", slog.Uint64("from", from), slog.Uint64("to", to))
+}
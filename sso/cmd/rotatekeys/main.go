@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sso/sso/cmd/inter/config"
+	"sso/sso/cmd/inter/lib/fieldcrypt"
+	"sso/sso/cmd/inter/storage/sqlite"
+	"syscall"
+)
+
+// rotatekeys moves the personal data of users and the secrets of the webhook
+// endpoints under the primary master key of the config. Run it after adding a new primary key, before the old one is
+// removed from the config.
+func main() {
+	batch := flag.Int("batch", 100, "users rotated in one transaction")
+	all := flag.Bool("all", false, "rotate every user, to rebuild the lookups after the index key changed")
+	decrypt := flag.Bool("decrypt", false, "store the users in plaintext again")
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	keys, err := fieldcrypt.Load(cfg.Encryption.MasterKeys, cfg.Encryption.KeyFile, cfg.Encryption.IndexKey)
+	if err != nil {
+		log.Error("failed to load the encryption keys", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	if keys == nil {
+		log.Error("no encryption keys are set")
+		os.Exit(1)
+	}
+
+	storage, err := sqlite.New(cfg.StoragePath, keys)
+	if err != nil {
+		log.Error("failed to open the storage", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	log.Info("rotating users", slog.String("key_id", keys.PrimaryKeyID()), slog.Bool("all", *all), slog.Bool("decrypt", *decrypt))
+
+	var lastID int64
+	total := 0
+	for {
+		next, n, err := storage.RotateUsers(ctx, lastID, *batch, *all, *decrypt)
+		if err != nil {
+			// the committed batches stay rotated, running again continues from the start
+			log.Error("failed to rotate users", slog.Int64("after_id", lastID), slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		if n == 0 {
+			break
+		}
+
+		lastID = next
+		total += n
+		log.Info("rotated users", slog.Int("count", total), slog.Int64("last_id", lastID))
+	}
+
+	log.Info("users rotated", slog.Int("count", total))
+
+	endpoints, err := storage.RotateWebhookSecrets(ctx, *all, *decrypt)
+	if err != nil {
+		log.Error("failed to rotate webhook secrets", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	log.Info("webhook secrets rotated", slog.Int("count", endpoints))
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
 	"sso/sso/cmd/inter/app"
 	"sso/sso/cmd/inter/config"
+	"sso/sso/cmd/inter/lib/metrics"
+	"sync"
 	"syscall"
+	"time"
 )
 
 const (
@@ -17,41 +22,162 @@ const (
 
 func main() {
 
-	cfg := config.MustLoad()
+	configPath := config.Path()
 
-	log := setupLogger(cfg.Env)
+	cfg, err := config.LoadPath(configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-	log.Info("Starting application", slog.String("env", cfg.Env))
+	level := new(slog.LevelVar)
+	level.Set(cfg.Level())
 
-	application := app.New(log, cfg.GRPC.Port, cfg.StoragePath, cfg.TokenTTL)
+	log := setupLogger(cfg.Env, level)
 
-	go app.NewTelegramBot(&app.TelegramAuth{})
-	go application.GRPCSrv.MustRun()
+	log.Info("Starting application", slog.String("env", cfg.Env))
+
+	application, err := app.New(log, level, cfg)
+	if err != nil {
+		log.Error("failed to build the application", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
 
 	// Graceful shutdown
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	var wg sync.WaitGroup
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				reloadConfig(log, configPath, application)
+			}
+		}
+	}()
+
+	if application.TelegramBot != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := application.TelegramBot.Run(ctx); err != nil {
+				log.Error("telegram bot failed", slog.String("error", err.Error()))
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if err := application.Health.Run(ctx); err != nil {
+			log.Error("health monitor failed", slog.String("error", err.Error()))
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if err := application.Webhooks.Run(ctx); err != nil {
+			log.Error("webhook dispatcher failed", slog.String("error", err.Error()))
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if err := application.AccountPurge.Run(ctx); err != nil {
+			log.Error("account purge job failed", slog.String("error", err.Error()))
+		}
+	}()
+	if application.TLS != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := application.TLS.Run(ctx, cfg.GRPC.TLS.ReloadInterval); err != nil {
+				log.Error("certificate reloader failed", slog.String("error", err.Error()))
+			}
+		}()
+	}
+	if application.Metrics != nil {
+		go application.Metrics.MustRun()
+	}
+	if application.Gateway != nil {
+		go application.Gateway.MustRun()
+	}
+	go application.GRPCSrv.MustRun()
 
-	<-stop
+	<-ctx.Done()
 
+	if application.Gateway != nil {
+		application.Gateway.Stop()
+	}
 	application.GRPCSrv.Stop()
+	if application.Metrics != nil {
+		application.Metrics.Stop()
+	}
+	wg.Wait()
+
+	if application.Tracing != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := application.Tracing.Shutdown(shutdownCtx); err != nil {
+			log.Error("failed to flush traces", slog.String("error", err.Error()))
+		}
+		cancel()
+	}
 
 	log.Info("Application stopped")
 
 }
 
-func setupLogger(env string) *slog.Logger {
+// reloadConfig re-reads the config on SIGHUP and swaps the settings that can
+// change while serving, the running config is kept when the new one is invalid.
+func reloadConfig(log *slog.Logger, path string, application *app.App) {
+	log.Info("reloading config", slog.String("path", path))
+
+	cfg, err := config.LoadPath(path)
+	if err != nil {
+		metrics.ConfigReload("failure")
+		log.Error("failed to reload config, the running config is kept", slog.String("error", err.Error()))
+		return
+	}
+
+	applied, restart := application.Reload(cfg)
+
+	log.Info("config reloaded", slog.Any("applied", applied))
+	if len(restart) > 0 {
+		metrics.ConfigReload("restart_required")
+		log.Warn("changed settings take effect after a restart", slog.Any("settings", restart))
+		return
+	}
+	metrics.ConfigReload("success")
+}
+
+// setupLogger returns the logger of env, level can be changed while it is used.
+func setupLogger(env string, level *slog.LevelVar) *slog.Logger {
 	var log *slog.Logger
 
 	switch env {
 	case envLocal:
-		log = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		log = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
 
 	case envDev:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
 
 	case envProd:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
 
 	}
 
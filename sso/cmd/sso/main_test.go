@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sso/sso/cmd/inter/app"
+	"sso/sso/cmd/inter/config"
+	"testing"
+)
+
+const configYAML = `
+log_level: %s
+storage_path: %q
+token_ttl: %s
+grpc:
+  port: 44044
+smtp:
+  from: "sso@example.com"
+`
+
+func TestReloadConfigKeepsRunningConfig(t *testing.T) {
+	dir := t.TempDir()
+	storagePath := filepath.Join(dir, "sso.db")
+	path := filepath.Join(dir, "config.yaml")
+
+	write := func(logLevel string, tokenTTL string) {
+		t.Helper()
+
+		if err := os.WriteFile(path, []byte(fmt.Sprintf(configYAML, logLevel, storagePath, tokenTTL)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("info", "1h")
+	cfg, err := config.LoadPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	level := new(slog.LevelVar)
+	level.Set(cfg.Level())
+
+	application, err := app.New(log, level, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the valid log level comes with an invalid token ttl, nothing is applied
+	write("debug", "-1h")
+	reloadConfig(log, path, application)
+
+	if level.Level() != slog.LevelInfo {
+		t.Errorf("level = %v, want %v", level.Level(), slog.LevelInfo)
+	}
+	if applied, restart := application.Reload(cfg); len(applied) != 0 || len(restart) != 0 {
+		t.Errorf("Reload() of the running config = %v, %v, want no changes", applied, restart)
+	}
+}